@@ -1,21 +1,52 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"text/template"
 	"time"
 
+	"yanwari-message-backend/services/language"
+
 	"gopkg.in/yaml.v3"
 )
 
 // ToneConfig トーン設定全体の構造
 type ToneConfig struct {
-	SystemRole string          `yaml:"system_role"`
-	AIModel    AIModelConfig   `yaml:"ai_model"`
-	Tones      map[string]Tone `yaml:"tones"`
+	SystemRole         string          `yaml:"system_role"`
+	AIModel            AIModelConfig   `yaml:"ai_model"`
+	Tones              map[string]Tone `yaml:"tones"`
+	CustomToneTemplate string          `yaml:"custom_tone_template"` // ユーザー定義トーン用の instruction_template
+	RefineTemplate     string          `yaml:"refine_template"`      // 追加指示による改訂用のテンプレート
+	// ExplanationTemplate 変換結果の変更ごとの理由を説明させるテンプレート
+	ExplanationTemplate string `yaml:"explanation_template,omitempty"`
+
+	// OutputConstraints 全トーン（ユーザー定義トーンを含む）に適用する変換結果の制約
+	OutputConstraints OutputConstraints `yaml:"output_constraints"`
+	// OutputRetries 変換結果が制約を満たさない場合の再生成回数（未指定の場合は1回）
+	OutputRetries *int `yaml:"output_retries,omitempty"`
+	// RelationshipGuidance 受信者との関係（boss, family など）ごとの配慮の指針
+	RelationshipGuidance map[string]string `yaml:"relationship_guidance,omitempty"`
+	// Language テンプレート（locales 以外）を書いている言語（未指定の場合は ja）
+	Language string `yaml:"language,omitempty"`
+	// Locales 言語ごとのシステムロール・テンプレート（トーン別は tones.<name>.locales）
+	Locales map[string]ConfigLocale `yaml:"locales,omitempty"`
+	// LanguageInstruction 出力言語を指示するテンプレート（翻訳する場合・出力言語のテンプレートが無い場合にシステムロールの直後に追加）
+	LanguageInstruction string `yaml:"language_instruction,omitempty"`
+
+	// HarshnessAnalysis 変換前のメッセージの強さ（攻撃性・皮肉・非難・緊急度）の分析
+	HarshnessAnalysis HarshnessAnalysis `yaml:"harshness_analysis,omitempty"`
+
+	// Version 保存済みプロンプト設定のバージョン番号（設定ファイルを直接読み込んだ場合は0）
+	Version int `yaml:"-"`
+	// ToneOrder YAML の tones に書かれた順のトーン名（Tones は map のため順序を別に持つ）
+	ToneOrder []string `yaml:"-"`
 }
 
 // AIModelConfig AIモデルの設定
@@ -26,18 +57,176 @@ type AIModelConfig struct {
 
 // Tone 個別トーンの設定
 type Tone struct {
-	DisplayName         string   `yaml:"display_name"`
-	Description         string   `yaml:"description"`
-	Characteristics     []string `yaml:"characteristics"`
-	InstructionTemplate string   `yaml:"instruction_template"`
+	DisplayName         string        `yaml:"display_name"`
+	Description         string        `yaml:"description"`
+	Characteristics     []string      `yaml:"characteristics"`
+	InstructionTemplate string        `yaml:"instruction_template"`
+	Examples            []ToneExample `yaml:"examples,omitempty"`
+	// Constraints このトーンの変換結果の制約（output_constraints に追加で適用）
+	Constraints OutputConstraints `yaml:"constraints,omitempty"`
+	// Locales 言語ごとの定義（指定した項目のみ上書きする。例: tones.gentle.locales.en）
+	Locales map[string]Tone `yaml:"locales,omitempty"`
+
+	// language LocalizeTone で選んだテンプレートの言語（未選択の場合は空）
+	language string
+}
+
+// ConfigLocale 言語ごとのシステムロール・テンプレート
+type ConfigLocale struct {
+	SystemRole          string `yaml:"system_role,omitempty"`
+	CustomToneTemplate  string `yaml:"custom_tone_template,omitempty"`
+	LanguageInstruction string `yaml:"language_instruction,omitempty"`
+}
+
+// PromptOptions トーンのプロンプト生成のオプション
+type PromptOptions struct {
+	Relationship   *Relationship // 受信者との関係（未登録の場合は nil）
+	InputLanguage  string        // 元のメッセージの言語（空の場合は OutputLanguage と同じ）
+	OutputLanguage string        // 変換結果の言語（空の場合は language と同じ）
+}
+
+// LanguagePromptData 出力言語の指示テンプレート用データ
+type LanguagePromptData struct {
+	InputLanguage  string // 元のメッセージの言語の表示名
+	OutputLanguage string // 変換結果の言語の表示名
+	Translate      bool   // 元のメッセージと異なる言語で出力する
+}
+
+// defaultLanguageInstruction language_instruction が未設定の場合に使うテンプレート
+const defaultLanguageInstruction = `<language>
+{{if .Translate}}元のメッセージは{{.InputLanguage}}です。トーンを変換したうえで{{.OutputLanguage}}に翻訳してください。
+{{end}}変換後の文章は必ず{{.OutputLanguage}}で出力してください。
+</language>`
+
+// OutputConstraints 変換結果の制約
+type OutputConstraints struct {
+	MaxLength      int      `yaml:"max_length,omitempty"`       // 最大文字数（0は無制限）
+	MustNotContain []string `yaml:"must_not_contain,omitempty"` // 含んではいけない語句
+}
+
+// defaultOutputRetries output_retries が未指定の場合の再生成回数
+const defaultOutputRetries = 1
+
+// HarshnessAnalysis メッセージの強さの分析設定
+type HarshnessAnalysis struct {
+	InstructionTemplate string `yaml:"instruction_template"` // 分析を依頼するテンプレート（利用可能な変数: .OriginalText）
+	// GuardThreshold 送信前の確認を求める総合スコア（0-100、未指定の場合は60）
+	GuardThreshold int `yaml:"guard_threshold,omitempty"`
+	// Rules AIで分析できない場合に使う観点（aggression, sarcasm, blame, urgency）ごとの語句
+	Rules map[string][]string `yaml:"rules,omitempty"`
+}
+
+// defaultGuardThreshold guard_threshold が未指定の場合の値
+const defaultGuardThreshold = 60
+
+// defaultAnalysisTemplate harshness_analysis.instruction_template が未設定の場合に使うテンプレート
+const defaultAnalysisTemplate = `<instructions>
+次のメッセージが受け取った相手にどれだけ強く・きつく伝わるかを分析してください。
+観点ごとに 0〜100 で採点し、該当する箇所をメッセージから一字一句そのまま抜き出してください。
+- aggression: 攻撃的・威圧的な表現
+- sarcasm: 皮肉・嫌味（表面的な意味と異なる意図を含む表現）
+- blame: 相手を責める・非難する表現
+- urgency: 急かす・圧をかける表現
+</instructions>
+<input>
+{{.OriginalText}}
+</input>
+JSONのみを出力してください。`
+
+// ToneExample トーン変換の例文
+type ToneExample struct {
+	Input  string `yaml:"input" json:"input"`
+	Output string `yaml:"output" json:"output"`
 }
 
 // PromptData テンプレート実行用のデータ構造
 type PromptData struct {
+	DisplayName     string
+	Description     string
 	Characteristics []string
+	Examples        []ToneExample
 	OriginalText    string
+
+	// 言語（表示名）
+	InputLanguage  string // 元のメッセージの言語
+	OutputLanguage string // 変換結果の言語
+
+	// 受信者との関係（下書きに受信者が設定され、送信者が関係を登録している場合のみ）
+	Relationship         string // 関係の表示名（例: 上司）
+	RelationshipNotes    string // 送信者が登録した補足
+	RelationshipGuidance string // relationship_guidance の指針
+}
+
+// Relationship プロンプトに含める受信者との関係
+type Relationship struct {
+	Type  string // 関係の種類（boss, family など）
+	Label string // 関係の表示名
+	Notes string // 送信者が登録した補足
+}
+
+// RefinePromptData 改訂指示テンプレート用データ
+type RefinePromptData struct {
+	Instruction string
+}
+
+// ExplanationPromptData 変更理由の説明テンプレート用データ
+type ExplanationPromptData struct {
+	DisplayName  string
+	OriginalText string
+	VariantText  string
+	Changes      []ExplanationChange
+	Categories   []string // 選択できる分類のキー
 }
 
+// ExplanationChange 説明させる変更1件
+type ExplanationChange struct {
+	ID     int
+	Before string
+	After  string
+}
+
+// defaultExplanationTemplate explanation_template が未設定の場合に使うテンプレート
+const defaultExplanationTemplate = `<instructions>
+メッセージを「{{.DisplayName}}」のトーンに書き換えました。番号を付けた各変更について、なぜその変更で伝わり方が良くなるのかを説明してください。
+分類は次から選んでください: {{range $i, $c := .Categories}}{{if $i}}, {{end}}{{$c}}{{end}}
+</instructions>
+<original>{{.OriginalText}}</original>
+<variant>{{.VariantText}}</variant>
+<changes>
+{{range .Changes}}{{.ID}}. 「{{.Before}}」→「{{.After}}」
+{{end}}</changes>
+{"changes": [{"id": 番号, "category": "分類", "reason": "理由を30文字以内で"}]} の形式のJSONのみを出力してください。`
+
+// defaultRefineTemplate refine_template が未設定の場合に使うテンプレート
+const defaultRefineTemplate = `直前の変換結果を、次の指示に従って書き直してください。
+<instruction>{{.Instruction}}</instruction>
+トーンと元のメッセージの意図は保ったまま、書き直した文章のみを出力してください。`
+
+// defaultCustomToneTemplate custom_tone_template が未設定の場合に使うテンプレート
+const defaultCustomToneTemplate = `<instructions>
+「{{.DisplayName}}」のトーンで、ユーザーのメッセージを書き換えてください。
+{{if .Description}}{{.Description}}
+{{end}}トーンの特徴：
+{{range .Characteristics}}- {{.}}
+{{end}}</instructions>
+{{if .Relationship}}<recipient>
+受信者との関係: {{.Relationship}}
+{{if .RelationshipGuidance}}配慮: {{.RelationshipGuidance}}
+{{end}}{{if .RelationshipNotes}}補足: {{.RelationshipNotes}}
+{{end}}</recipient>
+{{end}}{{if .Examples}}<examples>
+{{range .Examples}}<example>
+<input>{{.Input}}</input>
+<output>{{.Output}}</output>
+</example>
+{{end}}</examples>
+{{end}}<task>
+<input>
+{{.OriginalText}}
+</input>
+変換後の文章のみを出力してください。
+</task>`
+
 // ScheduleConfig スケジュール設定全体の構造
 type ScheduleConfig struct {
 	SystemRole        string                       `yaml:"system_role"`
@@ -79,17 +268,53 @@ type SchedulePromptData struct {
 	SelectedTone  string
 	CurrentTime   string
 	DayOfWeek     string
+	// RecipientContext 受信者のタイムゾーン・受信可能な時間帯など（受信者が未設定の場合は空）
+	RecipientContext string
 }
 
-var toneConfig *ToneConfig
-var scheduleConfig *ScheduleConfig
+// 読み込み済みの設定（リクエスト処理中に差し替えられるためアトミックに読み書きする）
+// 設定は差し替え後も変更しないため、取得したポインタはそのまま使い続けてよい
+var toneConfig atomic.Pointer[ToneConfig]
+var scheduleConfig atomic.Pointer[ScheduleConfig]
 
-// LoadToneConfig YAML設定ファイルを読み込み
+// LoadToneConfig 有効なトーン設定を取得（未読み込みの場合はYAML設定ファイルを読み込む）
 func LoadToneConfig() (*ToneConfig, error) {
-	if toneConfig != nil {
-		return toneConfig, nil
+	if current := toneConfig.Load(); current != nil {
+		return current, nil
+	}
+
+	data, err := ReadToneConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ParseToneConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[ToneConfig] YAML解析成功: %d個のトーン設定を読み込み\n", len(config.Tones))
+	for _, toneName := range config.ToneNames() {
+		fmt.Printf("[ToneConfig] - トーン: %s\n", toneName)
 	}
 
+	// 並行して別の設定が有効化された場合はそちらを優先する
+	toneConfig.CompareAndSwap(nil, config)
+	return toneConfig.Load(), nil
+}
+
+// CurrentToneConfig 有効なトーン設定を取得（未読み込みの場合は nil）
+func CurrentToneConfig() *ToneConfig {
+	return toneConfig.Load()
+}
+
+// ActivateToneConfig トーン設定を差し替える（処理中のリクエストは差し替え前の設定を使い続ける）
+func ActivateToneConfig(config *ToneConfig) {
+	toneConfig.Store(config)
+}
+
+// ReadToneConfigFile YAML設定ファイルの内容を読み込む
+func ReadToneConfigFile() ([]byte, error) {
 	// 設定ファイルのパスを取得
 	configPath := getConfigPath()
 	fmt.Printf("[ToneConfig] 設定ファイルパスを解決: %s\n", configPath)
@@ -106,20 +331,78 @@ func LoadToneConfig() (*ToneConfig, error) {
 	}
 
 	fmt.Printf("[ToneConfig] 設定ファイル読み込み成功: %d bytes\n", len(data))
+	return data, nil
+}
 
-	// YAML パース
+// ParseToneConfig YAMLからトーン設定を解析し、テンプレートを検証する
+func ParseToneConfig(data []byte) (*ToneConfig, error) {
 	var config ToneConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("YAML設定の解析に失敗 (%s): %w", configPath, err)
+		return nil, fmt.Errorf("YAML設定の解析に失敗: %w", err)
+	}
+	if len(config.Tones) == 0 {
+		return nil, fmt.Errorf("トーンが1つも定義されていません")
 	}
+	order, err := parseToneOrder(data)
+	if err != nil {
+		return nil, fmt.Errorf("YAML設定の解析に失敗: %w", err)
+	}
+	config.ToneOrder = order
 
-	fmt.Printf("[ToneConfig] YAML解析成功: %d個のトーン設定を読み込み\n", len(config.Tones))
-	for toneName := range config.Tones {
-		fmt.Printf("[ToneConfig] - トーン: %s\n", toneName)
+	templates := map[string]string{
+		"custom_tone_template": config.CustomToneTemplate,
+		"refine_template":      config.RefineTemplate,
+		"harshness_analysis.instruction_template": config.HarshnessAnalysis.InstructionTemplate,
+		"explanation_template":                    config.ExplanationTemplate,
+	}
+	if config.LanguageInstruction != "" {
+		templates["language_instruction"] = config.LanguageInstruction
+	}
+	for name, tone := range config.Tones {
+		templates["tones."+name+".instruction_template"] = tone.InstructionTemplate
+		for lang, locale := range tone.Locales {
+			templates["tones."+name+".locales."+lang+".instruction_template"] = locale.InstructionTemplate
+		}
+	}
+	for lang, locale := range config.Locales {
+		templates["locales."+lang+".custom_tone_template"] = locale.CustomToneTemplate
+		templates["locales."+lang+".language_instruction"] = locale.LanguageInstruction
+	}
+	for name, text := range templates {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("%s の解析に失敗: %w", name, err)
+		}
 	}
 
-	toneConfig = &config
-	return toneConfig, nil
+	return &config, nil
+}
+
+// parseToneOrder YAML の tones のキーを書かれた順に取得
+func parseToneOrder(data []byte) ([]string, error) {
+	var doc struct {
+		Tones yaml.Node `yaml:"tones"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var order []string
+	for i := 0; i+1 < len(doc.Tones.Content); i += 2 {
+		order = append(order, doc.Tones.Content[i].Value)
+	}
+	return order, nil
+}
+
+// ToneNames トーン名を設定の順に取得（順序が無い設定の場合は名前順）
+func (tc *ToneConfig) ToneNames() []string {
+	if len(tc.ToneOrder) == len(tc.Tones) {
+		return append([]string(nil), tc.ToneOrder...)
+	}
+	names := make([]string, 0, len(tc.Tones))
+	for name := range tc.Tones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // GetPrompt 指定されたトーンのプロンプトを生成
@@ -129,16 +412,52 @@ func (tc *ToneConfig) GetPrompt(toneName, originalText string) (string, error) {
 		return "", fmt.Errorf("サポートされていないトーンです: %s", toneName)
 	}
 
+	return tc.RenderPrompt(tone, originalText)
+}
+
+// RenderPrompt トーン定義からプロンプトを生成
+// instruction_template が空のトーン（ユーザー定義トーン）は custom_tone_template を使用する
+func (tc *ToneConfig) RenderPrompt(tone Tone, originalText string) (string, error) {
+	return tc.RenderPromptFor(tone, originalText, PromptOptions{})
+}
+
+// RenderPromptFor 受信者との関係・言語を指定してトーン定義からプロンプトを生成
+// 出力言語の定義（tones.<name>.locales.<lang>）があればそれを使い、無い場合や翻訳する場合は出力言語の指示を追加する
+func (tc *ToneConfig) RenderPromptFor(tone Tone, originalText string, opts PromptOptions) (string, error) {
+	outputLanguage := opts.OutputLanguage
+	if outputLanguage == "" {
+		outputLanguage = tc.GetLanguage()
+	}
+	inputLanguage := opts.InputLanguage
+	if inputLanguage == "" {
+		inputLanguage = outputLanguage
+	}
+	tone = tc.LocalizeTone(tone, outputLanguage)
+	instructionTemplate := tone.InstructionTemplate
+	if instructionTemplate == "" {
+		instructionTemplate = tc.customToneTemplate(tone.language)
+	}
+
 	// テンプレートを作成
-	tmpl, err := template.New("prompt").Parse(tone.InstructionTemplate)
+	tmpl, err := template.New("prompt").Parse(instructionTemplate)
 	if err != nil {
 		return "", fmt.Errorf("プロンプトテンプレートの解析エラー: %w", err)
 	}
 
 	// テンプレート実行用データ
 	data := PromptData{
+		DisplayName:     tone.DisplayName,
+		Description:     tone.Description,
 		Characteristics: tone.Characteristics,
+		Examples:        tone.Examples,
 		OriginalText:    originalText,
+		InputLanguage:   language.Name(inputLanguage),
+		OutputLanguage:  language.Name(outputLanguage),
+	}
+	if relationship := opts.Relationship; relationship != nil {
+		data.Relationship = relationship.Label
+		data.RelationshipNotes = relationship.Notes
+		data.RelationshipGuidance = tc.RelationshipGuidance[relationship.Type]
 	}
 
 	// テンプレート実行
@@ -148,11 +467,248 @@ func (tc *ToneConfig) GetPrompt(toneName, originalText string) (string, error) {
 	}
 
 	// システムロールを追加して完全なプロンプトを作成
-	fullPrompt := tc.SystemRole + "\n\n" + result.String()
+	fullPrompt := tc.systemRole(tone.language) + "\n\n" + result.String()
+
+	// 翻訳する場合・出力言語のテンプレートが無い場合はシステムロールの直後で出力言語を指示する
+	if inputLanguage != outputLanguage || tone.language != outputLanguage {
+		instruction, err := tc.renderLanguageInstruction(tone.language, LanguagePromptData{
+			InputLanguage:  data.InputLanguage,
+			OutputLanguage: data.OutputLanguage,
+			Translate:      inputLanguage != outputLanguage,
+		})
+		if err != nil {
+			return "", err
+		}
+		fullPrompt = tc.systemRole(tone.language) + "\n\n" + instruction + "\n\n" + result.String()
+	}
 	
 	return fullPrompt, nil
 }
 
+// GetLanguage テンプレート（locales 以外）を書いている言語
+func (tc *ToneConfig) GetLanguage() string {
+	if tc.Language == "" {
+		return language.Default
+	}
+	return tc.Language
+}
+
+// LocalizeTone トーン定義を指定した言語の定義（tones.<name>.locales.<lang>）で上書きする
+// 言語の定義が無い場合は元の定義のまま（テンプレートの言語は language）。LocalizeTone 済みの定義はそのまま返す
+func (tc *ToneConfig) LocalizeTone(tone Tone, lang string) Tone {
+	if tone.language != "" {
+		return tone
+	}
+	locale, ok := tone.Locales[lang]
+	tone.Locales = nil
+	if !ok || lang == tc.GetLanguage() {
+		tone.language = tc.GetLanguage()
+		if tone.InstructionTemplate == "" && tc.Locales[lang].CustomToneTemplate != "" {
+			// ユーザー定義トーンは言語ごとの custom_tone_template があればそれを使う
+			tone.language = lang
+		}
+		return tone
+	}
+
+	if locale.DisplayName != "" {
+		tone.DisplayName = locale.DisplayName
+	}
+	if locale.Description != "" {
+		tone.Description = locale.Description
+	}
+	if len(locale.Characteristics) > 0 {
+		tone.Characteristics = locale.Characteristics
+	}
+	if locale.InstructionTemplate != "" {
+		tone.InstructionTemplate = locale.InstructionTemplate
+	}
+	if len(locale.Examples) > 0 {
+		tone.Examples = locale.Examples
+	}
+	if locale.Constraints.MaxLength > 0 {
+		tone.Constraints.MaxLength = locale.Constraints.MaxLength
+	}
+	if len(locale.Constraints.MustNotContain) > 0 {
+		tone.Constraints.MustNotContain = locale.Constraints.MustNotContain
+	}
+	tone.language = lang
+	return tone
+}
+
+// TemplateLanguage LocalizeTone で選んだテンプレートの言語（LocalizeTone 前は空）
+func (t Tone) TemplateLanguage() string {
+	return t.language
+}
+
+// systemRole テンプレートの言語のシステムロール
+func (tc *ToneConfig) systemRole(lang string) string {
+	if role := tc.Locales[lang].SystemRole; role != "" {
+		return role
+	}
+	return tc.SystemRole
+}
+
+// customToneTemplate テンプレートの言語のユーザー定義トーン用テンプレート
+func (tc *ToneConfig) customToneTemplate(lang string) string {
+	if customTemplate := tc.Locales[lang].CustomToneTemplate; customTemplate != "" {
+		return customTemplate
+	}
+	if tc.CustomToneTemplate != "" {
+		return tc.CustomToneTemplate
+	}
+	return defaultCustomToneTemplate
+}
+
+// renderLanguageInstruction 出力言語の指示を生成（テンプレートの言語の language_instruction を優先）
+func (tc *ToneConfig) renderLanguageInstruction(lang string, data LanguagePromptData) (string, error) {
+	instructionTemplate := tc.Locales[lang].LanguageInstruction
+	if instructionTemplate == "" {
+		instructionTemplate = tc.LanguageInstruction
+	}
+	if instructionTemplate == "" {
+		instructionTemplate = defaultLanguageInstruction
+	}
+
+	tmpl, err := template.New("language").Parse(instructionTemplate)
+	if err != nil {
+		return "", fmt.Errorf("言語指示テンプレートの解析エラー: %w", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", fmt.Errorf("言語指示テンプレートの実行エラー: %w", err)
+	}
+	return result.String(), nil
+}
+
+// GetRefinePrompt 追加指示による改訂のプロンプトを生成
+func (tc *ToneConfig) GetRefinePrompt(instruction string) (string, error) {
+	refineTemplate := tc.RefineTemplate
+	if refineTemplate == "" {
+		refineTemplate = defaultRefineTemplate
+	}
+
+	tmpl, err := template.New("refine").Parse(refineTemplate)
+	if err != nil {
+		return "", fmt.Errorf("改訂テンプレートの解析エラー: %w", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, RefinePromptData{Instruction: instruction}); err != nil {
+		return "", fmt.Errorf("改訂テンプレートの実行エラー: %w", err)
+	}
+
+	return result.String(), nil
+}
+
+// PromptVersion トーンのプロンプト定義から決まるバージョン識別子
+// システムロール・テンプレート・特徴・例文のいずれかが変わると値が変わる
+// 保存済みのプロンプト設定の場合は "v<番号>/sha256:..." の形式で設定のバージョンを含める
+func (tc *ToneConfig) PromptVersion(tone Tone) string {
+	instructionTemplate := tone.InstructionTemplate
+	if instructionTemplate == "" {
+		instructionTemplate = tc.customToneTemplate(tone.language)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(tc.systemRole(tone.language) + "\x00" + instructionTemplate + "\x00"))
+	if tone.language != "" && tone.language != tc.GetLanguage() {
+		// LocalizeTone で他の言語の定義を選んだ場合は言語ごとに別のバージョンにする
+		h.Write([]byte(tone.language + "\x00"))
+	}
+	h.Write([]byte(strings.Join(tone.Characteristics, "\n") + "\x00"))
+	for _, example := range tone.Examples {
+		h.Write([]byte(example.Input + "\x00" + example.Output + "\x00"))
+	}
+	if len(tc.RelationshipGuidance) > 0 {
+		types := make([]string, 0, len(tc.RelationshipGuidance))
+		for relationshipType := range tc.RelationshipGuidance {
+			types = append(types, relationshipType)
+		}
+		sort.Strings(types)
+		for _, relationshipType := range types {
+			h.Write([]byte(relationshipType + "\x00" + tc.RelationshipGuidance[relationshipType] + "\x00"))
+		}
+	}
+	hash := "sha256:" + hex.EncodeToString(h.Sum(nil))[:12]
+	if tc.Version > 0 {
+		return fmt.Sprintf("v%d/%s", tc.Version, hash)
+	}
+	return hash
+}
+
+// ConstraintsFor トーンの変換結果に適用する制約（全体の制約とトーン別の制約を合わせたもの）
+// 最大文字数は両方に指定がある場合、短い方を使う
+func (tc *ToneConfig) ConstraintsFor(tone Tone) OutputConstraints {
+	constraints := OutputConstraints{
+		MaxLength:      tc.OutputConstraints.MaxLength,
+		MustNotContain: append(append([]string{}, tc.OutputConstraints.MustNotContain...), tone.Constraints.MustNotContain...),
+	}
+	if tone.Constraints.MaxLength > 0 && (constraints.MaxLength == 0 || tone.Constraints.MaxLength < constraints.MaxLength) {
+		constraints.MaxLength = tone.Constraints.MaxLength
+	}
+	return constraints
+}
+
+// GetOutputRetries 変換結果が制約を満たさない場合の再生成回数
+func (tc *ToneConfig) GetOutputRetries() int {
+	if tc.OutputRetries == nil {
+		return defaultOutputRetries
+	}
+	if *tc.OutputRetries < 0 {
+		return 0
+	}
+	return *tc.OutputRetries
+}
+
+// GetAnalysisPrompt メッセージの強さの分析プロンプトを生成
+func (tc *ToneConfig) GetAnalysisPrompt(originalText string) (string, error) {
+	analysisTemplate := tc.HarshnessAnalysis.InstructionTemplate
+	if analysisTemplate == "" {
+		analysisTemplate = defaultAnalysisTemplate
+	}
+
+	tmpl, err := template.New("analysis").Parse(analysisTemplate)
+	if err != nil {
+		return "", fmt.Errorf("分析テンプレートの解析エラー: %w", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, PromptData{OriginalText: originalText}); err != nil {
+		return "", fmt.Errorf("分析テンプレートの実行エラー: %w", err)
+	}
+
+	return tc.SystemRole + "\n\n" + result.String(), nil
+}
+
+// GetExplanationPrompt 変換結果の変更ごとの理由を説明させるプロンプトを生成
+func (tc *ToneConfig) GetExplanationPrompt(data ExplanationPromptData) (string, error) {
+	explanationTemplate := tc.ExplanationTemplate
+	if explanationTemplate == "" {
+		explanationTemplate = defaultExplanationTemplate
+	}
+
+	tmpl, err := template.New("explanation").Parse(explanationTemplate)
+	if err != nil {
+		return "", fmt.Errorf("説明テンプレートの解析エラー: %w", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", fmt.Errorf("説明テンプレートの実行エラー: %w", err)
+	}
+
+	return tc.SystemRole + "\n\n" + result.String(), nil
+}
+
+// GetGuardThreshold 送信前の確認を求める総合スコア
+func (tc *ToneConfig) GetGuardThreshold() int {
+	if tc.HarshnessAnalysis.GuardThreshold <= 0 {
+		return defaultGuardThreshold
+	}
+	return tc.HarshnessAnalysis.GuardThreshold
+}
+
 // GetAvailableTones 利用可能なトーン一覧を取得
 func (tc *ToneConfig) GetAvailableTones() map[string]string {
 	tones := make(map[string]string)
@@ -202,10 +758,21 @@ func getConfigPath() string {
 
 // LoadScheduleConfig スケジュール設定ファイルを読み込み
 func LoadScheduleConfig() (*ScheduleConfig, error) {
-	if scheduleConfig != nil {
-		return scheduleConfig, nil
+	if current := scheduleConfig.Load(); current != nil {
+		return current, nil
 	}
 
+	config, err := readScheduleConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleConfig.CompareAndSwap(nil, config)
+	return scheduleConfig.Load(), nil
+}
+
+// readScheduleConfig スケジュール設定ファイルを読み込んで解析する（有効な設定は差し替えない）
+func readScheduleConfig() (*ScheduleConfig, error) {
 	// 設定ファイルのパスを取得
 	configPath := getScheduleConfigPath()
 	fmt.Printf("[ScheduleConfig] 設定ファイルパスを解決: %s\n", configPath)
@@ -230,14 +797,16 @@ func LoadScheduleConfig() (*ScheduleConfig, error) {
 	}
 
 	fmt.Printf("[ScheduleConfig] YAML解析成功: スケジュール設定読み込み完了\n")
-
-	scheduleConfig = &config
-	return scheduleConfig, nil
+	return &config, nil
 }
 
 // GetSchedulePrompt スケジュール分析プロンプトを生成
 func (sc *ScheduleConfig) GetSchedulePrompt(messageText, selectedTone string) (string, error) {
-	now := time.Now()
+	return sc.GetSchedulePromptAt(messageText, selectedTone, time.Now(), "")
+}
+
+// GetSchedulePromptAt 指定した現在時刻（送信者のタイムゾーン）と受信者の情報でスケジュール分析プロンプトを生成
+func (sc *ScheduleConfig) GetSchedulePromptAt(messageText, selectedTone string, now time.Time, recipientContext string) (string, error) {
 	currentTime := now.Format("2006-01-02 15:04:05")
 	dayOfWeek := getDayOfWeekInJapanese(now.Weekday())
 
@@ -253,6 +822,8 @@ func (sc *ScheduleConfig) GetSchedulePrompt(messageText, selectedTone string) (s
 		SelectedTone: selectedTone,
 		CurrentTime:  currentTime,
 		DayOfWeek:    dayOfWeek,
+
+		RecipientContext: recipientContext,
 	}
 
 	// テンプレート実行
@@ -320,14 +891,23 @@ func getDayOfWeekInJapanese(weekday time.Weekday) string {
 }
 
 // ReloadConfig 設定ファイルを再読み込み（開発・チューニング用）
+// 両方のファイルを解析できた場合のみ差し替える。読み込み中のリクエストは差し替え前の設定を使い続け、
+// 解析に失敗した場合は有効な設定（保存済みのバージョンを含む）をそのまま使う
 func ReloadConfig() error {
-	toneConfig = nil
-	scheduleConfig = nil
-	_, err1 := LoadToneConfig()
-	_, err2 := LoadScheduleConfig()
-	
-	if err1 != nil {
-		return err1
+	data, err := ReadToneConfigFile()
+	if err != nil {
+		return err
 	}
-	return err2
+	newToneConfig, err := ParseToneConfig(data)
+	if err != nil {
+		return err
+	}
+	newScheduleConfig, err := readScheduleConfig()
+	if err != nil {
+		return err
+	}
+
+	ActivateToneConfig(newToneConfig)
+	scheduleConfig.Store(newScheduleConfig)
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnalyzeRequest メッセージの強さの分析リクエスト
+type AnalyzeRequest struct {
+	MessageID string `json:"messageId" binding:"required"`
+	// Text 分析するテキスト（省略時はメッセージの originalText）
+	Text string `json:"text,omitempty" binding:"max=1000"`
+}
+
+// AnalyzeMessage 変換前のメッセージの強さ（攻撃性・皮肉・非難・緊急度）を分析してメッセージに保存
+// POST /api/v1/transform/analyze
+func (h *TransformHandler) AnalyzeMessage(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req AnalyzeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+		return
+	}
+
+	text := req.Text
+	if text == "" {
+		text = message.OriginalText
+	}
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "分析するテキストがありません"})
+		return
+	}
+
+	if !checkAIQuota(c, h.usageService, currentUser, 1) {
+		return
+	}
+
+	analysis := analyzeHarshness(c.Request.Context(), h.llmProvider, h.usageService, currentUser.ID, messageID, text)
+	if err := h.messageService.SaveAnalysis(c.Request.Context(), messageID, currentUser.ID, analysis); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分析結果の保存に失敗しました"})
+		return
+	}
+
+	threshold := analysisConfig().GetGuardThreshold()
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"analysis":       analysis,
+			"harsh":          analysis.Harsh(threshold),
+			"guardThreshold": threshold,
+		},
+	})
+}
+
+// analysisConfig 分析に使うトーン設定（読み込まれていない場合は既定のテンプレート・しきい値・モデルを使う）
+func analysisConfig() *config.ToneConfig {
+	if toneConfig := config.CurrentToneConfig(); toneConfig != nil {
+		return toneConfig
+	}
+	return &config.ToneConfig{AIModel: config.AIModelConfig{Name: "claude-3-haiku-20240307", MaxTokens: 1000}}
+}
+
+// analyzeHarshness テキストの強さを分析する
+// provider が nil の場合や、応答が使えない場合は tone_prompts.yaml の語句によるルールベースの分析に切り替える
+func analyzeHarshness(ctx context.Context, provider llm.Provider, usageService *models.AIUsageService, userID, messageID primitive.ObjectID, text string) *models.MessageAnalysis {
+	toneConfig := analysisConfig()
+	if provider == nil {
+		return models.NewRuleBasedAnalysis(toneConfig.HarshnessAnalysis.Rules, text)
+	}
+
+	analysis, err := requestHarshnessAnalysis(ctx, provider, usageService, toneConfig, userID, messageID, text)
+	if err != nil {
+		fmt.Printf("[Analysis] AI分析を利用できないためルールベースの分析に切り替えます: %v\n", err)
+		return models.NewRuleBasedAnalysis(toneConfig.HarshnessAnalysis.Rules, text)
+	}
+	return analysis
+}
+
+// requestHarshnessAnalysis LLMプロバイダーを呼び出して強さの分析を取得
+func requestHarshnessAnalysis(ctx context.Context, provider llm.Provider, usageService *models.AIUsageService, toneConfig *config.ToneConfig, userID, messageID primitive.ObjectID, text string) (*models.MessageAnalysis, error) {
+	prompt, err := toneConfig.GetAnalysisPrompt(text)
+	if err != nil {
+		return nil, err
+	}
+
+	modelConfig := toneConfig.GetAIModelConfig()
+	llmReq := llm.NewUserRequest(modelConfig.Name, modelConfig.MaxTokens, prompt)
+	llmReq.ResponseFormat = llm.ResponseFormat{Type: llm.ResponseFormatJSON, Schema: models.MessageAnalysisSchema}
+	llmReq.Metadata["label"] = "analysis"
+	llmReq.Metadata["task"] = llm.TaskHarshness
+	llmReq.Metadata["original_text"] = text
+
+	resp, err := provider.Complete(ctx, llmReq)
+	if err != nil {
+		return nil, err
+	}
+	recordAIUsage(ctx, usageService, provider, userID, messageID, models.AIFeatureHarshness, llmReq, resp)
+
+	data, err := llm.ExtractJSON(resp.Text)
+	if err != nil {
+		return nil, err
+	}
+	return models.ParseMessageAnalysis(data, text)
+}
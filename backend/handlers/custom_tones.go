@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+)
+
+// CustomToneHandler ユーザー定義トーン関連のハンドラー
+type CustomToneHandler struct {
+	userService       *models.UserService
+	customToneService *models.CustomToneService
+}
+
+// NewCustomToneHandler カスタムトーンハンドラーを作成
+func NewCustomToneHandler(userService *models.UserService, customToneService *models.CustomToneService) *CustomToneHandler {
+	return &CustomToneHandler{
+		userService:       userService,
+		customToneService: customToneService,
+	}
+}
+
+// GetCustomTones 自分のカスタムトーン一覧を取得
+// GET /api/v1/custom-tones
+func (h *CustomToneHandler) GetCustomTones(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	tones, err := h.customToneService.GetCustomTones(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "カスタムトーンの取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tones,
+	})
+}
+
+// CreateCustomTone カスタムトーンを作成
+// POST /api/v1/custom-tones
+func (h *CustomToneHandler) CreateCustomTone(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req models.CustomToneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tone, err := h.customToneService.CreateCustomTone(c.Request.Context(), currentUser.ID, &req)
+	if err == models.ErrCustomToneLimitExceeded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "カスタムトーンの作成に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":    tone,
+		"message": "カスタムトーンを作成しました",
+	})
+}
+
+// UpdateCustomTone カスタムトーンを更新
+// PUT /api/v1/custom-tones/:id
+func (h *CustomToneHandler) UpdateCustomTone(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	toneID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なトーンIDです"})
+		return
+	}
+
+	var req models.CustomToneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tone, err := h.customToneService.UpdateCustomTone(c.Request.Context(), toneID, currentUser.ID, &req)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "カスタムトーンが見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "カスタムトーンの更新に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    tone,
+		"message": "カスタムトーンを更新しました",
+	})
+}
+
+// DeleteCustomTone カスタムトーンを削除
+// DELETE /api/v1/custom-tones/:id
+func (h *CustomToneHandler) DeleteCustomTone(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	toneID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なトーンIDです"})
+		return
+	}
+
+	err = h.customToneService.DeleteCustomTone(c.Request.Context(), toneID, currentUser.ID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "カスタムトーンが見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "カスタムトーンの削除に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "カスタムトーンを削除しました",
+	})
+}
+
+// RegisterRoutes カスタムトーン関連のルートを登録
+func (h *CustomToneHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	customTones := router.Group("/custom-tones")
+	customTones.Use(firebaseMiddleware)
+	{
+		customTones.GET("", h.GetCustomTones)
+		customTones.POST("", h.CreateCustomTone)
+		customTones.PUT("/:id", h.UpdateCustomTone)
+		customTones.DELETE("/:id", h.DeleteCustomTone)
+	}
+}
+
+// customToneConfig カスタムトーンを instruction_template 用のトーン定義に変換
+// InstructionTemplate を空にすることで custom_tone_template が使われる
+func customToneConfig(tone models.CustomTone) config.Tone {
+	examples := make([]config.ToneExample, 0, len(tone.Examples))
+	for _, example := range tone.Examples {
+		examples = append(examples, config.ToneExample{Input: example.Input, Output: example.Output})
+	}
+
+	return config.Tone{
+		DisplayName:     tone.DisplayName,
+		Description:     tone.Description,
+		Characteristics: tone.Characteristics,
+		Examples:        examples,
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"yanwari-message-backend/middleware"
+	"yanwari-message-backend/models"
+)
+
+// ExperimentHandler トーンプロンプトの A/B 実験ハンドラー（チューニング用）
+type ExperimentHandler struct {
+	userService       *models.UserService
+	experimentService *models.ExperimentService
+}
+
+// NewExperimentHandler 実験ハンドラーを作成
+func NewExperimentHandler(userService *models.UserService, experimentService *models.ExperimentService) *ExperimentHandler {
+	return &ExperimentHandler{
+		userService:       userService,
+		experimentService: experimentService,
+	}
+}
+
+// ListExperiments 実験一覧を取得
+// GET /api/v1/experiments
+func (h *ExperimentHandler) ListExperiments(c *gin.Context) {
+	experiments, err := h.experimentService.ListExperiments(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "実験一覧の取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": experiments,
+	})
+}
+
+// CreateExperiment 実験を作成
+// POST /api/v1/experiments
+func (h *ExperimentHandler) CreateExperiment(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req models.ExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	experiment, err := h.experimentService.CreateExperiment(c.Request.Context(), &req, currentUser.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":    experiment,
+		"message": "実験を作成しました",
+	})
+}
+
+// StartExperiment 実験を開始
+// POST /api/v1/experiments/:id/start
+func (h *ExperimentHandler) StartExperiment(c *gin.Context) {
+	h.changeStatus(c, h.experimentService.StartExperiment, "実験を開始しました")
+}
+
+// StopExperiment 実験を終了
+// POST /api/v1/experiments/:id/stop
+func (h *ExperimentHandler) StopExperiment(c *gin.Context) {
+	h.changeStatus(c, h.experimentService.StopExperiment, "実験を終了しました")
+}
+
+// changeStatus 実験の状態を変更してレスポンスを返す
+func (h *ExperimentHandler) changeStatus(c *gin.Context, change func(context.Context, primitive.ObjectID) (*models.Experiment, error), message string) {
+	experimentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効な実験IDです"})
+		return
+	}
+
+	experiment, err := change(c.Request.Context(), experimentID)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "実験が見つかりません"})
+		return
+	case errors.Is(err, models.ErrExperimentConflict), errors.Is(err, models.ErrExperimentInvalidStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "実験の更新に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    experiment,
+		"message": message,
+	})
+}
+
+// GetReport 群ごとの平均評価・選択率・サンプル数を取得
+// GET /api/v1/experiments/:id/report
+func (h *ExperimentHandler) GetReport(c *gin.Context) {
+	experimentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効な実験IDです"})
+		return
+	}
+
+	report, err := h.experimentService.GetReport(c.Request.Context(), experimentID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "実験が見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "実験結果の集計に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": report,
+	})
+}
+
+// RegisterRoutes 実験関連のルートを登録
+// 実験の群のプロンプトは全ユーザーの変換に使われるため、管理者のみ利用できる
+func (h *ExperimentHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	experiments := router.Group("/experiments")
+	experiments.Use(firebaseMiddleware, middleware.RequireAdmin())
+	{
+		experiments.GET("", h.ListExperiments)
+		experiments.POST("", h.CreateExperiment)
+		experiments.POST("/:id/start", h.StartExperiment)
+		experiments.POST("/:id/stop", h.StopExperiment)
+		experiments.GET("/:id/report", h.GetReport)
+	}
+}
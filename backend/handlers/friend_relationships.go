@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"yanwari-message-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateFriendRelationshipInput は友達との関係登録のリクエストボディ
+// type が空の場合は登録を解除する
+type UpdateFriendRelationshipInput struct {
+	Type  string `json:"type"`
+	Notes string `json:"notes" binding:"max=200"`
+}
+
+// GetRelationshipTypes は登録できる関係の一覧を取得するハンドラー
+func (h *FriendRequestHandler) GetRelationshipTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": models.FriendRelationshipTypes,
+	})
+}
+
+// UpdateFriendRelationship は友達との関係（上司・家族など）を登録するハンドラー
+// 登録した関係は、その友達宛ての下書きをトーン変換するときのプロンプトに含まれる
+func (h *FriendRequestHandler) UpdateFriendRelationship(c *gin.Context) {
+	user, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	friendID, err := primitive.ObjectIDFromHex(c.Param("friendId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効な友達IDです"})
+		return
+	}
+
+	var input UpdateFriendRelationshipInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	var relationship *models.FriendRelationship
+	if input.Type != "" {
+		relationship, err = models.NewFriendRelationship(input.Type, input.Notes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = h.friendshipService.SetRelationship(c.Request.Context(), user.ID, friendID, relationship)
+	if errors.Is(err, models.ErrFriendshipNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "友達との関係の登録に失敗しました"})
+		return
+	}
+
+	message := "友達との関係を登録しました"
+	if relationship == nil {
+		message = "友達との関係の登録を解除しました"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    relationship,
+	})
+}
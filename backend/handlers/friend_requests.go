@@ -485,5 +485,7 @@ func (h *FriendRequestHandler) RegisterRoutes(v1 *gin.RouterGroup, firebaseMiddl
 	{
 		friends.GET("/", h.GetFriends)       // 友達一覧取得
 		friends.DELETE("/remove", h.RemoveFriend) // 友達削除
+		friends.GET("/relationship-types", h.GetRelationshipTypes)         // 登録できる関係の一覧
+		friends.PUT("/:friendId/relationship", h.UpdateFriendRelationship) // 友達との関係を登録
 	}
 }
\ No newline at end of file
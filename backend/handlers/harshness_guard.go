@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+
+	"github.com/gin-gonic/gin"
+)
+
+// harshnessGuard 送信するテキストの強さの確認
+// 送信予約の作成・変更と、送信予約済みのメッセージの送信するテキストの変更の全ての経路で使う
+type harshnessGuard struct {
+	messageService *models.MessageService
+	llmProvider    llm.Provider
+	usageService   *models.AIUsageService
+}
+
+// newHarshnessGuard 送信するテキストの強さの確認を作成
+func newHarshnessGuard(messageService *models.MessageService, llmProvider llm.Provider, usageService *models.AIUsageService) *harshnessGuard {
+	return &harshnessGuard{
+		messageService: messageService,
+		llmProvider:    llmProvider,
+		usageService:   usageService,
+	}
+}
+
+// allow 送信するテキストが強く伝わる可能性がある場合は 409 と分析結果を返して false を返す
+// confirmed（確認ダイアログで「このまま送信」を選んだ場合）が true なら確認しない
+func (g *harshnessGuard) allow(c *gin.Context, user *models.User, message *models.Message, finalText string, confirmed bool) bool {
+	if confirmed {
+		return true
+	}
+	analysis := g.check(c.Request.Context(), user, message, finalText)
+	if analysis == nil {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "このメッセージはまだ強い印象を与える可能性があります。このまま送信しますか？",
+		"code":     "harsh_message",
+		"analysis": analysis,
+	})
+	return false
+}
+
+// check 送信するテキストの強さを確認し、確認が必要な場合は分析結果を返す（不要な場合は nil）
+// 同じテキストの分析結果がメッセージに保存されていれば再利用し、無ければ分析して保存する
+// AI利用上限に達している場合は送信を妨げないよう、ルールベースの分析を使う
+func (g *harshnessGuard) check(ctx context.Context, user *models.User, message *models.Message, finalText string) *models.MessageAnalysis {
+	text := firstNonEmptyText(finalText, message.FinalText, message.OriginalText)
+	if text == "" {
+		return nil
+	}
+
+	analysis := message.Analysis
+	if analysis == nil || analysis.Text != text {
+		provider := g.llmProvider
+		if g.usageService != nil {
+			if _, err := g.usageService.CheckQuota(ctx, user.ID, userLocation(user), 1); err != nil {
+				provider = nil
+			}
+		}
+		analysis = analyzeHarshness(ctx, provider, g.usageService, user.ID, message.ID, text)
+		if err := g.messageService.SaveAnalysis(ctx, message.ID, user.ID, analysis); err != nil {
+			fmt.Printf("[HarshnessGuard] 分析結果の保存に失敗しました: %v\n", err)
+		}
+	}
+
+	if !analysis.Harsh(analysisConfig().GetGuardThreshold()) {
+		return nil
+	}
+	return analysis
+}
+
+// firstNonEmptyText 最初の空でないテキスト
+func firstNonEmptyText(texts ...string) string {
+	for _, text := range texts {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"yanwari-message-backend/middleware"
+	"yanwari-message-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobHandler バックグラウンドジョブの状態ハンドラー（管理用）
+type JobHandler struct {
+	leases     *models.JobLeaseService
+	instanceID string // このインスタンスのID（リースの holder と比較する）
+}
+
+// NewJobHandler バックグラウンドジョブハンドラーを作成
+func NewJobHandler(leases *models.JobLeaseService, instanceID string) *JobHandler {
+	return &JobHandler{
+		leases:     leases,
+		instanceID: instanceID,
+	}
+}
+
+// GetLeaders ジョブごとの現在のリーダーと最後のハートビートを取得
+// リースが期限切れ（active=false）の場合は、リーダーが停止して次のリーダーが決まっていない
+// GET /api/v1/jobs/leaders
+func (h *JobHandler) GetLeaders(c *gin.Context) {
+	leases, err := h.leases.ListLeases(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ジョブのリーダーの取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"instanceId": h.instanceID,
+			"leaders":    leases,
+		},
+	})
+}
+
+// RegisterRoutes バックグラウンドジョブ関連のルートを登録
+// インスタンスID（ホスト名・プロセスID）を返すため、管理者のみ利用できる
+func (h *JobHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	jobs := router.Group("/jobs")
+	jobs.Use(firebaseMiddleware, middleware.RequireAdmin())
+	{
+		jobs.GET("/leaders", h.GetLeaders) // 現在のリーダーと最後のハートビート
+	}
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain リポジトリの設定ファイル（config/*.yaml）を使ってテストする
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("TONE_CONFIG_PATH", filepath.Join("..", "config", "tone_prompts.yaml"))
+	os.Setenv("SCHEDULE_CONFIG_PATH", filepath.Join("..", "config", "schedule_prompts.yaml"))
+	os.Exit(m.Run())
+}
@@ -6,6 +6,8 @@ import (
 	"strconv"
 
 	"yanwari-message-backend/models"
+	"yanwari-message-backend/services"
+	"yanwari-message-backend/services/llm"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,13 +16,17 @@ import (
 
 // MessageHandler メッセージハンドラー
 type MessageHandler struct {
-	messageService *models.MessageService
+	messageService  *models.MessageService
+	deliveryService *services.DeliveryService
+	guard           *harshnessGuard // 送信予約・送信予約済みのテキストの変更時の強さの確認
 }
 
 // NewMessageHandler メッセージハンドラーを作成
-func NewMessageHandler(messageService *models.MessageService) *MessageHandler {
+func NewMessageHandler(messageService *models.MessageService, deliveryService *services.DeliveryService, llmProvider llm.Provider, usageService *models.AIUsageService) *MessageHandler {
 	return &MessageHandler{
-		messageService: messageService,
+		messageService:  messageService,
+		deliveryService: deliveryService,
+		guard:           newHarshnessGuard(messageService, llmProvider, usageService),
 	}
 }
 
@@ -80,6 +86,20 @@ func (h *MessageHandler) UpdateMessage(c *gin.Context) {
 		return
 	}
 
+	// 送信予約する・送信予約済みのメッセージの送信するテキストを変える場合は、スケジュールの作成と同じく強さを確認する
+	if req.ScheduledAt != nil || req.ChangesSendText() {
+		current, err := h.messageService.GetMessage(c.Request.Context(), messageID, senderID)
+		if err != nil || current.SenderID != senderID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+			return
+		}
+		if req.ScheduledAt != nil || current.Status == models.MessageStatusScheduled {
+			if !h.guard.allow(c, sender, current, current.SendTextAfter(&req), req.ConfirmHarsh) {
+				return
+			}
+		}
+	}
+
 	message, err := h.messageService.UpdateMessage(c.Request.Context(), messageID, senderID, &req)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -281,9 +301,10 @@ func (h *MessageHandler) MarkMessageAsRead(c *gin.Context) {
 }
 
 // DeliverScheduledMessages スケジュール配信を実行（管理者API）
+// バックグラウンド配信と同じくメッセージを確保してから配信するため、配信エンジンと同時に実行しても二重に配信しない
 // POST /api/v1/messages/deliver-scheduled
 func (h *MessageHandler) DeliverScheduledMessages(c *gin.Context) {
-	messages, err := h.messageService.DeliverScheduledMessages(c.Request.Context())
+	messages, err := h.deliveryService.DeliverDueMessages(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "スケジュール配信に失敗しました", "details": err.Error()})
 		return
@@ -380,6 +401,77 @@ func (h *MessageHandler) GetSentMessages(c *gin.Context) {
 	})
 }
 
+// GetFailedMessages 配信失敗（failed）のメッセージ一覧を取得（送信者向け）
+// 失敗の原因（lastDeliveryError）と試行回数（deliveryAttempts）を含む
+// GET /api/v1/messages/failed
+func (h *MessageHandler) GetFailedMessages(c *gin.Context) {
+	sender, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ページネーション
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	messages, total, err := h.messageService.GetFailedMessages(c.Request.Context(), sender.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "配信に失敗したメッセージの取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"messages": messages,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+		"message": "配信に失敗したメッセージ一覧を取得しました",
+	})
+}
+
+// RetryDelivery 配信失敗（failed）のメッセージを再送する（送信者向け）
+// 次回の配信チェックで配信する（スケジュールは outbox イベントから pending に戻す）
+// POST /api/v1/messages/:id/retry
+func (h *MessageHandler) RetryDelivery(c *gin.Context) {
+	sender, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	message, err := h.messageService.RetryFailedMessage(c.Request.Context(), messageID, sender.ID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "配信に失敗したメッセージが見つかりません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "再送の登録に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    message,
+		"message": "メッセージの再送を登録しました",
+	})
+}
+
 // RegisterRoutes メッセージ関連のルートを登録
 func (h *MessageHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
 	messages := router.Group("/messages")
@@ -389,6 +481,8 @@ func (h *MessageHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddlew
 		messages.POST("/draft", h.CreateDraft)
 		messages.GET("/drafts", h.GetDrafts)
 		messages.GET("/sent", h.GetSentMessages)     // 特定パスを先に配置
+		messages.GET("/failed", h.GetFailedMessages)
+		messages.POST("/:id/retry", h.RetryDelivery)
 		messages.PUT("/:id", h.UpdateMessage)
 		messages.GET("/:id", h.GetMessage)
 		messages.DELETE("/:id", h.DeleteMessage)
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"yanwari-message-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NotificationHandler アプリ内通知ハンドラー
+type NotificationHandler struct {
+	userService         *models.UserService
+	notificationService *models.NotificationService
+}
+
+// NewNotificationHandler アプリ内通知ハンドラーを作成
+func NewNotificationHandler(userService *models.UserService, notificationService *models.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		userService:         userService,
+		notificationService: notificationService,
+	}
+}
+
+// GetNotifications 自分の通知を新しい順に取得
+// GET /api/v1/notifications
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := 1
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	notifications, total, unread, err := h.notificationService.GetNotifications(c.Request.Context(), currentUser.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "通知の取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"notifications": notifications,
+			"unreadCount":   unread,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// MarkAsRead 通知を既読にする
+// PUT /api/v1/notifications/:id/read
+func (h *NotificationHandler) MarkAsRead(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	notificationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効な通知IDです"})
+		return
+	}
+
+	err = h.notificationService.MarkAsRead(c.Request.Context(), notificationID, currentUser.ID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知が見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "通知の更新に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "通知を既読にしました"})
+}
+
+// MarkAllAsRead 自分の未読の通知を全て既読にする
+// PUT /api/v1/notifications/read-all
+func (h *NotificationHandler) MarkAllAsRead(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.notificationService.MarkAllAsRead(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "通知の更新に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    gin.H{"updated": updated},
+		"message": "全ての通知を既読にしました",
+	})
+}
+
+// RegisterRoutes アプリ内通知関連のルートを登録
+func (h *NotificationHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	notifications := router.Group("/notifications")
+	notifications.Use(firebaseMiddleware)
+	{
+		notifications.GET("", h.GetNotifications)
+		notifications.PUT("/read-all", h.MarkAllAsRead)
+		notifications.PUT("/:id/read", h.MarkAsRead)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+)
+
+// OfflineResponder タスク種別に応じてルールベースの応答を生成する（LLM_PROVIDER=fake の応答生成関数）
+// トーン変換は tone_prompts.yaml の characteristics、時間提案は schedule_prompts.yaml の
+// default_suggestions から決定的な出力を組み立てる（その他のタスクは llm.EchoResponder に任せる）
+func OfflineResponder(ctx context.Context, req *llm.Request) (string, error) {
+	switch req.Metadata["task"] {
+	case llm.TaskToneTransform:
+		return offlineToneVariation(req.Metadata["tone"], req.Metadata["characteristics"], req.Metadata["original_text"]), nil
+	case llm.TaskScheduleSuggest:
+		return offlineScheduleSuggestion(req.Metadata["message_text"])
+	case llm.TaskToneRefine:
+		return offlineRefinement(req.Metadata["base_text"], req.Metadata["instruction"]), nil
+	case llm.TaskHarshness:
+		return offlineHarshnessAnalysis(req.Metadata["original_text"])
+	case llm.TaskToneExplain:
+		return offlineExplanation(req.Metadata["original_text"], req.Metadata["variant_text"])
+	default:
+		return llm.EchoResponder(ctx, req)
+	}
+}
+
+// offlineToneVariation トーンの特徴に含まれるキーワードから変換文を組み立てる
+// customCharacteristics はカスタムトーンの特徴（改行区切り、グローバルトーンの場合は空）
+func offlineToneVariation(tone, customCharacteristics, originalText string) string {
+	joined := customCharacteristics
+	if joined == "" {
+		if toneConfig, err := config.LoadToneConfig(); err == nil {
+			if t, ok := toneConfig.Tones[tone]; ok {
+				joined = strings.Join(t.Characteristics, "\n")
+			}
+		}
+	}
+
+	body := strings.TrimSpace(originalText)
+	body = strings.TrimRight(body, "。.！!？?")
+
+	var b strings.Builder
+	if strings.Contains(joined, "クッション") || strings.Contains(joined, "敬語") {
+		b.WriteString("恐れ入りますが、")
+	}
+	b.WriteString(body)
+
+	switch {
+	case strings.Contains(joined, "ため口") || strings.Contains(joined, "カジュアル"):
+		b.WriteString("！")
+	case strings.Contains(joined, "敬語"):
+		b.WriteString("。よろしくお願いいたします。")
+	default:
+		b.WriteString("。")
+	}
+
+	if strings.Contains(joined, "代替案") || strings.Contains(joined, "提案") {
+		b.WriteString("一緒に進め方を考えられればと思います。")
+	}
+	if strings.Contains(joined, "感謝") {
+		b.WriteString("いつもありがとうございます。")
+	}
+	if strings.Contains(joined, "絵文字") {
+		b.WriteString(firstEmoji(joined, "😊"))
+	}
+
+	return b.String()
+}
+
+// offlineRefinement 追加指示に含まれるキーワードから改訂文を組み立てる
+// 「短く」は最初の一文のみ、「絵文字」を減らす・なくす指示は絵文字を除去する
+func offlineRefinement(baseText, instruction string) string {
+	text := strings.TrimSpace(baseText)
+
+	if strings.Contains(instruction, "短") {
+		if i := strings.IndexAny(text, "。！!？?"); i >= 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			text = text[:i+size]
+		}
+	}
+
+	if strings.Contains(instruction, "絵文字") &&
+		(strings.Contains(instruction, "なし") || strings.Contains(instruction, "無") ||
+			strings.Contains(instruction, "減") || strings.Contains(instruction, "少") ||
+			strings.Contains(instruction, "消") || strings.Contains(instruction, "削")) {
+		text = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if isEmoji(r) {
+				return -1
+			}
+			return r
+		}, text))
+	}
+
+	return text
+}
+
+// isEmoji 絵文字（主要な絵文字ブロック）かどうか
+func isEmoji(r rune) bool {
+	return r >= 0x1F300 && r <= 0x1FAFF
+}
+
+// firstEmoji テキスト中の最初の絵文字を取得（見つからない場合はfallback）
+func firstEmoji(text, fallback string) string {
+	for _, r := range text {
+		if isEmoji(r) {
+			return string(r)
+		}
+	}
+	return fallback
+}
+
+// offlineHarshnessAnalysis tone_prompts.yaml の harshness_analysis.rules の語句で分析結果のJSONを生成
+func offlineHarshnessAnalysis(originalText string) (string, error) {
+	var rules map[string][]string
+	if toneConfig, err := config.LoadToneConfig(); err == nil {
+		rules = toneConfig.HarshnessAnalysis.Rules
+	}
+
+	data, err := json.Marshal(models.NewRuleBasedAnalysis(rules, originalText))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// offlineExplanation 追加・削除された語句から変更ごとの理由のJSONを生成
+func offlineExplanation(originalText, variantText string) (string, error) {
+	var rules map[string][]string
+	if toneConfig, err := config.LoadToneConfig(); err == nil {
+		rules = toneConfig.HarshnessAnalysis.Rules
+	}
+
+	explanation := models.NewVariantDiff(originalText, variantText)
+	explanation.ApplyRuleReasons(rules)
+	data, err := json.Marshal(map[string]interface{}{"changes": explanation.Changes})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// offlineScheduleSuggestion メッセージ種別を判定して ScheduleSuggestionResponse のJSONを生成
+func offlineScheduleSuggestion(messageText string) (string, error) {
+	messageType := models.ClassifyMessageType(messageText)
+
+	suggestion := models.ScheduleSuggestionResponse{
+		MessageType:       messageType,
+		UrgencyLevel:      "中",
+		RecommendedTiming: "当日中",
+		Reasoning:         "緊急性の高くない連絡のため、相手の都合の良い時間帯での送信を推奨します。",
+	}
+	if scheduleConfig, err := config.LoadScheduleConfig(); err == nil {
+		if d, ok := scheduleConfig.DefaultSuggestions[messageType]; ok {
+			suggestion.UrgencyLevel = d.UrgencyLevel
+			suggestion.RecommendedTiming = d.RecommendedTiming
+			suggestion.Reasoning = d.Reasoning
+		}
+	}
+
+	options := []models.SuggestionOption{
+		{Option: "今すぐ送信", Priority: "選択肢", Reason: "すぐに内容を伝えられます", DelayMinutes: 0},
+		{Option: "1時間後", Priority: "選択肢", Reason: "少し時間を置いて落ち着いて送信できます", DelayMinutes: 60},
+		{Option: "明日朝9時", Priority: "選択肢", Reason: "相手が確認しやすい時間帯です", DelayMinutes: "next_business_day_9am"},
+	}
+	switch suggestion.RecommendedTiming {
+	case "今すぐ":
+		options[0].Priority = "最推奨"
+	case "1時間以内", "当日中":
+		options[1].Priority = "最推奨"
+	default:
+		options[2].Priority = "最推奨"
+	}
+	suggestion.SuggestedOptions = options
+
+	data, err := json.Marshal(suggestion)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
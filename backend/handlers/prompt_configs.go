@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/middleware"
+	"yanwari-message-backend/models"
+)
+
+// PromptConfigHandler プロンプト設定のバージョン管理ハンドラー（チューニング用）
+type PromptConfigHandler struct {
+	userService   *models.UserService
+	promptConfigs *models.PromptConfigService
+}
+
+// NewPromptConfigHandler プロンプト設定ハンドラーを作成
+func NewPromptConfigHandler(userService *models.UserService, promptConfigs *models.PromptConfigService) *PromptConfigHandler {
+	return &PromptConfigHandler{
+		userService:   userService,
+		promptConfigs: promptConfigs,
+	}
+}
+
+// CreatePromptConfigRequest バージョン作成リクエスト
+type CreatePromptConfigRequest struct {
+	Content  string `json:"content" binding:"required"` // tone_prompts.yaml 形式のYAML
+	Comment  string `json:"comment,omitempty"`
+	Activate bool   `json:"activate,omitempty"` // true の場合は作成後に有効化
+}
+
+// ListVersions バージョン一覧を取得
+// GET /api/v1/prompt-configs?limit=20
+func (h *PromptConfigHandler) ListVersions(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	versions, err := h.promptConfigs.ListVersions(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "バージョン一覧の取得に失敗しました"})
+		return
+	}
+
+	// このインスタンスで使われているバージョン（0 は設定ファイルを直接読み込んだ状態）
+	inUse := 0
+	if current := config.CurrentToneConfig(); current != nil {
+		inUse = current.Version
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"versions": versions,
+			"inUse":    inUse,
+		},
+	})
+}
+
+// GetVersion バージョンの内容と直前のバージョンとの差分を取得
+// ?against=N を指定した場合は v<N> との差分を返す
+// GET /api/v1/prompt-configs/:version
+func (h *PromptConfigHandler) GetVersion(c *gin.Context) {
+	number, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.promptConfigs.GetVersion(c.Request.Context(), number)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "バージョンが見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "バージョンの取得に失敗しました"})
+		return
+	}
+
+	if against := c.Query("against"); against != "" {
+		from, err := strconv.Atoi(against)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無効なバージョン番号です"})
+			return
+		}
+		diff, err := h.promptConfigs.DiffVersions(c.Request.Context(), from, number)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "比較対象のバージョンが見つかりません"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "差分の取得に失敗しました"})
+			return
+		}
+		version.Diff = diff
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": version,
+	})
+}
+
+// CreateVersion 新しいバージョンを作成
+// POST /api/v1/prompt-configs
+func (h *PromptConfigHandler) CreateVersion(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req CreatePromptConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	author := models.NewPromptConfigAuthor(currentUser)
+	version, err := h.promptConfigs.CreateVersion(c.Request.Context(), req.Content, author, req.Comment)
+	if err == models.ErrPromptConfigUnchanged {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "data": version})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "設定を保存できませんでした", "details": err.Error()})
+		return
+	}
+
+	message := "バージョンを作成しました"
+	if req.Activate {
+		if version, err = h.promptConfigs.ActivateVersion(c.Request.Context(), version.Version, author); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "バージョンの有効化に失敗しました"})
+			return
+		}
+		message = "バージョンを作成して有効化しました"
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":    version,
+		"message": message,
+	})
+}
+
+// ActivateVersion 指定したバージョンを有効化
+// POST /api/v1/prompt-configs/:version/activate
+func (h *PromptConfigHandler) ActivateVersion(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	number, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.promptConfigs.ActivateVersion(c.Request.Context(), number, models.NewPromptConfigAuthor(currentUser))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "バージョンが見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "バージョンの有効化に失敗しました", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    version,
+		"message": "バージョンを有効化しました",
+	})
+}
+
+// RollbackVersion 有効なバージョンの1つ前のバージョンに戻す
+// POST /api/v1/prompt-configs/rollback
+func (h *PromptConfigHandler) RollbackVersion(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, err := h.promptConfigs.RollbackVersion(c.Request.Context(), models.NewPromptConfigAuthor(currentUser))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ロールバック先のバージョンがありません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ロールバックに失敗しました", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    version,
+		"message": "1つ前のバージョンに戻しました",
+	})
+}
+
+// RegisterRoutes プロンプト設定関連のルートを登録
+// 全ユーザーの変換に使われる設定を変更するため、管理者のみ利用できる
+func (h *PromptConfigHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	promptConfigs := router.Group("/prompt-configs")
+	promptConfigs.Use(firebaseMiddleware, middleware.RequireAdmin())
+	{
+		promptConfigs.GET("", h.ListVersions)
+		promptConfigs.POST("", h.CreateVersion)
+		promptConfigs.POST("/rollback", h.RollbackVersion)
+		promptConfigs.GET("/:version", h.GetVersion)
+		promptConfigs.POST("/:version/activate", h.ActivateVersion)
+	}
+}
+
+// parseVersionParam パスパラメータのバージョン番号を取得（不正な場合は400を返す）
+func parseVersionParam(c *gin.Context) (int, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なバージョン番号です"})
+		return 0, false
+	}
+	return number, true
+}
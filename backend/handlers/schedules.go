@@ -1,55 +1,36 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"yanwari-message-backend/config"
 	"yanwari-message-backend/models"
 	"yanwari-message-backend/services"
+	"yanwari-message-backend/services/llm"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Anthropic API用の構造体（schedules.go専用）
-type ScheduleAnthropicRequest struct {
-	Model     string               `json:"model"`
-	MaxTokens int                  `json:"max_tokens"`
-	Messages  []ScheduleMessage    `json:"messages"`
-}
-
-type ScheduleMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type ScheduleAnthropicResponse struct {
-	Content []ScheduleContent `json:"content"`
-}
-
-type ScheduleContent struct {
-	Text string `json:"text"`
-	Type string `json:"type"`
-}
-
 // ScheduleHandler スケジュール関連のハンドラー
 type ScheduleHandler struct {
 	scheduleService  *models.ScheduleService
 	messageService   *models.MessageService
 	deliveryService  *services.DeliveryService
-	anthropicAPIKey  string
+	llmProvider      llm.Provider
+	usageService     *models.AIUsageService
+	settingsService  *models.UserSettingsService
 	scheduleConfig   *config.ScheduleConfig
+	guard            *harshnessGuard
 }
 
 // NewScheduleHandler スケジュールハンドラーのコンストラクタ
-func NewScheduleHandler(scheduleService *models.ScheduleService, messageService *models.MessageService, deliveryService *services.DeliveryService) *ScheduleHandler {
+func NewScheduleHandler(scheduleService *models.ScheduleService, messageService *models.MessageService, deliveryService *services.DeliveryService, llmProvider llm.Provider, usageService *models.AIUsageService, settingsService *models.UserSettingsService) *ScheduleHandler {
 	// スケジュール設定を読み込み
 	scheduleConfig, err := config.LoadScheduleConfig()
 	if err != nil {
@@ -61,8 +42,11 @@ func NewScheduleHandler(scheduleService *models.ScheduleService, messageService
 		scheduleService: scheduleService,
 		messageService:  messageService,
 		deliveryService: deliveryService,
-		anthropicAPIKey: os.Getenv("ANTHROPIC_API_KEY"),
+		llmProvider:     llmProvider,
+		usageService:    usageService,
+		settingsService: settingsService,
 		scheduleConfig:  scheduleConfig,
+		guard:           newHarshnessGuard(messageService, llmProvider, usageService),
 	}
 }
 
@@ -90,12 +74,17 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 	}
 
 	// メッセージへのアクセス権を確認
-	_, err = h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
 		return
 	}
 
+	// 送信するテキストがまだ強く伝わる場合は、確認（confirmHarsh）があるまで送信しない
+	if !h.guard.allow(c, currentUser, message, req.FinalText, req.ConfirmHarsh) {
+		return
+	}
+
 	// 送信時刻が現在より未来であることを確認
 	// UTC時刻で統一して比較
 	now := time.Now().UTC()
@@ -228,6 +217,23 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 		return
 	}
 
+	// 送信時刻を変更・送信予約を再開する場合は、作成時と同じく送信するテキストの強さを確認する
+	if req.ScheduledAt != nil || req.Status == "pending" {
+		schedule, err := h.scheduleService.GetSchedule(c.Request.Context(), scheduleID, currentUserID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "スケジュールが見つかりません"})
+			return
+		}
+		message, err := h.messageService.GetMessage(c.Request.Context(), schedule.MessageID, currentUserID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+			return
+		}
+		if !h.guard.allow(c, currentUser, message, "", req.ConfirmHarsh) {
+			return
+		}
+	}
+
 	// 送信時刻チェック（過去時刻の場合は即座に送信）
 	var isPastSchedule bool
 	if req.ScheduledAt != nil {
@@ -277,6 +283,7 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 }
 
 // SyncScheduleStatus スケジュールとメッセージのステータス同期
+// 配信後のスケジュールは outbox イベントから同期されるため、outbox 導入前にずれたデータの修復用
 // POST /api/v1/schedules/sync-status
 func (h *ScheduleHandler) SyncScheduleStatus(c *gin.Context) {
 	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
@@ -355,9 +362,9 @@ func (h *ScheduleHandler) SuggestSchedule(c *gin.Context) {
 		return
 	}
 
-	// APIキーの確認
-	if h.anthropicAPIKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Anthropic APIキーが設定されていません"})
+	// LLMプロバイダーの確認
+	if h.llmProvider == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AIプロバイダーが設定されていません"})
 		return
 	}
 
@@ -369,14 +376,24 @@ func (h *ScheduleHandler) SuggestSchedule(c *gin.Context) {
 	}
 
 	// メッセージへのアクセス権を確認
-	_, err = h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
 		return
 	}
 
+	// AI利用上限の確認
+	if !checkAIQuota(c, h.usageService, currentUser, 1) {
+		return
+	}
+
 	// AI分析を実行
-	suggestion, err := h.callAnthropicScheduleAPI(c.Request.Context(), req.MessageText, req.SelectedTone)
+	recipient := h.recipientScheduleProfile(c.Request.Context(), message.RecipientID)
+	suggestion, err := h.requestScheduleSuggestion(c.Request.Context(), currentUser, recipient, messageID, req.MessageText, req.SelectedTone)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI分析に失敗しました", "details": err.Error()})
 		return
@@ -388,89 +405,108 @@ func (h *ScheduleHandler) SuggestSchedule(c *gin.Context) {
 	})
 }
 
-// callAnthropicScheduleAPI Anthropic Claude APIを呼び出してスケジュール提案を取得
-func (h *ScheduleHandler) callAnthropicScheduleAPI(ctx context.Context, messageText, selectedTone string) (*models.ScheduleSuggestionResponse, error) {
+// recipientScheduleProfile 時間提案に使う受信者の情報（タイムゾーン・時間制限・既読時刻の分布）を取得
+// 受信者が未設定の場合は nil。取得できなかった情報は使わずに続行する
+func (h *ScheduleHandler) recipientScheduleProfile(ctx context.Context, recipientID primitive.ObjectID) *models.RecipientScheduleProfile {
+	if recipientID.IsZero() {
+		return nil
+	}
+
+	recipient, err := h.messageService.GetUserService().GetUserByID(ctx, recipientID.Hex())
+	if err != nil {
+		fmt.Printf("[Schedule] 受信者の取得に失敗したため受信者を考慮せずに提案します: %v\n", err)
+		return nil
+	}
+	profile := &models.RecipientScheduleProfile{Location: userLocation(recipient), TimeRestriction: "none"}
+
+	if h.settingsService != nil {
+		if restriction, err := h.settingsService.GetTimeRestriction(ctx, recipientID); err != nil {
+			fmt.Printf("[Schedule] 受信者の時間制限の取得に失敗しました: %v\n", err)
+		} else {
+			profile.TimeRestriction = restriction
+		}
+	}
+
+	if hours, samples, err := h.messageService.GetReadHourHistogram(ctx, recipientID, profile.Location); err != nil {
+		fmt.Printf("[Schedule] 受信者の既読時刻の集計に失敗しました: %v\n", err)
+	} else {
+		profile.ReadHours, profile.ReadSamples = hours, samples
+	}
+
+	return profile
+}
+
+// requestScheduleSuggestion LLMプロバイダーを呼び出してスケジュール提案を取得
+// 送信日時は送信者のタイムゾーンで解決する。応答が使えない場合は schedule_prompts.yaml のルールで提案する
+// recipient が指定された場合は、受信者の時間帯に合わない選択肢の送信日時を調整する
+func (h *ScheduleHandler) requestScheduleSuggestion(ctx context.Context, user *models.User, recipient *models.RecipientScheduleProfile, messageID primitive.ObjectID, messageText, selectedTone string) (*models.ScheduleSuggestionResponse, error) {
 	var prompt string
 	var modelConfig config.AIModelConfig
+	now, loc := time.Now(), userLocation(user)
+
+	recipientContext := ""
+	if recipient != nil {
+		recipientContext = recipient.PromptContext(now)
+	}
 
 	// 設定ファイルからプロンプトを生成
 	if h.scheduleConfig != nil {
 		var err error
-		prompt, err = h.scheduleConfig.GetSchedulePrompt(messageText, selectedTone)
+		prompt, err = h.scheduleConfig.GetSchedulePromptAt(messageText, selectedTone, now.In(loc), recipientContext)
 		if err != nil {
 			return nil, fmt.Errorf("プロンプト生成エラー: %w", err)
 		}
 		modelConfig = h.scheduleConfig.GetScheduleAIModelConfig()
 	} else {
 		// フォールバック: デフォルトプロンプト
-		prompt, modelConfig = h.getDefaultSchedulePrompt(messageText, selectedTone)
-	}
-
-	// リクエストボディを作成
-	requestBody := ScheduleAnthropicRequest{
-		Model:     modelConfig.Name,
-		MaxTokens: modelConfig.MaxTokens,
-		Messages: []ScheduleMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+		prompt, modelConfig = h.getDefaultSchedulePrompt(messageText, selectedTone, now.In(loc), recipientContext)
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
-	}
+	llmReq := llm.NewUserRequest(modelConfig.Name, modelConfig.MaxTokens, prompt)
+	llmReq.ResponseFormat = llm.ResponseFormat{Type: llm.ResponseFormatJSON, Schema: models.ScheduleSuggestionSchema}
+	llmReq.Metadata["label"] = "schedule"
+	llmReq.Metadata["task"] = llm.TaskScheduleSuggest
+	llmReq.Metadata["selected_tone"] = selectedTone
+	llmReq.Metadata["message_text"] = messageText
 
-	// HTTP リクエストを作成
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	resp, err := h.llmProvider.Complete(ctx, llmReq)
 	if err != nil {
-		return nil, fmt.Errorf("HTTPリクエストの作成に失敗: %w", err)
+		return nil, err
 	}
+	recordAIUsage(ctx, h.usageService, h.llmProvider, user.ID, messageID, models.AIFeatureScheduleSuggest, llmReq, resp)
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", h.anthropicAPIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	// HTTPクライアントでリクエストを送信（30秒タイムアウト）
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
+	// 応答からJSONを取り出して（説明文・コードフェンス・途中終了を修復）スキーマを検証
+	suggestion, err := parseScheduleSuggestion(resp.Text, now, loc)
 	if err != nil {
-		return nil, fmt.Errorf("API呼び出しに失敗: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Anthropic API エラー: status %d", resp.StatusCode)
+		fmt.Printf("[Schedule] AI応答を利用できないためルールベースの提案に切り替えます: %v\n", err)
+		suggestion = models.NewRuleBasedScheduleSuggestion(h.scheduleConfig, messageText, now, loc)
+		suggestion.Notes = append(suggestion.Notes, "AI応答を利用できなかったため、ルールに基づいて提案しました")
 	}
-
-	// レスポンスをパース
-	var apiResponse ScheduleAnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-		return nil, fmt.Errorf("レスポンスの解析に失敗: %w", err)
+	if recipient != nil {
+		suggestion.ApplyRecipientProfile(recipient, now)
 	}
 
-	if len(apiResponse.Content) == 0 {
-		return nil, fmt.Errorf("空のレスポンスが返されました")
-	}
+	return suggestion, nil
+}
 
-	// JSON文字列をパース
-	var suggestion models.ScheduleSuggestionResponse
-	if err := json.Unmarshal([]byte(apiResponse.Content[0].Text), &suggestion); err != nil {
-		return nil, fmt.Errorf("AI応答の解析に失敗: %w", err)
+// parseScheduleSuggestion モデルの応答テキストから時間提案を取り出す
+func parseScheduleSuggestion(text string, now time.Time, loc *time.Location) (*models.ScheduleSuggestionResponse, error) {
+	data, err := llm.ExtractJSON(text)
+	if err != nil {
+		return nil, err
 	}
-
-	return &suggestion, nil
+	return models.ParseScheduleSuggestion(data, now, loc)
 }
 
 // getDefaultSchedulePrompt フォールバック用デフォルトプロンプト
-func (h *ScheduleHandler) getDefaultSchedulePrompt(messageText, selectedTone string) (string, config.AIModelConfig) {
-	now := time.Now()
+// now は送信者のタイムゾーンの現在時刻
+func (h *ScheduleHandler) getDefaultSchedulePrompt(messageText, selectedTone string, now time.Time, recipientContext string) (string, config.AIModelConfig) {
 	currentTime := now.Format("2006-01-02 15:04:05")
 	dayOfWeek := getDayOfWeekInJapanese(now.Weekday())
+	recipientSection := ""
+	if recipientContext != "" {
+		recipientSection = "\n" + recipientContext + "\n受信者の受信可能な時間帯・読まない時間帯に当たる送信時刻は提案しないでください。\n"
+	}
 
 	prompt := fmt.Sprintf(`あなたは日本のビジネスコミュニケーション専門家です。
 以下のメッセージを分析し、最適な送信タイミングを提案してください。
@@ -479,7 +515,7 @@ func (h *ScheduleHandler) getDefaultSchedulePrompt(messageText, selectedTone str
 選択されたトーン: %s
 現在時刻: %s
 曜日: %s
-
+%s
 必ず以下のJSON形式で回答してください：
 {
   "message_type": "謝罪|お礼|依頼|報告|相談|確認|連絡|その他",
@@ -494,7 +530,7 @@ func (h *ScheduleHandler) getDefaultSchedulePrompt(messageText, selectedTone str
       "delay_minutes": 0
     }
   ]
-}`, messageText, selectedTone, currentTime, dayOfWeek)
+}`, messageText, selectedTone, currentTime, dayOfWeek, recipientSection)
 
 	defaultConfig := config.AIModelConfig{
 		Name:      "claude-3-5-sonnet-20241022",
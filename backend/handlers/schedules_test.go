@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestRequestScheduleSuggestionWithOfflineProvider LLM_PROVIDER=fake の応答から時間提案を組み立てる
+func TestRequestScheduleSuggestionWithOfflineProvider(t *testing.T) {
+	provider := llm.NewFakeProvider(OfflineResponder)
+	h := NewScheduleHandler(nil, nil, nil, provider, nil, nil)
+	user := &models.User{ID: primitive.NewObjectID(), Timezone: "Asia/Tokyo"}
+
+	start := time.Now()
+	suggestion, err := h.requestScheduleSuggestion(context.Background(), user, nil, primitive.NewObjectID(), "資料を送っていただけますか", "gentle")
+	if err != nil {
+		t.Fatalf("requestScheduleSuggestion error: %v", err)
+	}
+	if suggestion.Source != models.SuggestionSourceAI || suggestion.MessageType != "依頼" {
+		t.Errorf("Source = %q, MessageType = %q, want %s, 依頼", suggestion.Source, suggestion.MessageType, models.SuggestionSourceAI)
+	}
+	assertResolvedOptions(t, suggestion, start)
+
+	requests := provider.Requests()
+	if len(requests) != 1 || requests[0].Metadata["task"] != llm.TaskScheduleSuggest || requests[0].ResponseFormat.Type != llm.ResponseFormatJSON {
+		t.Errorf("requests = %+v, want one JSON schedule suggestion request", requests)
+	}
+}
+
+// TestRequestScheduleSuggestionFallsBackToRules 使えない応答はルールベースの提案に切り替える
+func TestRequestScheduleSuggestionFallsBackToRules(t *testing.T) {
+	responses := map[string]string{
+		"JSONなし":            "申し訳ありませんが、提案できません",
+		"スキーマ不一致":           `{"message_type": "依頼", "urgency_level": "最高", "suggested_options": []}`,
+		"delay_minutes が無限": `{"message_type": "依頼", "urgency_level": "中", "recommended_timing": "当日中", "reasoning": "r", "suggested_options": [{"option": "いつか", "priority": "最推奨", "reason": "r", "delay_minutes": "Infinity"}]}`,
+	}
+
+	for name, response := range responses {
+		t.Run(name, func(t *testing.T) {
+			provider := llm.NewFakeProvider(func(ctx context.Context, req *llm.Request) (string, error) {
+				return response, nil
+			})
+			h := NewScheduleHandler(nil, nil, nil, provider, nil, nil)
+			user := &models.User{ID: primitive.NewObjectID(), Timezone: "Asia/Tokyo"}
+
+			start := time.Now()
+			suggestion, err := h.requestScheduleSuggestion(context.Background(), user, nil, primitive.NewObjectID(), "資料を送っていただけますか", "gentle")
+			if err != nil {
+				t.Fatalf("requestScheduleSuggestion error: %v", err)
+			}
+			if suggestion.Source != models.SuggestionSourceRules || len(suggestion.Notes) == 0 {
+				t.Errorf("Source = %q, Notes = %v, want rule-based suggestion with a note", suggestion.Source, suggestion.Notes)
+			}
+			assertResolvedOptions(t, suggestion, start)
+		})
+	}
+}
+
+// assertResolvedOptions 全ての選択肢の送信日時が解決され、「最推奨」がちょうど1つあるか
+func assertResolvedOptions(t *testing.T, suggestion *models.ScheduleSuggestionResponse, now time.Time) {
+	t.Helper()
+	if len(suggestion.SuggestedOptions) == 0 {
+		t.Fatal("SuggestedOptions is empty")
+	}
+	recommended := 0
+	for _, option := range suggestion.SuggestedOptions {
+		if option.ScheduledAt == nil || option.ScheduledAt.Before(now.Add(-time.Second)) {
+			t.Errorf("option %q ScheduledAt = %v, want resolved time not before now", option.Option, option.ScheduledAt)
+		}
+		if option.Priority == "最推奨" {
+			recommended++
+		}
+	}
+	if recommended != 1 {
+		t.Errorf("最推奨 options = %d, want 1", recommended)
+	}
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 
 	"yanwari-message-backend/models"
+	"yanwari-message-backend/services"
 )
 
 
@@ -52,11 +54,14 @@ func (h *SettingsHandler) GetSettings(c *gin.Context) {
 			"id":    userInfo.ID,
 			"name":  userInfo.Name,
 			"email": userInfo.Email,
+			// 受け取るときの希望言語（未設定の場合は空）
+			"preferredLanguage": userInfo.PreferredLanguage,
 		},
 		"notifications": gin.H{
 			"emailNotifications":   settings.EmailNotifications,
 			"sendNotifications":    settings.SendNotifications,
 			"browserNotifications": settings.BrowserNotifications,
+			"webhookUrl":           settings.WebhookURL,
 		},
 		"messages": gin.H{
 			"defaultTone":     settings.DefaultTone,
@@ -103,6 +108,15 @@ func (h *SettingsHandler) UpdateProfile(c *gin.Context) {
 		}
 	}
 
+	// 希望言語が提供されている場合は更新
+	if req.PreferredLanguage != "" {
+		err := h.userService.UpdatePreferredLanguage(c.Request.Context(), userID, req.PreferredLanguage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "希望言語の更新に失敗しました"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "プロフィールを更新しました",
@@ -173,6 +187,18 @@ func (h *SettingsHandler) UpdateNotificationSettings(c *gin.Context) {
 		return
 	}
 
+	// Webhook の転送先は http(s) の絶対URLで、内部ネットワークのアドレスではないこと
+	if req.WebhookURL != nil && *req.WebhookURL != "" {
+		if err := services.ValidateWebhookURL(c.Request.Context(), *req.WebhookURL); err != nil {
+			message := "無効なWebhook URLです"
+			if errors.Is(err, services.ErrWebhookAddressNotAllowed) {
+				message = err.Error()
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	}
+
 	// 通知設定を更新
 	err = h.userSettingsService.UpdateNotificationSettings(c.Request.Context(), userID, &req)
 	if err != nil {
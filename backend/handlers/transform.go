@@ -1,18 +1,19 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"yanwari-message-backend/config"
+	"yanwari-message-backend/middleware"
 	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/language"
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/toneoutput"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,13 +22,19 @@ import (
 
 // TransformHandler AIトーン変換ハンドラー
 type TransformHandler struct {
-	messageService  *models.MessageService
-	anthropicAPIKey string
-	toneConfig      *config.ToneConfig
+	messageService    *models.MessageService
+	llmProvider       llm.Provider
+	transformCache    *models.TransformCacheService
+	usageService      *models.AIUsageService
+	customToneService *models.CustomToneService
+	promptConfigs     *models.PromptConfigService
+	experiments       *models.ExperimentService
+	friendships       *models.FriendshipService
+	guard             *harshnessGuard // 送信予約済みのメッセージの改訂を選択する際の強さの確認
 }
 
 // NewTransformHandler トーン変換ハンドラーを作成
-func NewTransformHandler(messageService *models.MessageService) *TransformHandler {
+func NewTransformHandler(messageService *models.MessageService, llmProvider llm.Provider, transformCache *models.TransformCacheService, usageService *models.AIUsageService, customToneService *models.CustomToneService, promptConfigs *models.PromptConfigService, experiments *models.ExperimentService, friendships *models.FriendshipService) *TransformHandler {
 	fmt.Println("[TransformHandler] 初期化開始...")
 	
 	// トーン設定を読み込み
@@ -36,69 +43,142 @@ func NewTransformHandler(messageService *models.MessageService) *TransformHandle
 		// 詳細なエラーログ出力
 		fmt.Printf("❌ [TransformHandler] トーン設定の読み込みに失敗: %v\n", err)
 		fmt.Printf("❌ [TransformHandler] フォールバックモード（デフォルトプロンプト）で動作します\n")
-		toneConfig = nil
 	} else {
 		fmt.Printf("✅ [TransformHandler] トーン設定の読み込み成功\n")
 	}
 
-	// Anthropic API キーの確認
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		fmt.Printf("⚠️ [TransformHandler] ANTHROPIC_API_KEY環境変数が設定されていません\n")
+	// LLMプロバイダーの確認
+	if llmProvider == nil {
+		fmt.Printf("⚠️ [TransformHandler] LLMプロバイダーが設定されていません\n")
 	} else {
-		fmt.Printf("✅ [TransformHandler] ANTHROPIC_API_KEY設定確認済み\n")
+		fmt.Printf("✅ [TransformHandler] LLMプロバイダー: %s\n", llmProvider.Name())
 	}
 
 	handler := &TransformHandler{
-		messageService:  messageService,
-		anthropicAPIKey: apiKey,
-		toneConfig:      toneConfig,
+		messageService:    messageService,
+		llmProvider:       llmProvider,
+		transformCache:    transformCache,
+		usageService:      usageService,
+		customToneService: customToneService,
+		promptConfigs:     promptConfigs,
+		experiments:       experiments,
+		friendships:       friendships,
+		guard:             newHarshnessGuard(messageService, llmProvider, usageService),
 	}
 	
 	fmt.Printf("✅ [TransformHandler] 初期化完了（YAMLファイル使用: %t）\n", toneConfig != nil)
 	return handler
 }
 
+// toneConfig 有効なトーン設定を取得（読み込めていない場合は nil）
+// 設定は実行中に差し替えられるため、1回の処理の中では取得した値を使い続けること
+func (h *TransformHandler) toneConfig() *config.ToneConfig {
+	return config.CurrentToneConfig()
+}
+
 // ToneTransformRequest トーン変換リクエスト
 type ToneTransformRequest struct {
-	MessageID    string `json:"messageId" binding:"required"`
-	OriginalText string `json:"originalText" binding:"required"`
+	MessageID    string `json:"messageId" form:"messageId" binding:"required"`
+	OriginalText string `json:"originalText" form:"originalText" binding:"required"`
+	Force        bool   `json:"force" form:"force"` // true の場合キャッシュを使わず再生成
+	// Tones 変換するトーン（グローバルトーン名・カスタムトーンのキー）、省略時は設定ファイルの全トーン
+	Tones []string `json:"tones,omitempty" form:"tones"`
+	// Translate true の場合、受信者の希望言語に翻訳して変換する（希望言語が未設定の場合は元のメッセージの言語）
+	Translate bool `json:"translate,omitempty" form:"translate"`
 }
 
-// ToneVariation トーン変換結果
-type ToneVariation struct {
-	Tone string `json:"tone"`
-	Text string `json:"text"`
+// ToneVariation トーン変換結果（メッセージに保存される形式と同じ）
+type ToneVariation = models.ToneVariant
+
+// ToneResultStatus トーン単位の変換結果ステータス
+type ToneResultStatus string
+
+const (
+	ToneResultSuccess ToneResultStatus = "success" // 変換成功
+	ToneResultFailed  ToneResultStatus = "failed"  // 変換失敗（再試行可能）
+)
+
+// ToneResult トーン単位の変換結果
+type ToneResult struct {
+	Tone          string           `json:"tone"`
+	Status        ToneResultStatus `json:"status"`
+	Text          string           `json:"text,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	DisplayName   string           `json:"displayName,omitempty"`
+	Model         string           `json:"model,omitempty"`
+	PromptVersion string           `json:"promptVersion,omitempty"`
+	Language      string           `json:"language,omitempty"`
+	GeneratedAt   *time.Time       `json:"generatedAt,omitempty"`
+
+	Experiment *models.ExperimentAssignment `json:"experiment,omitempty"`
+	// Flagged 再生成しても制約を満たせなかった変換結果（Violations に違反内容）
+	Flagged    bool     `json:"flagged,omitempty"`
+	Violations []string `json:"violations,omitempty"`
 }
 
-// ToneTransformResponse トーン変換レスポンス
-type ToneTransformResponse struct {
-	MessageID  string          `json:"messageId"`
-	Variations []ToneVariation `json:"variations"`
+// newToneSuccess 変換結果から成功のトーン結果を作成
+func newToneSuccess(variant ToneVariation) ToneResult {
+	generatedAt := variant.GeneratedAt
+	return ToneResult{
+		Tone:          variant.Tone,
+		Status:        ToneResultSuccess,
+		Text:          variant.Text,
+		DisplayName:   variant.DisplayName,
+		Model:         variant.Model,
+		PromptVersion: variant.PromptVersion,
+		Language:      variant.Language,
+		GeneratedAt:   &generatedAt,
+		Experiment:    variant.Experiment,
+		Flagged:       variant.Flagged(),
+		Violations:    variant.Violations,
+	}
 }
 
-// AnthropicRequest Anthropic API リクエスト構造
-type AnthropicRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	Messages  []Message `json:"messages"`
+// variant 成功したトーン結果を保存用の変換結果に戻す
+func (r ToneResult) variant() ToneVariation {
+	variant := ToneVariation{
+		Tone:          r.Tone,
+		DisplayName:   r.DisplayName,
+		Text:          r.Text,
+		Model:         r.Model,
+		PromptVersion: r.PromptVersion,
+		Language:      r.Language,
+		Experiment:    r.Experiment,
+		Violations:    r.Violations,
+	}
+	if r.GeneratedAt != nil {
+		variant.GeneratedAt = *r.GeneratedAt
+	}
+	return variant
 }
 
-// Message Anthropic APIメッセージ構造
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// ToneTransformResponse トーン変換レスポンス
+type ToneTransformResponse struct {
+	MessageID   string          `json:"messageId"`
+	Variations  []ToneVariation `json:"variations"` // 成功したトーンのみ
+	Results     []ToneResult    `json:"results"`
+	FailedTones []string        `json:"failedTones"`
+	Partial     bool            `json:"partial"`
 }
 
-// AnthropicResponse Anthropic API レスポンス構造
-type AnthropicResponse struct {
-	Content []Content `json:"content"`
+// ToneRetryRequest 失敗トーン再試行リクエスト
+type ToneRetryRequest struct {
+	MessageID    string   `json:"messageId" binding:"required"`
+	OriginalText string   `json:"originalText,omitempty"` // 省略時はメッセージの originalText
+	Tones        []string `json:"tones,omitempty"`        // 省略時は前回失敗したトーン
+	Translate    bool     `json:"translate,omitempty"`    // true の場合、受信者の希望言語に翻訳して変換する
 }
 
-// Content Anthropic APIコンテンツ構造
-type Content struct {
-	Text string `json:"text"`
-	Type string `json:"type"`
+// toneJob トーン変換1回分の共通パラメータ
+type toneJob struct {
+	userID         primitive.ObjectID
+	messageID      primitive.ObjectID
+	originalText   string
+	force          bool                   // true の場合キャッシュを使わず再生成
+	customTones    map[string]config.Tone // 変換対象に含まれるユーザー定義トーン
+	relationship   *config.Relationship   // 送信者が登録した受信者との関係（未登録の場合は nil）
+	language       string                 // 元のメッセージの言語（ja, en, zh, ko）
+	outputLanguage string                 // 変換結果の言語（翻訳しない場合は language と同じ）
 }
 
 // TransformToTones メッセージを3つのトーンに変換
@@ -117,9 +197,9 @@ func (h *TransformHandler) TransformToTones(c *gin.Context) {
 		return
 	}
 
-	// APIキーの確認
-	if h.anthropicAPIKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Anthropic APIキーが設定されていません"})
+	// LLMプロバイダーの確認
+	if h.llmProvider == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AIプロバイダーが設定されていません"})
 		return
 	}
 
@@ -131,224 +211,606 @@ func (h *TransformHandler) TransformToTones(c *gin.Context) {
 	}
 
 	// メッセージへのアクセス権を確認
-	_, err = h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
 		return
 	}
 
-	// 設定ファイルから利用可能なトーンを取得
-	var availableTones []string
-	if h.toneConfig != nil {
-		fmt.Printf("[Transform] YAML設定ファイルからトーン一覧を取得中...\n")
-		for toneName := range h.toneConfig.Tones {
-			availableTones = append(availableTones, toneName)
-			fmt.Printf("[Transform] - YAML設定トーン: %s\n", toneName)
-		}
-		fmt.Printf("✅ [Transform] YAML設定ファイル使用: %d個のトーン\n", len(availableTones))
-	} else {
-		// フォールバック: デフォルトトーン
-		availableTones = []string{"gentle", "constructive", "casual"}
-		fmt.Printf("⚠️ [Transform] フォールバックモード: デフォルトプロンプトを使用\n")
+	// 変換対象のトーンを決定（指定がなければ設定ファイルの全トーン）
+	tones, customTones, err := h.resolveTones(c.Request.Context(), currentUserID, req.Tones)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// AI利用上限の確認（トーン数分の呼び出しを予定）
+	if !checkAIQuota(c, h.usageService, currentUser, len(tones)) {
+		return
+	}
+
+	// 並行変換処理（トーン単位で成功・失敗を記録）
+	job := toneJob{userID: currentUserID, messageID: messageID, originalText: req.OriginalText, force: req.Force, customTones: customTones}
+	job.relationship = h.recipientRelationship(c.Request.Context(), currentUserID, message.RecipientID)
+	job.language, job.outputLanguage = h.toneLanguages(c.Request.Context(), req.OriginalText, message.RecipientID, req.Translate)
+	results := h.transformTones(c.Request.Context(), job, tones)
+
+	// 成功したトーンのみデータベースに保存（失敗したトーンは再試行用に記録）
+	if err := h.saveToneResults(c.Request.Context(), messageID, currentUserID, results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トーン変換結果の保存に失敗しました"})
+		return
+	}
+
+	h.respondToneResults(c, req.MessageID, results)
+}
+
+// RetryFailedTones 失敗したトーンのみ再変換
+// POST /api/v1/transform/tones/retry
+func (h *TransformHandler) RetryFailedTones(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	currentUserID := currentUser.ID
+
+	var req ToneRetryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	// LLMプロバイダーの確認
+	if h.llmProvider == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AIプロバイダーが設定されていません"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+		return
 	}
 
-	// 並行変換処理（詳細ログ付き）
-	variations := make([]ToneVariation, len(availableTones))
+	// 再試行対象: 指定があればそのトーン、なければ前回失敗したトーン
+	tones := req.Tones
+	if len(tones) == 0 {
+		tones = message.FailedTones
+	}
+	if len(tones) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "再試行が必要なトーンはありません"})
+		return
+	}
+
+	originalText := req.OriginalText
+	if originalText == "" {
+		originalText = message.OriginalText
+	}
+
+	tones, customTones, err := h.resolveTones(c.Request.Context(), currentUserID, tones)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAIQuota(c, h.usageService, currentUser, len(tones)) {
+		return
+	}
+
+	fmt.Printf("[TransformRetry] 失敗トーンを再試行: %v\n", tones)
+	job := toneJob{userID: currentUserID, messageID: messageID, originalText: originalText, force: true, customTones: customTones}
+	job.relationship = h.recipientRelationship(c.Request.Context(), currentUserID, message.RecipientID)
+	job.language, job.outputLanguage = h.toneLanguages(c.Request.Context(), originalText, message.RecipientID, req.Translate)
+	results := h.transformTones(c.Request.Context(), job, tones)
+
+	if err := h.saveToneResults(c.Request.Context(), messageID, currentUserID, results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トーン変換結果の保存に失敗しました"})
+		return
+	}
+
+	h.respondToneResults(c, req.MessageID, results)
+}
+
+// transformTones 指定されたトーンを並行して変換し、トーン単位の結果を返す
+func (h *TransformHandler) transformTones(ctx context.Context, job toneJob, tones []string) []ToneResult {
+	results := make([]ToneResult, len(tones))
 	var wg sync.WaitGroup
-	var mu sync.Mutex
-	errors := make([]error, 0)
-	
-	fmt.Printf("=== トーン変換開始: %d個のトーンを並行処理 ===\n", len(availableTones))
 
-	for i, tone := range availableTones {
+	fmt.Printf("=== トーン変換開始: %d個のトーンを並行処理 ===\n", len(tones))
+
+	for i, tone := range tones {
 		wg.Add(1)
 		go func(index int, toneType string) {
 			defer wg.Done()
-			
+
 			fmt.Printf("[%s] API呼び出し開始\n", toneType)
 			startTime := time.Now()
 
-			transformedText, err := h.callAnthropicAPI(c.Request.Context(), req.OriginalText, toneType)
-			
+			variant, err := h.generateToneVariation(ctx, job, toneType)
+
 			duration := time.Since(startTime)
 			fmt.Printf("[%s] API呼び出し完了 (所要時間: %v)\n", toneType, duration)
-			
-			mu.Lock()
+
 			if err != nil {
 				fmt.Printf("[%s] エラー: %v\n", toneType, err)
-				errors = append(errors, fmt.Errorf("%sトーンの変換に失敗: %w", toneType, err))
-			} else {
-				fmt.Printf("[%s] 成功: %d文字の変換結果\n", toneType, len(transformedText))
-				variations[index] = ToneVariation{
-					Tone: toneType,
-					Text: transformedText,
+				results[index] = ToneResult{
+					Tone:   toneType,
+					Status: ToneResultFailed,
+					Error:  fmt.Sprintf("%sトーンの変換に失敗: %v", toneType, err),
 				}
+				return
 			}
-			mu.Unlock()
+
+			fmt.Printf("[%s] 成功: %d文字の変換結果\n", toneType, len(variant.Text))
+			results[index] = newToneSuccess(variant)
 		}(i, tone)
 	}
 
 	wg.Wait()
-	fmt.Printf("=== 並行処理完了: %d個のエラー ===\n", len(errors))
+	fmt.Printf("=== 並行処理完了: %d個のエラー ===\n", len(failedTones(results)))
 
-	// エラーチェック
-	if len(errors) > 0 {
-		// 最初のエラーを返す
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errors[0].Error()})
-		return
+	return results
+}
+
+// respondToneResults トーン単位の結果からレスポンスを返す
+// 全トーン成功: 200 / 一部失敗: 200（partial） / 全トーン失敗: 500
+func (h *TransformHandler) respondToneResults(c *gin.Context, messageID string, results []ToneResult) {
+	response := newToneTransformResponse(messageID, results)
+
+	switch {
+	case len(response.FailedTones) == 0:
+		c.JSON(http.StatusOK, gin.H{
+			"data":    response,
+			"message": "トーン変換が完了しました",
+		})
+	case len(response.Variations) == 0:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"data":  response,
+			"error": results[0].Error,
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"data":    response,
+			"message": "一部のトーン変換に失敗しました。失敗したトーンのみ再試行できます",
+		})
 	}
+}
 
-	// データベースにトーン変換結果を保存
-	toneMap := make(map[string]string)
-	for _, variation := range variations {
-		toneMap[variation.Tone] = variation.Text
+// newToneTransformResponse トーン単位の結果からレスポンスを組み立てる
+func newToneTransformResponse(messageID string, results []ToneResult) ToneTransformResponse {
+	variations := make([]ToneVariation, 0, len(results))
+	for _, result := range results {
+		if result.Status == ToneResultSuccess {
+			variations = append(variations, result.variant())
+		}
 	}
-	
-	updateReq := &models.UpdateMessageRequest{
-		ToneVariations: toneMap,
+
+	failed := failedTones(results)
+	return ToneTransformResponse{
+		MessageID:   messageID,
+		Variations:  variations,
+		Results:     results,
+		FailedTones: failed,
+		Partial:     len(failed) > 0 && len(variations) > 0,
+	}
+}
+
+// failedTones 失敗したトーン名の一覧を取得
+func failedTones(results []ToneResult) []string {
+	failed := make([]string, 0)
+	for _, result := range results {
+		if result.Status == ToneResultFailed {
+			failed = append(failed, result.Tone)
+		}
+	}
+	return failed
+}
+
+// availableTones 変換対象のトーン一覧を取得
+func (h *TransformHandler) availableTones() []string {
+	var availableTones []string
+	if toneConfig := h.toneConfig(); toneConfig != nil {
+		fmt.Printf("[Transform] YAML設定ファイルからトーン一覧を取得中...\n")
+		for _, toneName := range toneConfig.ToneNames() {
+			availableTones = append(availableTones, toneName)
+			fmt.Printf("[Transform] - YAML設定トーン: %s\n", toneName)
+		}
+		fmt.Printf("✅ [Transform] YAML設定ファイル使用: %d個のトーン\n", len(availableTones))
+	} else {
+		// フォールバック: デフォルトトーン
+		availableTones = []string{"gentle", "constructive", "casual"}
+		fmt.Printf("⚠️ [Transform] フォールバックモード: デフォルトプロンプトを使用\n")
+	}
+	return availableTones
+}
+
+// resolveTones 指定されたトーンを検証し、カスタムトーンの定義を読み込む
+// requested が空の場合は設定ファイルの全トーンを返す
+func (h *TransformHandler) resolveTones(ctx context.Context, userID primitive.ObjectID, requested []string) ([]string, map[string]config.Tone, error) {
+	globalTones := h.availableTones()
+	if len(requested) == 0 {
+		return globalTones, nil, nil
 	}
 
-	_, err = h.messageService.UpdateMessage(c.Request.Context(), messageID, currentUserID, updateReq)
+	isGlobal := make(map[string]bool, len(globalTones))
+	for _, tone := range globalTones {
+		isGlobal[tone] = true
+	}
+
+	tones := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	var customKeys []string
+	for _, tone := range requested {
+		if seen[tone] {
+			continue
+		}
+		seen[tone] = true
+
+		switch {
+		case isGlobal[tone]:
+		case models.IsCustomToneKey(tone):
+			customKeys = append(customKeys, tone)
+		default:
+			return nil, nil, fmt.Errorf("サポートされていないトーンです: %s", tone)
+		}
+		tones = append(tones, tone)
+	}
+
+	if len(customKeys) == 0 {
+		return tones, nil, nil
+	}
+	if h.customToneService == nil {
+		return nil, nil, fmt.Errorf("カスタムトーンは利用できません")
+	}
+
+	found, err := h.customToneService.GetCustomTonesByKeys(ctx, userID, customKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "トーン変換結果の保存に失敗しました"})
+		return nil, nil, fmt.Errorf("カスタムトーンの取得に失敗しました")
+	}
+
+	customTones := make(map[string]config.Tone, len(found))
+	for _, key := range customKeys {
+		customTone, ok := found[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("カスタムトーンが見つかりません: %s", key)
+		}
+		customTones[key] = customToneConfig(customTone)
+	}
+
+	return tones, customTones, nil
+}
+
+// GetAvailableTones 利用可能なトーン一覧（グローバルトーン＋自分のカスタムトーン）を取得
+// GET /api/v1/transform/tones
+func (h *TransformHandler) GetAvailableTones(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	response := ToneTransformResponse{
-		MessageID:  req.MessageID,
-		Variations: variations,
+	type availableTone struct {
+		Key         string `json:"key"`
+		DisplayName string `json:"displayName"`
+		Custom      bool   `json:"custom"`
+	}
+
+	toneConfig := h.toneConfig()
+	tones := make([]availableTone, 0)
+	for _, key := range h.availableTones() {
+		displayName := key
+		if toneConfig != nil {
+			displayName = toneConfig.Tones[key].DisplayName
+		}
+		tones = append(tones, availableTone{Key: key, DisplayName: displayName})
+	}
+
+	if h.customToneService != nil {
+		customTones, err := h.customToneService.GetCustomTones(c.Request.Context(), currentUser.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "カスタムトーンの取得に失敗しました"})
+			return
+		}
+		for _, tone := range customTones {
+			tones = append(tones, availableTone{Key: tone.Key, DisplayName: tone.DisplayName, Custom: true})
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data":    response,
-		"message": "トーン変換が完了しました",
+		"data": tones,
 	})
 }
 
-// callAnthropicAPI Anthropic Claude APIを呼び出してトーン変換を実行
-func (h *TransformHandler) callAnthropicAPI(ctx context.Context, originalText, tone string) (string, error) {
+// saveToneResults 成功したトーンを保存し、失敗したトーンを再試行用に記録
+func (h *TransformHandler) saveToneResults(ctx context.Context, messageID, userID primitive.ObjectID, results []ToneResult) error {
+	succeeded := make([]models.ToneVariant, 0, len(results))
+	for _, result := range results {
+		if result.Status == ToneResultSuccess {
+			succeeded = append(succeeded, result.variant())
+		}
+	}
+
+	return h.messageService.SaveToneResults(ctx, messageID, userID, succeeded, failedTones(results))
+}
+
+// buildToneRequest トーン変換用のLLMリクエストを生成
+// トーンで A/B 実験を実施中の場合は、ユーザーに割り当てた群のプロンプト・モデルを使う
+func (h *TransformHandler) buildToneRequest(ctx context.Context, job toneJob, tone string) (*llm.Request, error) {
+	originalText := job.originalText
 	var prompt string
 	var modelConfig config.AIModelConfig
+	displayName, promptVersion := tone, "default"
+	var assignment *models.ExperimentAssignment
+	var armCharacteristics []string
+
+	customTone, isCustom := job.customTones[tone]
+	toneConfig := h.toneConfig()
 
 	// 設定ファイルからプロンプトを生成
-	if h.toneConfig != nil {
+	if isCustom {
+		// ユーザー定義トーンは custom_tone_template で描画する
+		fmt.Printf("[%s] カスタムトーンのプロンプト生成中...\n", tone)
+		if toneConfig == nil {
+			_, modelConfig = h.getDefaultPrompt(originalText, tone, job.outputLanguage)
+			toneConfig = &config.ToneConfig{AIModel: modelConfig}
+		}
+		customTone = toneConfig.LocalizeTone(customTone, job.outputLanguage)
+		var err error
+		prompt, err = toneConfig.RenderPromptFor(customTone, originalText, job.promptOptions())
+		if err != nil {
+			return nil, fmt.Errorf("プロンプト生成エラー: %w", err)
+		}
+		modelConfig = toneConfig.GetAIModelConfig()
+		displayName, promptVersion = customTone.DisplayName, toneConfig.PromptVersion(customTone)
+	} else if toneConfig != nil {
 		fmt.Printf("[%s] YAML設定からプロンプト生成中...\n", tone)
+		toneDef, exists := toneConfig.Tones[tone]
+		if !exists {
+			return nil, fmt.Errorf("プロンプト生成エラー: サポートされていないトーンです: %s", tone)
+		}
+		modelConfig = toneConfig.GetAIModelConfig()
+		// 出力言語の定義があればそれを使う（実験の群は設定ファイルの言語で書かれているため、他の言語の定義を使う場合は実験に含めない）
+		toneDef = toneConfig.LocalizeTone(toneDef, job.outputLanguage)
+		if toneDef.TemplateLanguage() != toneConfig.GetLanguage() {
+			fmt.Printf("[%s] %s の定義を使用\n", tone, toneDef.TemplateLanguage())
+		} else if experiment := h.runningExperiment(ctx, tone); experiment != nil {
+			arm := experiment.Assign(job.userID)
+			toneDef, modelConfig = arm.Apply(toneDef, modelConfig)
+			armAssignment := experiment.Assignment(arm)
+			assignment, armCharacteristics = &armAssignment, arm.Characteristics
+			fmt.Printf("[%s] 実験 %s: 群 %s を使用\n", tone, experiment.Key, arm.Name)
+		}
 		var err error
-		prompt, err = h.toneConfig.GetPrompt(tone, originalText)
+		prompt, err = toneConfig.RenderPromptFor(toneDef, originalText, job.promptOptions())
 		if err != nil {
 			fmt.Printf("[%s] プロンプト生成エラー: %v\n", tone, err)
-			return "", fmt.Errorf("プロンプト生成エラー: %w", err)
+			return nil, fmt.Errorf("プロンプト生成エラー: %w", err)
 		}
-		modelConfig = h.toneConfig.GetAIModelConfig()
+		displayName, promptVersion = toneDef.DisplayName, toneConfig.PromptVersion(toneDef)
 		fmt.Printf("[%s] ✅ YAML設定プロンプト生成成功 (Model: %s, MaxTokens: %d)\n", tone, modelConfig.Name, modelConfig.MaxTokens)
 	} else {
 		// フォールバック: デフォルトプロンプト
 		fmt.Printf("[%s] デフォルトプロンプト使用\n", tone)
-		prompt, modelConfig = h.getDefaultPrompt(originalText, tone)
+		prompt, modelConfig = h.getDefaultPrompt(originalText, tone, job.outputLanguage)
 		fmt.Printf("[%s] ✅ デフォルトプロンプト生成成功 (Model: %s, MaxTokens: %d)\n", tone, modelConfig.Name, modelConfig.MaxTokens)
 	}
 
-	// リクエストボディを作成
-	requestBody := AnthropicRequest{
-		Model:     modelConfig.Name,
-		MaxTokens: modelConfig.MaxTokens,
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+	llmReq := llm.NewUserRequest(modelConfig.Name, modelConfig.MaxTokens, prompt)
+	llmReq.Metadata["label"] = tone
+	llmReq.Metadata["task"] = llm.TaskToneTransform
+	llmReq.Metadata["tone"] = tone
+	llmReq.Metadata["original_text"] = originalText
+	llmReq.Metadata["display_name"] = displayName
+	llmReq.Metadata["prompt_version"] = promptVersion
+	if isCustom {
+		llmReq.Metadata["characteristics"] = strings.Join(customTone.Characteristics, "\n")
+	}
+	if job.relationship != nil {
+		llmReq.Metadata["relationship"] = job.relationship.Type
+	}
+	if job.outputLanguage != "" {
+		llmReq.Metadata["language"] = job.outputLanguage
 	}
+	if len(armCharacteristics) > 0 {
+		llmReq.Metadata["characteristics"] = strings.Join(armCharacteristics, "\n")
+	}
+	if assignment != nil {
+		llmReq.Metadata["experiment_id"] = assignment.ExperimentID.Hex()
+		llmReq.Metadata["experiment_key"] = assignment.Key
+		llmReq.Metadata["experiment_arm"] = assignment.Arm
+	}
+	return llmReq, nil
+}
 
-	jsonData, err := json.Marshal(requestBody)
+// recipientRelationship 送信者が登録した受信者との関係を取得（受信者・関係が未設定の場合、取得に失敗した場合は nil）
+// 関係の取得に失敗しても変換は関係を含めずに続ける
+func (h *TransformHandler) recipientRelationship(ctx context.Context, userID, recipientID primitive.ObjectID) *config.Relationship {
+	if h.friendships == nil || recipientID.IsZero() {
+		return nil
+	}
+	relationship, err := h.friendships.GetRelationship(ctx, userID, recipientID)
 	if err != nil {
-		return "", fmt.Errorf("リクエストの作成に失敗: %w", err)
+		fmt.Printf("[Transform] 受信者との関係の取得エラー: %v\n", err)
+		return nil
 	}
+	if relationship == nil {
+		return nil
+	}
+	return &config.Relationship{Type: relationship.Type, Label: relationship.Label, Notes: relationship.Notes}
+}
 
-	// HTTP リクエストを作成
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+// promptOptions トーンのプロンプト生成のオプション（受信者との関係・言語）
+func (job toneJob) promptOptions() config.PromptOptions {
+	return config.PromptOptions{
+		Relationship:   job.relationship,
+		InputLanguage:  job.language,
+		OutputLanguage: job.outputLanguage,
+	}
+}
+
+// toneLanguages 元のメッセージの言語と変換結果の言語を決める
+// translate が true の場合は受信者の希望言語で出力する（受信者・希望言語が未設定の場合、取得に失敗した場合は翻訳しない）
+func (h *TransformHandler) toneLanguages(ctx context.Context, originalText string, recipientID primitive.ObjectID, translate bool) (string, string) {
+	inputLanguage := language.Detect(originalText)
+	if !translate || recipientID.IsZero() {
+		return inputLanguage, inputLanguage
+	}
+	recipient, err := h.messageService.GetUserService().GetUserByID(ctx, recipientID.Hex())
 	if err != nil {
-		return "", fmt.Errorf("HTTPリクエストの作成に失敗: %w", err)
+		fmt.Printf("[Transform] 受信者の希望言語の取得エラー: %v\n", err)
+		return inputLanguage, inputLanguage
+	}
+	if !language.Supported(recipient.PreferredLanguage) {
+		return inputLanguage, inputLanguage
 	}
+	return inputLanguage, recipient.PreferredLanguage
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", h.anthropicAPIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// runningExperiment トーンで実施中の実験を取得（無い場合・取得に失敗した場合は nil）
+// 実験の取得に失敗しても変換は通常の設定で続ける
+func (h *TransformHandler) runningExperiment(ctx context.Context, tone string) *models.Experiment {
+	if h.experiments == nil {
+		return nil
+	}
+	experiment, err := h.experiments.RunningExperiment(ctx, tone)
+	if err != nil {
+		fmt.Printf("[%s] 実験の取得エラー: %v\n", tone, err)
+		return nil
+	}
+	return experiment
+}
 
-	// HTTPクライアントでリクエストを送信（詳細ログ付きリトライ機能）
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// experimentAssignment LLMリクエストのメタデータから実験の割り当てを取得（実験外の場合は nil）
+func experimentAssignment(llmReq *llm.Request) *models.ExperimentAssignment {
+	experimentID, err := primitive.ObjectIDFromHex(llmReq.Metadata["experiment_id"])
+	if err != nil {
+		return nil
 	}
-	
-	fmt.Printf("[%s] リクエスト詳細 - URL: %s, Model: %s, MaxTokens: %d\n", tone, "https://api.anthropic.com/v1/messages", requestBody.Model, requestBody.MaxTokens)
-	fmt.Printf("[%s] リクエストサイズ: %d bytes\n", tone, len(jsonData))
-	
-	var resp *http.Response
-	var lastErr error
-	maxRetries := 3
-	
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		fmt.Printf("[%s] 試行 %d/%d - リクエスト送信中...\n", tone, attempt, maxRetries)
-		
-		resp, err = client.Do(req)
-		if err != nil {
-			lastErr = err
-			fmt.Printf("[%s] 試行 %d/%d - 接続エラー: %v\n", tone, attempt, maxRetries, err)
-			if attempt < maxRetries {
-				// 指数バックオフでリトライ
-				waitTime := time.Duration(attempt*attempt) * time.Second
-				fmt.Printf("[%s] %d秒後にリトライします\n", tone, int(waitTime.Seconds()))
-				time.Sleep(waitTime)
-				continue
-			}
-			return "", fmt.Errorf("API呼び出しに失敗（%d回試行後）: %w", maxRetries, err)
-		}
-		
-		fmt.Printf("[%s] 試行 %d/%d - レスポンス受信: ステータス %d\n", tone, attempt, maxRetries, resp.StatusCode)
-		
-		// 529, 502, 503エラーの場合はリトライ
-		if resp.StatusCode == 529 || resp.StatusCode == 502 || resp.StatusCode == 503 {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			fmt.Printf("[%s] 試行 %d/%d - 一時的エラー（%d）: %s\n", tone, attempt, maxRetries, resp.StatusCode, string(bodyBytes))
-			lastErr = fmt.Errorf("Anthropic API 一時的エラー: status %d", resp.StatusCode)
-			if attempt < maxRetries {
-				waitTime := time.Duration(attempt*2) * time.Second
-				fmt.Printf("[%s] %d秒後にリトライします\n", tone, int(waitTime.Seconds()))
-				time.Sleep(waitTime)
-				continue
-			}
-		}
-		
-		break
+	return &models.ExperimentAssignment{
+		ExperimentID: experimentID,
+		Key:          llmReq.Metadata["experiment_key"],
+		Arm:          llmReq.Metadata["experiment_arm"],
 	}
-	
-	if resp == nil {
-		return "", fmt.Errorf("API呼び出しが失敗しました: %v", lastErr)
+}
+
+// generateToneVariation LLMプロバイダーを呼び出してトーン変換を実行
+// job.force が false の場合は同一プロンプト・モデルのキャッシュを優先する
+func (h *TransformHandler) generateToneVariation(ctx context.Context, job toneJob, tone string) (ToneVariation, error) {
+	llmReq, err := h.buildToneRequest(ctx, job, tone)
+	if err != nil {
+		return ToneVariation{}, err
+	}
+
+	if text, ok := h.lookupToneCache(ctx, llmReq, job.force); ok {
+		return newToneVariant(llmReq, toneoutput.Sanitize(text), ""), nil
+	}
+
+	resp, err := h.llmProvider.Complete(ctx, llmReq)
+	if err != nil {
+		return ToneVariation{}, err
+	}
+
+	return h.finishToneVariant(ctx, job, llmReq, resp)
+}
+
+// newToneVariant LLMリクエストのメタデータから変換結果を組み立てる
+// model が空の場合（キャッシュヒット等）はリクエストのモデル名を使う
+func newToneVariant(llmReq *llm.Request, text, model string) ToneVariation {
+	if model == "" {
+		model = llmReq.Model
+	}
+	return ToneVariation{
+		Tone:          llmReq.Metadata["tone"],
+		DisplayName:   llmReq.Metadata["display_name"],
+		Text:          text,
+		Model:         model,
+		PromptVersion: llmReq.Metadata["prompt_version"],
+		Language:      llmReq.Metadata["language"],
+		GeneratedAt:   time.Now(),
+		Experiment:    experimentAssignment(llmReq),
+	}
+}
+
+// toneCacheKey トーン変換リクエストのキャッシュキーを計算
+func (h *TransformHandler) toneCacheKey(llmReq *llm.Request) string {
+	return models.TransformCacheKey(h.llmProvider.Name(), llmReq.Model, llmReq.Messages[0].Content)
+}
+
+// lookupToneCache キャッシュから変換結果を取得
+func (h *TransformHandler) lookupToneCache(ctx context.Context, llmReq *llm.Request, force bool) (string, bool) {
+	if h.transformCache == nil {
+		return "", false
+	}
+	if force {
+		h.transformCache.RecordBypass()
+		return "", false
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		// エラーレスポンスの詳細を取得
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Anthropic API エラー: status %d, response: %s", resp.StatusCode, string(bodyBytes))
+	entry, ok, err := h.transformCache.Get(ctx, h.toneCacheKey(llmReq))
+	if err != nil {
+		fmt.Printf("[%s] キャッシュ取得エラー: %v\n", llmReq.Label(), err)
+		return "", false
+	}
+	if !ok {
+		return "", false
 	}
 
-	// レスポンスをパース
-	var apiResponse AnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-		return "", fmt.Errorf("レスポンスの解析に失敗: %w", err)
+	fmt.Printf("[%s] ✅ キャッシュヒット (hitCount: %d)\n", llmReq.Label(), entry.HitCount)
+	return entry.Text, true
+}
+
+// storeToneCache 変換結果をキャッシュに保存（失敗してもリクエストは継続）
+func (h *TransformHandler) storeToneCache(ctx context.Context, llmReq *llm.Request, text string) {
+	if h.transformCache == nil {
+		return
+	}
+
+	entry := &models.TransformCacheEntry{
+		Key:      h.toneCacheKey(llmReq),
+		Provider: h.llmProvider.Name(),
+		Model:    llmReq.Model,
+		Tone:     llmReq.Metadata["tone"],
+		Text:     text,
+	}
+	if err := h.transformCache.Set(ctx, entry); err != nil {
+		fmt.Printf("[%s] キャッシュ保存エラー: %v\n", llmReq.Label(), err)
+	}
+}
+
+// GetCacheStats トーン変換キャッシュの統計を取得
+// GET /api/v1/transform/cache/stats
+func (h *TransformHandler) GetCacheStats(c *gin.Context) {
+	if h.transformCache == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"data":    gin.H{"enabled": false},
+			"message": "キャッシュは無効です",
+		})
+		return
 	}
 
-	if len(apiResponse.Content) == 0 {
-		return "", fmt.Errorf("空のレスポンスが返されました")
+	stats, err := h.transformCache.GetStats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "キャッシュ統計の取得に失敗しました"})
+		return
 	}
 
-	return apiResponse.Content[0].Text, nil
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"enabled": true,
+			"stats":   stats,
+		},
+	})
 }
 
 // getDefaultPrompt フォールバック用デフォルトプロンプト
-func (h *TransformHandler) getDefaultPrompt(originalText, tone string) (string, config.AIModelConfig) {
+// 出力言語が日本語以外の場合は出力言語の指示を追加する
+func (h *TransformHandler) getDefaultPrompt(originalText, tone, outputLanguage string) (string, config.AIModelConfig) {
 	prompts := map[string]string{
 		"gentle": "あなたはコミュニケーションコーチです。以下のメッセージを、相手の気持ちを最大限に配慮した優しく思いやりのあるトーンに変換してください。\n\n元のメッセージ: " + originalText + "\n\n優しめトーンに変換:",
 		"constructive": "あなたはコミュニケーションコーチです。以下のメッセージを、建設的で前向きなトーンに変換してください。\n\n元のメッセージ: " + originalText + "\n\n建設的トーンに変換:",
@@ -359,6 +821,9 @@ func (h *TransformHandler) getDefaultPrompt(originalText, tone string) (string,
 	if prompt == "" {
 		prompt = "以下のメッセージを変換してください: " + originalText
 	}
+	if outputLanguage != "" && outputLanguage != language.Japanese {
+		prompt += "\n\n変換後の文章は" + language.Name(outputLanguage) + "で出力してください。"
+	}
 
 	defaultConfig := config.AIModelConfig{
 		Name:      "claude-3-haiku-20240307",
@@ -369,35 +834,79 @@ func (h *TransformHandler) getDefaultPrompt(originalText, tone string) (string,
 }
 
 // ReloadConfig 設定ファイルを再読み込み（開発・チューニング用）
+// バージョン管理が有効な場合は、設定ファイルの内容を新しいバージョンとして保存して有効化する（管理者のみ）
 // POST /api/v1/transform/reload-config
 func (h *TransformHandler) ReloadConfig(c *gin.Context) {
+	if h.promptConfigs != nil {
+		h.reloadConfigAsVersion(c)
+		return
+	}
+
 	if err := config.ReloadConfig(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の再読み込みに失敗しました"})
 		return
 	}
 
-	// ハンドラーの設定も更新
 	newConfig, err := config.LoadToneConfig()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "新しい設定の読み込みに失敗しました"})
 		return
 	}
 
-	h.toneConfig = newConfig
-
-	availableTones := h.toneConfig.GetAvailableTones()
+	availableTones := newConfig.GetAvailableTones()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "設定を再読み込みしました",
 		"available_tones": availableTones,
 	})
 }
 
+// reloadConfigAsVersion 設定ファイルの内容を新しいバージョンとして保存して有効化
+func (h *TransformHandler) reloadConfigAsVersion(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := config.ReadToneConfigFile()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の再読み込みに失敗しました", "details": err.Error()})
+		return
+	}
+
+	author := models.NewPromptConfigAuthor(currentUser)
+	version, err := h.promptConfigs.CreateVersion(c.Request.Context(), string(data), author, "設定ファイルから再読み込み")
+	if err != nil && err != models.ErrPromptConfigUnchanged {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新しい設定の読み込みに失敗しました", "details": err.Error()})
+		return
+	}
+	if version, err = h.promptConfigs.ActivateVersion(c.Request.Context(), version.Version, author); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の有効化に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         fmt.Sprintf("設定を再読み込みしました（v%d）", version.Version),
+		"available_tones": h.toneConfig().GetAvailableTones(),
+		"version":         version,
+	})
+}
+
 // RegisterRoutes トーン変換関連のルートを登録
 func (h *TransformHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
 	transform := router.Group("/transform")
 	transform.Use(firebaseMiddleware)
 	{
+		transform.GET("/tones", h.GetAvailableTones)
 		transform.POST("/tones", h.TransformToTones)
-		transform.POST("/reload-config", h.ReloadConfig) // チューニング用
+		transform.GET("/tones/stream", h.TransformToTonesStream)
+		transform.POST("/tones/stream", h.TransformToTonesStream)
+		transform.POST("/tones/retry", h.RetryFailedTones)
+		transform.POST("/refine", h.RefineTone)
+		transform.POST("/refine/select", h.SelectRevision)
+		transform.POST("/analyze", h.AnalyzeMessage)  // 変換前のメッセージの強さを分析
+		transform.POST("/explain", h.ExplainVariants) // 変換結果の差分と変更理由
+		transform.GET("/cache/stats", h.GetCacheStats)
+		transform.POST("/reload-config", middleware.RequireAdmin(), h.ReloadConfig) // チューニング用（管理者のみ）
 	}
 }
\ No newline at end of file
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExplainRequest 変換結果の説明リクエスト
+type ExplainRequest struct {
+	MessageID string `json:"messageId" binding:"required"`
+	// Tones 説明するトーン（省略時はメッセージの全変換結果）
+	Tones []string `json:"tones,omitempty"`
+	Force bool     `json:"force"` // true の場合保存済みの説明を使わず再生成
+}
+
+// ToneExplanation トーンごとの変換結果の説明
+type ToneExplanation struct {
+	Tone        string                     `json:"tone"`
+	DisplayName string                     `json:"displayName,omitempty"`
+	Text        string                     `json:"text"`
+	Explanation *models.VariantExplanation `json:"explanation"`
+}
+
+// ExplainVariants 変換結果ごとに元のメッセージからの差分と変更ごとの理由を生成して保存
+// 元のメッセージ・変換結果が変わっていない場合は保存済みの説明を返す
+// POST /api/v1/transform/explain
+func (h *TransformHandler) ExplainVariants(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUser.ID)
+	if err != nil || message.SenderID != currentUser.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+		return
+	}
+
+	tones := req.Tones
+	if len(tones) == 0 {
+		for _, variant := range message.Variations {
+			tones = append(tones, variant.Tone)
+		}
+	}
+	if len(tones) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "説明できる変換結果がありません"})
+		return
+	}
+
+	// 保存済みの説明が使えないトーンのみ生成する
+	results := make([]ToneExplanation, 0, len(tones))
+	var pending []int
+	for _, tone := range tones {
+		variant, ok := message.Variations.Get(tone)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%sトーンの変換結果がありません", tone)})
+			return
+		}
+		result := ToneExplanation{Tone: tone, DisplayName: variant.DisplayName, Text: variant.Text}
+		if !req.Force && variant.Explanation != nil && variant.Explanation.Matches(message.OriginalText, variant.Text) {
+			result.Explanation = variant.Explanation
+		} else {
+			pending = append(pending, len(results))
+		}
+		results = append(results, result)
+	}
+
+	if len(pending) > 0 && h.llmProvider != nil && !checkAIQuota(c, h.usageService, currentUser, len(pending)) {
+		return
+	}
+
+	for _, i := range pending {
+		results[i].Explanation = h.explainVariant(c.Request.Context(), currentUser.ID, message, results[i])
+		if err := h.messageService.SaveVariantExplanation(c.Request.Context(), messageID, currentUser.ID, results[i].Tone, results[i].Explanation); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "変換結果の説明の保存に失敗しました"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"messageId":    req.MessageID,
+			"explanations": results,
+			"categories":   models.ChangeCategories,
+		},
+	})
+}
+
+// explainVariant 変換結果の差分を計算し、変更ごとの理由をモデルに説明させる
+// 変更が無い場合はモデルを呼び出さず、応答が使えない場合は追加・削除された語句から理由を判定する
+func (h *TransformHandler) explainVariant(ctx context.Context, userID primitive.ObjectID, message *models.Message, variant ToneExplanation) *models.VariantExplanation {
+	toneConfig := analysisConfig()
+	rules := toneConfig.HarshnessAnalysis.Rules
+
+	explanation := models.NewVariantDiff(message.OriginalText, variant.Text)
+	if len(explanation.Changes) == 0 || h.llmProvider == nil {
+		explanation.ApplyRuleReasons(rules)
+		return explanation
+	}
+
+	if err := h.requestExplanation(ctx, toneConfig, userID, message, variant, explanation); err != nil {
+		fmt.Printf("[%s] AIで説明できないため語句から理由を判定します: %v\n", variant.Tone, err)
+		explanation.ApplyRuleReasons(rules)
+	}
+	return explanation
+}
+
+// requestExplanation LLMプロバイダーを呼び出して変更ごとの理由を explanation に設定
+func (h *TransformHandler) requestExplanation(ctx context.Context, toneConfig *config.ToneConfig, userID primitive.ObjectID, message *models.Message, variant ToneExplanation, explanation *models.VariantExplanation) error {
+	data := config.ExplanationPromptData{
+		DisplayName:  variant.DisplayName,
+		OriginalText: message.OriginalText,
+		VariantText:  variant.Text,
+	}
+	if data.DisplayName == "" {
+		data.DisplayName = variant.Tone
+	}
+	for _, change := range explanation.Changes {
+		data.Changes = append(data.Changes, config.ExplanationChange{ID: change.ID, Before: change.Before, After: change.After})
+	}
+	for _, category := range models.ChangeCategories {
+		data.Categories = append(data.Categories, category.Key)
+	}
+
+	prompt, err := toneConfig.GetExplanationPrompt(data)
+	if err != nil {
+		return err
+	}
+
+	modelConfig := toneConfig.GetAIModelConfig()
+	llmReq := llm.NewUserRequest(modelConfig.Name, modelConfig.MaxTokens, prompt)
+	llmReq.ResponseFormat = llm.ResponseFormat{Type: llm.ResponseFormatJSON, Schema: models.VariantExplanationSchema}
+	llmReq.Metadata["label"] = variant.Tone
+	llmReq.Metadata["task"] = llm.TaskToneExplain
+	llmReq.Metadata["tone"] = variant.Tone
+	llmReq.Metadata["original_text"] = message.OriginalText
+	llmReq.Metadata["variant_text"] = variant.Text
+
+	resp, err := h.llmProvider.Complete(ctx, llmReq)
+	if err != nil {
+		return err
+	}
+	recordAIUsage(ctx, h.usageService, h.llmProvider, userID, message.ID, models.AIFeatureToneExplain, llmReq, resp)
+
+	raw, err := llm.ExtractJSON(resp.Text)
+	if err != nil {
+		return err
+	}
+	return explanation.ApplyReasons(raw, toneConfig.HarshnessAnalysis.Rules)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/toneoutput"
+)
+
+// finishToneVariant LLMの応答から変換結果を取り出し、トーン設定の制約で検証する
+// 制約を満たさない場合は output_retries 回まで再生成し、それでも満たさない場合は違反内容を付けて返す
+// 制約を満たした結果のみキャッシュに保存する
+func (h *TransformHandler) finishToneVariant(ctx context.Context, job toneJob, llmReq *llm.Request, resp *llm.Response) (ToneVariation, error) {
+	constraints, retries := h.outputConstraints(job, llmReq.Metadata["tone"])
+
+	for attempt := 0; ; attempt++ {
+		// 再生成した分も利用量として記録する
+		recordAIUsage(ctx, h.usageService, h.llmProvider, job.userID, job.messageID, models.AIFeatureToneTransform, llmReq, resp)
+
+		text := toneoutput.Sanitize(resp.Text)
+		violations := toneoutput.Validate(text, constraints)
+		if len(violations) == 0 {
+			h.storeToneCache(ctx, llmReq, text)
+			return newToneVariant(llmReq, text, resp.Model), nil
+		}
+		fmt.Printf("[%s] 変換結果が制約を満たしません (%d回目): %v\n", llmReq.Label(), attempt+1, violations)
+
+		if attempt >= retries {
+			if text == "" {
+				return ToneVariation{}, fmt.Errorf("変換結果が空でした")
+			}
+			variant := newToneVariant(llmReq, text, resp.Model)
+			variant.Violations = violations
+			return variant, nil
+		}
+
+		var err error
+		if resp, err = h.llmProvider.Complete(ctx, llmReq); err != nil {
+			return ToneVariation{}, err
+		}
+	}
+}
+
+// outputConstraints トーンの変換結果に適用する制約と再生成回数を取得
+func (h *TransformHandler) outputConstraints(job toneJob, tone string) (config.OutputConstraints, int) {
+	toneConfig := h.toneConfig()
+	if toneConfig == nil {
+		toneConfig = &config.ToneConfig{}
+	}
+
+	toneDef, isCustom := job.customTones[tone]
+	if !isCustom {
+		toneDef = toneConfig.Tones[tone]
+	}
+	// 出力言語の定義に制約があればそれを使う
+	toneDef = toneConfig.LocalizeTone(toneDef, job.outputLanguage)
+	return toneConfig.ConstraintsFor(toneDef), toneConfig.GetOutputRetries()
+}
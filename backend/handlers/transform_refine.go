@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/language"
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/toneoutput"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ToneRefineRequest トーン変換結果の改訂リクエスト
+// RevisionID を指定した場合はその改訂を、省略した場合は Tone の変換結果を基に改訂する
+type ToneRefineRequest struct {
+	MessageID   string `json:"messageId" binding:"required"`
+	Tone        string `json:"tone,omitempty" binding:"required_without=RevisionID"`
+	RevisionID  string `json:"revisionId,omitempty"`
+	Instruction string `json:"instruction" binding:"required,max=200"` // 例: 「もっと短く」「絵文字を減らして」
+}
+
+// RevisionSelectRequest 改訂の選択リクエスト
+type RevisionSelectRequest struct {
+	MessageID  string `json:"messageId" binding:"required"`
+	RevisionID string `json:"revisionId" binding:"required"`
+	// ConfirmHarsh 送信予約済みのメッセージで、改訂が強く伝わる可能性がある場合でも選択する
+	ConfirmHarsh bool `json:"confirmHarsh"`
+}
+
+// ToneRefineResponse 改訂レスポンス
+type ToneRefineResponse struct {
+	MessageID  string                  `json:"messageId"`
+	Refinement models.ToneRefinement   `json:"refinement"`
+	BaseText   string                  `json:"baseText"` // 改訂の起点となったトーン変換結果
+	History    []models.ToneRefinement `json:"history"`  // 起点から今回の改訂までの改訂（古い順）
+}
+
+// RefineTone トーン変換結果を追加指示で改訂
+// 元のトーン変換と過去の改訂を会話として送り、指示に従って書き直させる
+// POST /api/v1/transform/refine
+func (h *TransformHandler) RefineTone(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ToneRefineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+	req.Instruction = strings.TrimSpace(req.Instruction)
+	if req.Instruction == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "改訂の指示を入力してください"})
+		return
+	}
+
+	if h.llmProvider == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AIプロバイダーが設定されていません"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	// 改訂は送信者のみ可能
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUser.ID)
+	if err != nil || message.SenderID != currentUser.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+		return
+	}
+
+	// 改訂の起点を決定（指定された改訂までの履歴をたどる）
+	tone := req.Tone
+	var chain []models.ToneRefinement
+	var parentID *primitive.ObjectID
+	if req.RevisionID != "" {
+		revisionID, err := primitive.ObjectIDFromHex(req.RevisionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無効な改訂IDです"})
+			return
+		}
+		chain = message.RefinementChain(revisionID)
+		if len(chain) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "改訂が見つかりません"})
+			return
+		}
+		tone = chain[len(chain)-1].Tone
+		parentID = &revisionID
+	}
+
+	variant, ok := message.Variations.Get(tone)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%sトーンの変換結果がありません", tone)})
+		return
+	}
+
+	_, customTones, err := h.resolveTones(c.Request.Context(), currentUser.ID, []string{tone})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job := toneJob{userID: currentUser.ID, messageID: messageID, originalText: message.OriginalText, customTones: customTones}
+	job.relationship = h.recipientRelationship(c.Request.Context(), currentUser.ID, message.RecipientID)
+	// 元の変換と同じ言語で改訂する（言語の記録が無い変換結果は元のメッセージの言語）
+	job.language = language.Detect(message.OriginalText)
+	job.outputLanguage = job.language
+	if variant.Language != "" {
+		job.outputLanguage = variant.Language
+	}
+	llmReq, err := h.buildRefineRequest(c.Request.Context(), job, variant, chain, req.Instruction)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAIQuota(c, h.usageService, currentUser, 1) {
+		return
+	}
+
+	resp, err := h.llmProvider.Complete(c.Request.Context(), llmReq)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "改訂に失敗しました", "details": err.Error()})
+		return
+	}
+	recordAIUsage(c.Request.Context(), h.usageService, h.llmProvider, currentUser.ID, messageID, models.AIFeatureToneRefine, llmReq, resp)
+
+	// 改訂でも <thinking> やタグが混ざることがあるため、変換結果と同じく本文のみ取り出す
+	text := toneoutput.Sanitize(resp.Text)
+	if text == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "改訂結果が空でした"})
+		return
+	}
+
+	refinement := &models.ToneRefinement{
+		Tone:          tone,
+		ParentID:      parentID,
+		Instruction:   req.Instruction,
+		Text:          text,
+		Model:         resp.Model,
+		PromptVersion: llmReq.Metadata["prompt_version"],
+	}
+	err = h.messageService.AddRefinement(c.Request.Context(), messageID, currentUser.ID, refinement)
+	if err == models.ErrRefinementLimitExceeded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "改訂の保存に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": ToneRefineResponse{
+			MessageID:  req.MessageID,
+			Refinement: *refinement,
+			BaseText:   variant.Text,
+			History:    append(chain, *refinement),
+		},
+		"message": "改訂しました",
+	})
+}
+
+// SelectRevision 改訂を最終テキストとして選択
+// POST /api/v1/transform/refine/select
+func (h *TransformHandler) SelectRevision(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req RevisionSelectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+	revisionID, err := primitive.ObjectIDFromHex(req.RevisionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効な改訂IDです"})
+		return
+	}
+
+	// 送信予約済みのメッセージの送信するテキストを変える場合は、スケジュールの作成と同じく強さを確認する
+	current, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUser.ID)
+	if err == nil && current.SenderID == currentUser.ID && current.Status == models.MessageStatusScheduled {
+		if refinement, ok := current.FindRefinement(revisionID); ok {
+			if !h.guard.allow(c, currentUser, current, refinement.Text, req.ConfirmHarsh) {
+				return
+			}
+		}
+	}
+
+	message, err := h.messageService.SelectRefinement(c.Request.Context(), messageID, currentUser.ID, revisionID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージまたは改訂が見つかりません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "改訂の選択に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    message,
+		"message": "改訂を選択しました",
+	})
+}
+
+// buildRefineRequest 改訂用のLLMリクエストを生成
+// 元のトーン変換のプロンプトと結果、過去の改訂の指示と結果を会話として並べ、最後に今回の指示を送る
+func (h *TransformHandler) buildRefineRequest(ctx context.Context, job toneJob, variant models.ToneVariant, chain []models.ToneRefinement, instruction string) (*llm.Request, error) {
+	llmReq, err := h.buildToneRequest(ctx, job, variant.Tone)
+	if err != nil {
+		return nil, err
+	}
+
+	toneConfig := h.toneConfig()
+	if toneConfig == nil {
+		toneConfig = &config.ToneConfig{}
+	}
+
+	llmReq.Messages = append(llmReq.Messages, llm.Message{Role: llm.RoleAssistant, Content: variant.Text})
+	baseText := variant.Text
+	for _, refinement := range chain {
+		prompt, err := toneConfig.GetRefinePrompt(refinement.Instruction)
+		if err != nil {
+			return nil, err
+		}
+		llmReq.Messages = append(llmReq.Messages,
+			llm.Message{Role: llm.RoleUser, Content: prompt},
+			llm.Message{Role: llm.RoleAssistant, Content: refinement.Text},
+		)
+		baseText = refinement.Text
+	}
+
+	prompt, err := toneConfig.GetRefinePrompt(instruction)
+	if err != nil {
+		return nil, err
+	}
+	llmReq.Messages = append(llmReq.Messages, llm.Message{Role: llm.RoleUser, Content: prompt})
+
+	llmReq.Metadata["label"] = variant.Tone + ":refine"
+	llmReq.Metadata["task"] = llm.TaskToneRefine
+	llmReq.Metadata["base_text"] = baseText
+	llmReq.Metadata["instruction"] = instruction
+	return llmReq, nil
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/toneoutput"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ToneStreamRequest ストリーミングトーン変換リクエスト
+// GET の場合はクエリパラメータ、POST の場合はJSONボディで受け付ける
+type ToneStreamRequest struct {
+	ToneTransformRequest
+	// Deltas true の場合、完成したトーンに加えてトークン単位の差分も送信する
+	Deltas bool `json:"deltas" form:"deltas"`
+}
+
+// ToneDelta ストリーミング中のトーン変換差分
+type ToneDelta struct {
+	Tone string `json:"tone"`
+	Text string `json:"text"`
+}
+
+// ToneError トーン単位の変換エラー
+type ToneError struct {
+	Tone  string `json:"tone"`
+	Error string `json:"error"`
+}
+
+// toneStreamEvent SSEで送信するイベント
+type toneStreamEvent struct {
+	name string
+	data interface{}
+}
+
+// TransformToTonesStream メッセージをトーン変換し、完成したトーンから順にSSEで送信
+// GET/POST /api/v1/transform/tones/stream
+//
+// イベント:
+//   - start:     {"messageId", "tones"}
+//   - delta:     ToneDelta（deltas=true の場合のみ、<thinking> 等を含む加工前の差分）
+//   - variation: ToneVariation（トーンごとに完成次第、<output> を抽出・検証済み。モデル・プロンプトバージョン等のメタデータ付き）
+//   - error:     ToneError（トーン単位のエラー、tone が空の場合は全体のエラー）
+//   - done:      ToneTransformResponse（全トーン完了・成功分の保存後）
+func (h *TransformHandler) TransformToTonesStream(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.messageService.GetUserService())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	currentUserID := currentUser.ID
+
+	var req ToneStreamRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストが無効です", "details": err.Error()})
+		return
+	}
+
+	// LLMプロバイダーの確認
+	if h.llmProvider == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AIプロバイダーが設定されていません"})
+		return
+	}
+
+	// メッセージIDの検証とアクセス権確認
+	messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無効なメッセージIDです"})
+		return
+	}
+
+	message, err := h.messageService.GetMessage(c.Request.Context(), messageID, currentUserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "メッセージが見つかりません"})
+		return
+	}
+
+	availableTones, customTones, err := h.resolveTones(c.Request.Context(), currentUserID, req.Tones)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// AI利用上限の確認（SSE開始前に通常のJSONエラーとして返す）
+	if !checkAIQuota(c, h.usageService, currentUser, len(availableTones)) {
+		return
+	}
+
+	// SSEヘッダーを設定
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(name string, data interface{}) {
+		c.SSEvent(name, data)
+		c.Writer.Flush()
+	}
+
+	send("start", gin.H{"messageId": req.MessageID, "tones": availableTones})
+
+	ctx := c.Request.Context()
+	job := toneJob{userID: currentUserID, messageID: messageID, originalText: req.OriginalText, force: req.Force, customTones: customTones}
+	job.relationship = h.recipientRelationship(ctx, currentUserID, message.RecipientID)
+	job.language, job.outputLanguage = h.toneLanguages(ctx, req.OriginalText, message.RecipientID, req.Translate)
+	events := make(chan toneStreamEvent, len(availableTones)*2)
+
+	// 各トーンを並行して変換し、イベントをチャネルに送る
+	// gin.Context への書き込みは並行安全でないため、送信はこのゴルーチンからのみ行う
+	go func() {
+		var wg sync.WaitGroup
+		for _, tone := range availableTones {
+			wg.Add(1)
+			go func(toneType string) {
+				defer wg.Done()
+				h.streamToneVariation(ctx, job, toneType, req.Deltas, events)
+			}(tone)
+		}
+		wg.Wait()
+		close(events)
+	}()
+
+	resultsByTone := make(map[string]ToneResult)
+	for ev := range events {
+		switch data := ev.data.(type) {
+		case ToneVariation:
+			resultsByTone[data.Tone] = newToneSuccess(data)
+		case ToneError:
+			resultsByTone[data.Tone] = ToneResult{Tone: data.Tone, Status: ToneResultFailed, Error: data.Error}
+		}
+		send(ev.name, ev.data)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Printf("[TransformStream] クライアント切断のため保存をスキップ: %s\n", req.MessageID)
+		return
+	}
+
+	// 設定のトーン順に並べ替え、成功したトーンのみ保存（失敗したトーンは再試行用に記録）
+	results := make([]ToneResult, 0, len(availableTones))
+	for _, tone := range availableTones {
+		results = append(results, resultsByTone[tone])
+	}
+
+	fmt.Printf("=== ストリーミング変換完了: %d個のエラー ===\n", len(failedTones(results)))
+
+	if err := h.saveToneResults(ctx, messageID, currentUserID, results); err != nil {
+		send("error", ToneError{Error: "トーン変換結果の保存に失敗しました"})
+		return
+	}
+
+	send("done", newToneTransformResponse(req.MessageID, results))
+}
+
+// streamToneVariation 1つのトーンをストリーミングで変換し、結果をイベントとして送る
+func (h *TransformHandler) streamToneVariation(ctx context.Context, job toneJob, tone string, deltas bool, events chan<- toneStreamEvent) {
+	emit := func(ev toneStreamEvent) {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	llmReq, err := h.buildToneRequest(ctx, job, tone)
+	if err != nil {
+		emit(toneStreamEvent{name: "error", data: ToneError{Tone: tone, Error: err.Error()}})
+		return
+	}
+
+	// キャッシュヒット時は全文を1つの差分として即座に返す
+	if text, ok := h.lookupToneCache(ctx, llmReq, job.force); ok {
+		if deltas {
+			emit(toneStreamEvent{name: "delta", data: ToneDelta{Tone: tone, Text: text}})
+		}
+		emit(toneStreamEvent{name: "variation", data: newToneVariant(llmReq, toneoutput.Sanitize(text), "")})
+		return
+	}
+
+	var onDelta llm.DeltaFunc
+	if deltas {
+		onDelta = func(delta string) {
+			emit(toneStreamEvent{name: "delta", data: ToneDelta{Tone: tone, Text: delta}})
+		}
+	}
+
+	fmt.Printf("[%s] ストリーミングAPI呼び出し開始\n", tone)
+	startTime := time.Now()
+
+	resp, err := llm.CompleteStream(ctx, h.llmProvider, llmReq, onDelta)
+
+	fmt.Printf("[%s] ストリーミングAPI呼び出し完了 (所要時間: %v)\n", tone, time.Since(startTime))
+
+	if err != nil {
+		fmt.Printf("[%s] エラー: %v\n", tone, err)
+		emit(toneStreamEvent{name: "error", data: ToneError{Tone: tone, Error: fmt.Sprintf("%sトーンの変換に失敗: %v", tone, err)}})
+		return
+	}
+
+	// 制約を満たさない場合の再生成はストリーミングせず、完成した結果のみ送る
+	variant, err := h.finishToneVariant(ctx, job, llmReq, resp)
+	if err != nil {
+		fmt.Printf("[%s] エラー: %v\n", tone, err)
+		emit(toneStreamEvent{name: "error", data: ToneError{Tone: tone, Error: fmt.Sprintf("%sトーンの変換に失敗: %v", tone, err)}})
+		return
+	}
+	emit(toneStreamEvent{name: "variation", data: variant})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yanwari-message-backend/services/llm"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestTransformTonesWithOfflineProvider LLM_PROVIDER=fake の応答で全トーンを変換してレスポンスを返す
+func TestTransformTonesWithOfflineProvider(t *testing.T) {
+	provider := llm.NewFakeProvider(OfflineResponder)
+	h := NewTransformHandler(nil, provider, nil, nil, nil, nil, nil, nil)
+	tones := h.availableTones()
+	if len(tones) == 0 {
+		t.Fatal("availableTones is empty, want tones from tone_prompts.yaml")
+	}
+
+	originalText := "明日までに資料を送ってください"
+	job := toneJob{userID: primitive.NewObjectID(), messageID: primitive.NewObjectID(), originalText: originalText, language: "ja", outputLanguage: "ja"}
+	results := h.transformTones(context.Background(), job, tones)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	h.respondToneResults(c, job.messageID.Hex(), results)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var body struct {
+		Data ToneTransformResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(body.Data.Variations) != len(tones) || len(body.Data.FailedTones) != 0 || body.Data.Partial {
+		t.Fatalf("response = %+v, want %d variations without failures", body.Data, len(tones))
+	}
+	for i, variation := range body.Data.Variations {
+		if variation.Tone != tones[i] || variation.Text == "" || variation.Text == originalText {
+			t.Errorf("variation[%d] = %+v, want transformed text for %s", i, variation, tones[i])
+		}
+	}
+
+	// トーンごとに1回ずつ、タスク種別と元のメッセージをメタデータに付けて呼び出す
+	requests := provider.Requests()
+	if len(requests) < len(tones) {
+		t.Fatalf("provider called %d times, want at least %d", len(requests), len(tones))
+	}
+	for _, req := range requests {
+		if req.Metadata["task"] != llm.TaskToneTransform || req.Metadata["original_text"] != originalText {
+			t.Errorf("request metadata = %v, want tone transform of the original text", req.Metadata)
+		}
+	}
+}
+
+// TestTransformTonesReportsFailedTones プロバイダーのエラーはトーン単位の失敗として返す
+func TestTransformTonesReportsFailedTones(t *testing.T) {
+	provider := llm.NewFakeProvider(func(ctx context.Context, req *llm.Request) (string, error) {
+		return "", context.DeadlineExceeded
+	})
+	h := NewTransformHandler(nil, provider, nil, nil, nil, nil, nil, nil)
+	job := toneJob{userID: primitive.NewObjectID(), messageID: primitive.NewObjectID(), originalText: "確認お願いします", language: "ja", outputLanguage: "ja"}
+	results := h.transformTones(context.Background(), job, h.availableTones())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	h.respondToneResults(c, job.messageID.Hex(), results)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d when every tone fails", w.Code, http.StatusInternalServerError)
+	}
+	if failed := failedTones(results); len(failed) != len(results) {
+		t.Errorf("failed tones = %v, want all %d tones", failed, len(results))
+	}
+}
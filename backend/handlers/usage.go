@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UsageHandler AI利用量ハンドラー
+type UsageHandler struct {
+	userService  *models.UserService
+	usageService *models.AIUsageService
+}
+
+// NewUsageHandler AI利用量ハンドラーを作成
+func NewUsageHandler(userService *models.UserService, usageService *models.AIUsageService) *UsageHandler {
+	return &UsageHandler{
+		userService:  userService,
+		usageService: usageService,
+	}
+}
+
+// GetUsage ログインユーザーのAI利用状況と残り利用可能量を取得
+// GET /api/v1/usage
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	currentUser, err := getUserByFirebaseUID(c, h.userService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := h.usageService.GetSummary(c.Request.Context(), currentUser.ID, userLocation(currentUser))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI利用状況の取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": summary,
+	})
+}
+
+// RegisterRoutes AI利用量関連のルートを登録
+func (h *UsageHandler) RegisterRoutes(router *gin.RouterGroup, firebaseMiddleware gin.HandlerFunc) {
+	usage := router.Group("/usage")
+	usage.Use(firebaseMiddleware)
+	{
+		usage.GET("", h.GetUsage)
+	}
+}
+
+// userLocation ユーザーのタイムゾーンを取得（不正・未設定の場合は Asia/Tokyo）
+func userLocation(user *models.User) *time.Location {
+	if user != nil && user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
+	}
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// checkAIQuota AIプロバイダー呼び出し前に利用上限を確認
+// 上限超過時は 429 を返して false を返す（usageService が nil の場合は常に true）
+func checkAIQuota(c *gin.Context, usageService *models.AIUsageService, user *models.User, plannedRequests int) bool {
+	if usageService == nil {
+		return true
+	}
+
+	summary, err := usageService.CheckQuota(c.Request.Context(), user.ID, userLocation(user), plannedRequests)
+	if err == models.ErrAIQuotaExceeded {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": err.Error(),
+			"data":  summary,
+		})
+		return false
+	}
+	if err != nil {
+		// 集計エラーでAI機能を止めないよう、ログのみ出力して続行
+		fmt.Printf("⚠️ AI利用上限の確認に失敗: %v\n", err)
+	}
+
+	return true
+}
+
+// recordAIUsage プロバイダー呼び出し1回分の利用量を記録（失敗してもリクエストは継続）
+func recordAIUsage(ctx context.Context, usageService *models.AIUsageService, provider llm.Provider, userID, messageID primitive.ObjectID, feature string, llmReq *llm.Request, resp *llm.Response) {
+	if usageService == nil || resp == nil {
+		return
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+
+	record := &models.AIUsageRecord{
+		UserID:           userID,
+		MessageID:        messageID,
+		Feature:          feature,
+		Tone:             llmReq.Metadata["tone"],
+		Provider:         provider.Name(),
+		Model:            model,
+		InputTokens:      int64(resp.Usage.InputTokens),
+		OutputTokens:     int64(resp.Usage.OutputTokens),
+		EstimatedCostUSD: llm.EstimateCostUSD(model, resp.Usage),
+	}
+	if err := usageService.Record(ctx, record); err != nil {
+		fmt.Printf("[%s] AI利用量の記録に失敗: %v\n", llmReq.Label(), err)
+	}
+}
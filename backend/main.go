@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"yanwari-message-backend/middleware"
 	"yanwari-message-backend/models"
 	"yanwari-message-backend/services"
+	"yanwari-message-backend/services/llm"
 )
 
 // サーバー起動時間を記録
@@ -56,6 +58,7 @@ func main() {
 	
 	// スケジュールサービスの初期化
 	scheduleService := models.NewScheduleService(db.Database, messageService)
+	userSettingsService := models.NewUserSettingsService(db.Database, userService)
 	
 	// インデックス作成
 	ctx := context.Background()
@@ -69,11 +72,53 @@ func main() {
 		log.Printf("警告: メッセージインデックス作成エラー: %v", err)
 	}
 
-	// 配信サービスの初期化
-	deliveryService := services.NewDeliveryService(messageService, scheduleService)
-	// 1分間隔でスケジュール配信をチェック
+	// 旧形式（固定3トーン）の variations を配列形式に移行
+	if migrated, err := messageService.MigrateLegacyVariations(ctx); err != nil {
+		log.Printf("警告: variations マイグレーションエラー: %v", err)
+	} else if migrated > 0 {
+		log.Printf("✅ variations マイグレーション完了: %d件", migrated)
+	}
+
+	// バックグラウンドジョブのリーダー選出（複数インスタンスのうち1つだけが定期ジョブを実行する）
+	jobLeaseService := models.NewJobLeaseService(db.Database)
+	instanceID := services.NewInstanceID()
+	leaderCtx, stopLeaderElection := context.WithCancel(context.Background())
+	defer stopLeaderElection()
+	deliveryLeader := services.NewLeaderElector(jobLeaseService, services.DeliveryJobName, instanceID, getDurationEnv("JOB_LEASE_TTL", 30*time.Second))
+	deliveryLeader.Start(leaderCtx)
+
+	// 配信サービスの初期化（アプリ内受信箱・メール・Webhook のうち受信者の設定で有効なチャネルに配信）
+	// 一時的な失敗は指数バックオフで再試行し、上限に達したメッセージは配信失敗（failed）にする
+	deliveryService := services.NewDeliveryService(messageService, userSettingsService, deliveryLeader,
+		services.NewDeliveryChannelsFromEnv(), services.DeliveryRetryPolicyFromEnv())
+	// 1分間隔でスケジュール配信をチェック（リーダーのインスタンスのみ）
 	deliveryService.Start(1 * time.Minute)
 
+	// outbox ディスパッチャーの初期化（メッセージの状態遷移と同じトランザクションで書き込んだイベントを購読者に配信）
+	outboxService := models.NewOutboxService(db.Database)
+	if err := outboxService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: outbox インデックス作成エラー: %v", err)
+	}
+	notificationService := models.NewNotificationService(db.Database)
+	if err := notificationService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: 通知インデックス作成エラー: %v", err)
+	}
+	outboxDispatcher := services.NewOutboxDispatcher(outboxService, instanceID,
+		services.NewScheduleSyncConsumer(scheduleService),
+		services.NewSenderNotificationConsumer(notificationService),
+		services.NewStatusWebhookConsumer(userSettingsService, services.NewWebhookChannelFromEnv()),
+	)
+	outboxDispatcher.Start(getDurationEnv("OUTBOX_DISPATCH_INTERVAL", 5*time.Second))
+
+	// LLMプロバイダーの初期化（LLM_PROVIDER で切り替え）
+	llmProvider, err := llm.NewProviderFromEnv(handlers.OfflineResponder)
+	if err != nil {
+		log.Printf("警告: LLMプロバイダー初期化エラー (AI機能は無効): %v", err)
+		llmProvider = nil
+	} else {
+		log.Printf("✅ LLMプロバイダー初期化完了: %s", llmProvider.Name())
+	}
+
 	// Ginルーターの初期化
 	r := gin.Default()
 
@@ -143,6 +188,7 @@ func main() {
 					"status": dbStatus,
 					"type":   "MongoDB Atlas",
 				},
+				"llm": llmHealth(llmProvider),
 			},
 		}
 
@@ -173,16 +219,59 @@ func main() {
 	}
 
 	// サービスの初期化
-	userSettingsService := models.NewUserSettingsService(db.Database, userService)
 	friendRequestService := models.NewFriendRequestService(db.Database)
 	friendshipService := models.NewFriendshipService(db.Database)
 	messageRatingService := models.NewMessageRatingService(db.Database)
+	transformCacheService := models.NewTransformCacheService(db.Database, getDurationEnv("TRANSFORM_CACHE_TTL", 24*time.Hour))
+	customToneService := models.NewCustomToneService(db.Database)
+	promptConfigService := models.NewPromptConfigService(db.Database)
+	experimentService := models.NewExperimentService(db.Database)
+	aiUsageService := models.NewAIUsageService(db.Database, models.AIQuota{
+		DailyTokens:     getInt64Env("AI_DAILY_TOKEN_LIMIT", 0),
+		MonthlyTokens:   getInt64Env("AI_MONTHLY_TOKEN_LIMIT", 0),
+		DailyRequests:   getInt64Env("AI_DAILY_REQUEST_LIMIT", 0),
+		MonthlyRequests: getInt64Env("AI_MONTHLY_REQUEST_LIMIT", 0),
+	})
 	
 	// ユーザー設定インデックス作成
 	if err := userSettingsService.CreateIndexes(ctx); err != nil {
 		log.Printf("警告: ユーザー設定インデックス作成エラー: %v", err)
 	}
 	
+	// トーン変換キャッシュのTTLインデックス作成
+	if err := transformCacheService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: トーン変換キャッシュインデックス作成エラー: %v", err)
+	}
+
+	// カスタムトーンインデックス作成
+	if err := customToneService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: カスタムトーンインデックス作成エラー: %v", err)
+	}
+
+	// プロンプト設定インデックス作成
+	if err := promptConfigService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: プロンプト設定インデックス作成エラー: %v", err)
+	}
+
+	// 有効なプロンプト設定のバージョンを反映（初回は設定ファイルをバージョン1として保存）
+	if err := promptConfigService.InitActiveVersion(ctx); err != nil {
+		log.Printf("警告: プロンプト設定のバージョン反映エラー (設定ファイルを使用): %v", err)
+	}
+	// 他のインスタンスで有効化されたバージョンを定期的に取り込む
+	syncCtx, stopPromptConfigSync := context.WithCancel(context.Background())
+	defer stopPromptConfigSync()
+	promptConfigService.StartSync(syncCtx, getDurationEnv("PROMPT_CONFIG_SYNC_INTERVAL", time.Minute))
+
+	// A/B 実験インデックス作成
+	if err := experimentService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: 実験インデックス作成エラー: %v", err)
+	}
+
+	// AI利用記録インデックス作成
+	if err := aiUsageService.CreateIndexes(ctx); err != nil {
+		log.Printf("警告: AI利用記録インデックス作成エラー: %v", err)
+	}
+
 	// Firebase UIDインデックス作成
 	if err := userService.CreateFirebaseUIDIndex(ctx); err != nil {
 		log.Printf("警告: Firebase UIDインデックス作成エラー: %v", err)
@@ -190,14 +279,20 @@ func main() {
 
 	// ハンドラーの初期化（JWT認証ハンドラーは廃止）
 	userHandler := handlers.NewUserHandler(userService)
-	messageHandler := handlers.NewMessageHandler(messageService)
-	transformHandler := handlers.NewTransformHandler(messageService)
-	scheduleHandler := handlers.NewScheduleHandler(scheduleService, messageService, deliveryService)
+	messageHandler := handlers.NewMessageHandler(messageService, deliveryService, llmProvider, aiUsageService)
+	transformHandler := handlers.NewTransformHandler(messageService, llmProvider, transformCacheService, aiUsageService, customToneService, promptConfigService, experimentService, friendshipService)
+	scheduleHandler := handlers.NewScheduleHandler(scheduleService, messageService, deliveryService, llmProvider, aiUsageService, userSettingsService)
+	usageHandler := handlers.NewUsageHandler(userService, aiUsageService)
+	customToneHandler := handlers.NewCustomToneHandler(userService, customToneService)
+	promptConfigHandler := handlers.NewPromptConfigHandler(userService, promptConfigService)
+	experimentHandler := handlers.NewExperimentHandler(userService, experimentService)
 	settingsHandler := handlers.NewSettingsHandler(userService, userSettingsService)
 	friendRequestHandler := handlers.NewFriendRequestHandler(userService, friendRequestService, friendshipService)
 	messageRatingHandler := handlers.NewMessageRatingHandler(messageRatingService, messageService)
 	dashboardHandler := handlers.NewDashboardHandler(messageService, userService)
 	testHandler := handlers.NewTestHandler(userService, messageService)
+	jobHandler := handlers.NewJobHandler(jobLeaseService, instanceID)
+	notificationHandler := handlers.NewNotificationHandler(userService, notificationService)
 	
 	// Firebase認証ハンドラーの初期化
 	var firebaseAuthHandler *handlers.FirebaseAuthHandler
@@ -229,7 +324,13 @@ func main() {
 		friendRequestHandler.RegisterRoutes(v1, firebaseMiddleware)
 		transformHandler.RegisterRoutes(v1, firebaseMiddleware)
 		scheduleHandler.RegisterRoutes(v1, firebaseMiddleware)
+		usageHandler.RegisterRoutes(v1, firebaseMiddleware)
+		customToneHandler.RegisterRoutes(v1, firebaseMiddleware)
+		promptConfigHandler.RegisterRoutes(v1, firebaseMiddleware)
+		experimentHandler.RegisterRoutes(v1, firebaseMiddleware)
 		settingsHandler.RegisterRoutes(v1, firebaseMiddleware)
+		jobHandler.RegisterRoutes(v1, firebaseMiddleware)
+		notificationHandler.RegisterRoutes(v1, firebaseMiddleware)
 		
 		// ダッシュボードエンドポイント
 		v1.GET("/dashboard", firebaseMiddleware, dashboardHandler.GetDashboard)
@@ -275,6 +376,9 @@ func main() {
 	// 配信サービスの停止
 	log.Println("Stopping delivery service...")
 	deliveryService.Stop()
+	outboxDispatcher.Stop()
+	// リーダーのリースを解放して他のインスタンスに引き継ぐ
+	stopLeaderElection()
 
 	// HTTPサーバーのグレースフルシャットダウン
 	if err := srv.Shutdown(ctx); err != nil {
@@ -285,4 +389,52 @@ func main() {
 
 	// データベース接続のクリーンアップは defer で既に設定済み
 	log.Println("Application shutdown complete")
-}
\ No newline at end of file
+}
+
+// getDurationEnv 環境変数から時間間隔を取得（未設定・不正な値の場合はデフォルト値）
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("警告: %s の値が不正です (%s)。デフォルト値 %v を使用します", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getInt64Env 環境変数から整数値を取得（未設定・不正な値の場合はデフォルト値）
+func getInt64Env(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("警告: %s の値が不正です (%s)。デフォルト値 %d を使用します", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// llmHealth LLMプロバイダーとサーキットブレーカーの状態
+// AI機能の障害ではサーバー全体を停止扱いにしないため、全体ステータスには反映しない
+func llmHealth(provider llm.Provider) gin.H {
+	if provider == nil {
+		return gin.H{"status": "disabled"}
+	}
+
+	health := gin.H{
+		"status":   "ok",
+		"provider": provider.Name(),
+	}
+	if breaker, ok := llm.ProviderBreakerStatus(provider); ok {
+		if breaker.State != llm.BreakerClosed {
+			health["status"] = "degraded"
+		}
+		health["circuitBreaker"] = breaker
+	}
+	return health
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin 管理者（運用担当者）のみ許可するミドルウェア（FirebaseAuthMiddleware の後に使う）
+// Firebase のカスタムクレーム admin が true のユーザー、または ADMIN_EMAILS（カンマ区切り）に含まれる確認済みメールアドレスのユーザーを管理者とする
+// どちらも設定されていない場合は誰も許可しない
+func RequireAdmin() gin.HandlerFunc {
+	adminEmails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			adminEmails[email] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		if !isAdmin(c, adminEmails) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "管理者のみ実行できます"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// isAdmin 認証済みユーザーが管理者か
+func isAdmin(c *gin.Context, adminEmails map[string]bool) bool {
+	if claims, ok := GetCustomClaims(c); ok {
+		if admin, ok := claims["admin"].(bool); ok && admin {
+			return true
+		}
+	}
+	email, ok := GetUserEmail(c)
+	if !ok || !IsEmailVerified(c) {
+		return false
+	}
+	return adminEmails[strings.ToLower(email)]
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AI機能の種別
+const (
+	AIFeatureToneTransform   = "tone_transform"
+	AIFeatureScheduleSuggest = "schedule_suggest"
+	AIFeatureToneRefine      = "tone_refine"
+	AIFeatureHarshness       = "harshness_analysis"
+	AIFeatureToneExplain     = "tone_explain"
+)
+
+// ErrAIQuotaExceeded AI利用上限超過エラー
+var ErrAIQuotaExceeded = errors.New("AI利用上限に達しました")
+
+// AIUsageRecord AIプロバイダー呼び出し1回分の利用記録
+type AIUsageRecord struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID `bson:"userId" json:"userId"`
+	MessageID        primitive.ObjectID `bson:"messageId,omitempty" json:"messageId,omitempty"`
+	Feature          string             `bson:"feature" json:"feature"`
+	Tone             string             `bson:"tone,omitempty" json:"tone,omitempty"`
+	Provider         string             `bson:"provider" json:"provider"`
+	Model            string             `bson:"model" json:"model"`
+	InputTokens      int64              `bson:"inputTokens" json:"inputTokens"`
+	OutputTokens     int64              `bson:"outputTokens" json:"outputTokens"`
+	EstimatedCostUSD float64            `bson:"estimatedCostUsd" json:"estimatedCostUsd"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// AIQuota AI利用上限（0 は無制限）
+type AIQuota struct {
+	DailyTokens     int64 `json:"dailyTokens"`
+	MonthlyTokens   int64 `json:"monthlyTokens"`
+	DailyRequests   int64 `json:"dailyRequests"`
+	MonthlyRequests int64 `json:"monthlyRequests"`
+}
+
+// AIUsageTotals 期間内の利用量集計
+type AIUsageTotals struct {
+	Requests         int64   `bson:"requests" json:"requests"`
+	InputTokens      int64   `bson:"inputTokens" json:"inputTokens"`
+	OutputTokens     int64   `bson:"outputTokens" json:"outputTokens"`
+	EstimatedCostUSD float64 `bson:"estimatedCostUsd" json:"estimatedCostUsd"`
+}
+
+// TotalTokens 入出力トークンの合計
+func (t AIUsageTotals) TotalTokens() int64 {
+	return t.InputTokens + t.OutputTokens
+}
+
+// AIUsageBreakdown 機能・トーン別の利用量
+type AIUsageBreakdown struct {
+	Feature       string `bson:"feature" json:"feature"`
+	Tone          string `bson:"tone" json:"tone,omitempty"`
+	AIUsageTotals `bson:",inline"`
+}
+
+// AIUsageRemaining 残り利用可能量（nil は無制限）
+type AIUsageRemaining struct {
+	DailyTokens     *int64 `json:"dailyTokens"`
+	MonthlyTokens   *int64 `json:"monthlyTokens"`
+	DailyRequests   *int64 `json:"dailyRequests"`
+	MonthlyRequests *int64 `json:"monthlyRequests"`
+}
+
+// AIUsageSummary ユーザーのAI利用状況
+type AIUsageSummary struct {
+	Daily       AIUsageTotals      `json:"daily"`
+	Monthly     AIUsageTotals      `json:"monthly"`
+	DailyFrom   time.Time          `json:"dailyFrom"`
+	MonthlyFrom time.Time          `json:"monthlyFrom"`
+	Breakdown   []AIUsageBreakdown `json:"breakdown"` // 当月の機能・トーン別内訳
+	Quota       AIQuota            `json:"quota"`
+	Remaining   AIUsageRemaining   `json:"remaining"`
+}
+
+// AIUsageService AI利用量の記録・上限管理サービス
+type AIUsageService struct {
+	collection *mongo.Collection
+	quota      AIQuota
+}
+
+// NewAIUsageService AI利用量サービスを作成
+func NewAIUsageService(db *mongo.Database, quota AIQuota) *AIUsageService {
+	return &AIUsageService{
+		collection: db.Collection("ai_usage"),
+		quota:      quota,
+	}
+}
+
+// Record 利用記録を追加
+func (s *AIUsageService) Record(ctx context.Context, record *AIUsageRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	result, err := s.collection.InsertOne(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	record.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetSummary 日次・月次の利用状況を取得（期間の区切りは loc のタイムゾーン）
+func (s *AIUsageService) GetSummary(ctx context.Context, userID primitive.ObjectID, loc *time.Location) (*AIUsageSummary, error) {
+	now := time.Now().In(loc)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+
+	daily, err := s.aggregateTotals(ctx, userID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+
+	monthly, err := s.aggregateTotals(ctx, userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown, err := s.aggregateBreakdown(ctx, userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AIUsageSummary{
+		Daily:       daily,
+		Monthly:     monthly,
+		DailyFrom:   dayStart,
+		MonthlyFrom: monthStart,
+		Breakdown:   breakdown,
+		Quota:       s.quota,
+		Remaining: AIUsageRemaining{
+			DailyTokens:     quotaRemaining(s.quota.DailyTokens, daily.TotalTokens()),
+			MonthlyTokens:   quotaRemaining(s.quota.MonthlyTokens, monthly.TotalTokens()),
+			DailyRequests:   quotaRemaining(s.quota.DailyRequests, daily.Requests),
+			MonthlyRequests: quotaRemaining(s.quota.MonthlyRequests, monthly.Requests),
+		},
+	}, nil
+}
+
+// CheckQuota プロバイダー呼び出し前に上限を確認
+// plannedRequests はこれから行う呼び出し回数（トーン数など）
+// 上限を超える場合は ErrAIQuotaExceeded と現在の利用状況を返す
+func (s *AIUsageService) CheckQuota(ctx context.Context, userID primitive.ObjectID, loc *time.Location, plannedRequests int) (*AIUsageSummary, error) {
+	summary, err := s.GetSummary(ctx, userID, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := int64(plannedRequests)
+	if quotaExceeded(s.quota.DailyTokens, summary.Daily.TotalTokens(), 0) ||
+		quotaExceeded(s.quota.MonthlyTokens, summary.Monthly.TotalTokens(), 0) ||
+		quotaExceeded(s.quota.DailyRequests, summary.Daily.Requests, planned) ||
+		quotaExceeded(s.quota.MonthlyRequests, summary.Monthly.Requests, planned) {
+		return summary, ErrAIQuotaExceeded
+	}
+
+	return summary, nil
+}
+
+// aggregateTotals 指定時刻以降の利用量を集計
+func (s *AIUsageService) aggregateTotals(ctx context.Context, userID primitive.ObjectID, since time.Time) (AIUsageTotals, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"userId":    userID,
+			"createdAt": bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":              nil,
+			"requests":         bson.M{"$sum": 1},
+			"inputTokens":      bson.M{"$sum": "$inputTokens"},
+			"outputTokens":     bson.M{"$sum": "$outputTokens"},
+			"estimatedCostUsd": bson.M{"$sum": "$estimatedCostUsd"},
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return AIUsageTotals{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals AIUsageTotals
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&totals); err != nil {
+			return AIUsageTotals{}, err
+		}
+	}
+
+	return totals, cursor.Err()
+}
+
+// aggregateBreakdown 指定時刻以降の機能・トーン別利用量を集計
+func (s *AIUsageService) aggregateBreakdown(ctx context.Context, userID primitive.ObjectID, since time.Time) ([]AIUsageBreakdown, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"userId":    userID,
+			"createdAt": bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":              bson.M{"feature": "$feature", "tone": "$tone"},
+			"requests":         bson.M{"$sum": 1},
+			"inputTokens":      bson.M{"$sum": "$inputTokens"},
+			"outputTokens":     bson.M{"$sum": "$outputTokens"},
+			"estimatedCostUsd": bson.M{"$sum": "$estimatedCostUsd"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":              0,
+			"feature":          "$_id.feature",
+			"tone":             "$_id.tone",
+			"requests":         1,
+			"inputTokens":      1,
+			"outputTokens":     1,
+			"estimatedCostUsd": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "feature", Value: 1}, {Key: "tone", Value: 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	breakdown := []AIUsageBreakdown{}
+	if err := cursor.All(ctx, &breakdown); err != nil {
+		return nil, err
+	}
+
+	return breakdown, nil
+}
+
+// CreateIndexes 利用記録コレクションのインデックスを作成
+func (s *AIUsageService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// quotaRemaining 残量を計算（上限0は無制限としてnil）
+func quotaRemaining(limit, used int64) *int64 {
+	if limit <= 0 {
+		return nil
+	}
+	left := limit - used
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
+
+// quotaExceeded 上限を超えるかを判定（上限0は無制限）
+func quotaExceeded(limit, used, planned int64) bool {
+	if limit <= 0 {
+		return false
+	}
+	if planned == 0 {
+		return used >= limit
+	}
+	return used+planned > limit
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CustomToneKeyPrefix カスタムトーンのトーンキーの接頭辞（グローバルトーンとの衝突を防ぐ）
+const CustomToneKeyPrefix = "custom_"
+
+// カスタムトーンの登録上限
+const (
+	MaxCustomTonesPerUser         = 20
+	MaxCustomToneCharacteristics  = 15
+	MaxCustomToneExamples         = 5
+	MaxCustomToneDisplayNameRunes = 30
+)
+
+// ErrCustomToneLimitExceeded カスタムトーン登録数の上限超過エラー
+var ErrCustomToneLimitExceeded = errors.New("カスタムトーンの登録数が上限に達しています")
+
+// CustomToneExample カスタムトーンの例文
+type CustomToneExample struct {
+	Input  string `bson:"input" json:"input" binding:"required"`
+	Output string `bson:"output" json:"output" binding:"required"`
+}
+
+// CustomTone ユーザー定義のトーン
+type CustomTone struct {
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID          primitive.ObjectID  `bson:"userId" json:"userId"`
+	Key             string              `bson:"key" json:"key"` // トーン変換で指定するキー（custom_<ID>）
+	DisplayName     string              `bson:"displayName" json:"displayName"`
+	Description     string              `bson:"description,omitempty" json:"description,omitempty"`
+	Characteristics []string            `bson:"characteristics" json:"characteristics"`
+	Examples        []CustomToneExample `bson:"examples,omitempty" json:"examples,omitempty"`
+	CreatedAt       time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// CustomToneRequest カスタムトーン作成・更新リクエスト
+type CustomToneRequest struct {
+	DisplayName     string              `json:"displayName" binding:"required"`
+	Description     string              `json:"description,omitempty"`
+	Characteristics []string            `json:"characteristics" binding:"required,min=1"`
+	Examples        []CustomToneExample `json:"examples,omitempty" binding:"omitempty,dive"`
+}
+
+// Validate リクエスト内容を検証し、前後の空白を除去
+func (r *CustomToneRequest) Validate() error {
+	r.DisplayName = strings.TrimSpace(r.DisplayName)
+	if r.DisplayName == "" {
+		return errors.New("表示名を入力してください")
+	}
+	if len([]rune(r.DisplayName)) > MaxCustomToneDisplayNameRunes {
+		return errors.New("表示名が長すぎます")
+	}
+	r.Description = strings.TrimSpace(r.Description)
+
+	characteristics := make([]string, 0, len(r.Characteristics))
+	for _, c := range r.Characteristics {
+		if c = strings.TrimSpace(c); c != "" {
+			characteristics = append(characteristics, c)
+		}
+	}
+	if len(characteristics) == 0 {
+		return errors.New("特徴を1つ以上入力してください")
+	}
+	if len(characteristics) > MaxCustomToneCharacteristics {
+		return errors.New("特徴の数が多すぎます")
+	}
+	r.Characteristics = characteristics
+
+	if len(r.Examples) > MaxCustomToneExamples {
+		return errors.New("例文の数が多すぎます")
+	}
+	return nil
+}
+
+// IsCustomToneKey カスタムトーンのキーかどうか
+func IsCustomToneKey(key string) bool {
+	return strings.HasPrefix(key, CustomToneKeyPrefix)
+}
+
+// CustomToneService カスタムトーンサービス
+type CustomToneService struct {
+	collection *mongo.Collection
+}
+
+// NewCustomToneService カスタムトーンサービスを作成
+func NewCustomToneService(db *mongo.Database) *CustomToneService {
+	return &CustomToneService{
+		collection: db.Collection("custom_tones"),
+	}
+}
+
+// CreateCustomTone カスタムトーンを作成
+func (s *CustomToneService) CreateCustomTone(ctx context.Context, userID primitive.ObjectID, req *CustomToneRequest) (*CustomTone, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxCustomTonesPerUser {
+		return nil, ErrCustomToneLimitExceeded
+	}
+
+	now := time.Now()
+	id := primitive.NewObjectID()
+	tone := &CustomTone{
+		ID:              id,
+		UserID:          userID,
+		Key:             CustomToneKeyPrefix + id.Hex(),
+		DisplayName:     req.DisplayName,
+		Description:     req.Description,
+		Characteristics: req.Characteristics,
+		Examples:        req.Examples,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	if _, err := s.collection.InsertOne(ctx, tone); err != nil {
+		return nil, err
+	}
+
+	return tone, nil
+}
+
+// GetCustomTones ユーザーのカスタムトーン一覧を取得（作成順）
+func (s *CustomToneService) GetCustomTones(ctx context.Context, userID primitive.ObjectID) ([]CustomTone, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tones := []CustomTone{}
+	if err := cursor.All(ctx, &tones); err != nil {
+		return nil, err
+	}
+
+	return tones, nil
+}
+
+// GetCustomTonesByKeys ユーザーのカスタムトーンをキーで取得
+func (s *CustomToneService) GetCustomTonesByKeys(ctx context.Context, userID primitive.ObjectID, keys []string) (map[string]CustomTone, error) {
+	result := make(map[string]CustomTone)
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"userId": userID,
+		"key":    bson.M{"$in": keys},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tones []CustomTone
+	if err := cursor.All(ctx, &tones); err != nil {
+		return nil, err
+	}
+	for _, tone := range tones {
+		result[tone.Key] = tone
+	}
+
+	return result, nil
+}
+
+// UpdateCustomTone カスタムトーンを更新（本人のトーンのみ）
+func (s *CustomToneService) UpdateCustomTone(ctx context.Context, toneID, userID primitive.ObjectID, req *CustomToneRequest) (*CustomTone, error) {
+	filter := bson.M{"_id": toneID, "userId": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"displayName":     req.DisplayName,
+			"description":     req.Description,
+			"characteristics": req.Characteristics,
+			"examples":        req.Examples,
+			"updatedAt":       time.Now(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var tone CustomTone
+	if err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&tone); err != nil {
+		return nil, err
+	}
+
+	return &tone, nil
+}
+
+// DeleteCustomTone カスタムトーンを削除（本人のトーンのみ）
+// 既に生成済みのメッセージの変換結果はそのまま残る
+func (s *CustomToneService) DeleteCustomTone(ctx context.Context, toneID, userID primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": toneID, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// CreateIndexes カスタムトーンコレクションのインデックスを作成
+func (s *CustomToneService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "key", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "createdAt", Value: 1},
+			},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
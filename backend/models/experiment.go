@@ -0,0 +1,427 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"yanwari-message-backend/config"
+)
+
+// ExperimentStatus 実験の状態
+type ExperimentStatus string
+
+const (
+	ExperimentDraft   ExperimentStatus = "draft"   // 作成済み（未開始）
+	ExperimentRunning ExperimentStatus = "running" // 実施中（トーン変換で群を割り当てる）
+	ExperimentStopped ExperimentStatus = "stopped" // 終了（結果の集計のみ可能）
+)
+
+// 実験の定義に関するエラー
+var (
+	ErrExperimentConflict      = errors.New("このトーンには既に実施中の実験があります")
+	ErrExperimentInvalidStatus = errors.New("この状態の実験は操作できません")
+)
+
+// experimentKeyPattern 実験キーに使える文字
+var experimentKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// ExperimentArm 実験の群（プロンプト・モデルの組み合わせ）
+// 空の項目は tone_prompts.yaml の設定をそのまま使う（すべて空の群は対照群になる）
+type ExperimentArm struct {
+	Name                string   `bson:"name" json:"name" binding:"required"`
+	Weight              int      `bson:"weight" json:"weight"` // 割り当て比率（0以下の場合は1）
+	InstructionTemplate string   `bson:"instructionTemplate,omitempty" json:"instructionTemplate,omitempty"`
+	Characteristics     []string `bson:"characteristics,omitempty" json:"characteristics,omitempty"`
+	Model               string   `bson:"model,omitempty" json:"model,omitempty"`
+	MaxTokens           int      `bson:"maxTokens,omitempty" json:"maxTokens,omitempty"`
+}
+
+// Apply 群の設定をトーン定義とモデル設定に上書きする
+func (a ExperimentArm) Apply(tone config.Tone, model config.AIModelConfig) (config.Tone, config.AIModelConfig) {
+	if a.InstructionTemplate != "" {
+		tone.InstructionTemplate = a.InstructionTemplate
+	}
+	if len(a.Characteristics) > 0 {
+		tone.Characteristics = a.Characteristics
+	}
+	if a.Model != "" {
+		model.Name = a.Model
+	}
+	if a.MaxTokens > 0 {
+		model.MaxTokens = a.MaxTokens
+	}
+	return tone, model
+}
+
+// Experiment トーンのプロンプト・モデルを比較する A/B 実験
+type Experiment struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key         string             `bson:"key" json:"key"` // 割り当てのハッシュにも使う一意なキー
+	Tone        string             `bson:"tone" json:"tone"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Arms        []ExperimentArm    `bson:"arms" json:"arms"`
+	Status      ExperimentStatus   `bson:"status" json:"status"`
+	CreatedBy   string             `bson:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	StartedAt   *time.Time         `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	StoppedAt   *time.Time         `bson:"stoppedAt,omitempty" json:"stoppedAt,omitempty"`
+}
+
+// ExperimentAssignment 変換結果に記録する実験の割り当て
+type ExperimentAssignment struct {
+	ExperimentID primitive.ObjectID `bson:"experimentId" json:"experimentId"`
+	Key          string             `bson:"key" json:"key"`
+	Arm          string             `bson:"arm" json:"arm"`
+}
+
+// Assign ユーザーを群に割り当てる
+// 実験キーとユーザーIDのハッシュで決まるため、同じユーザーは常に同じ群になる
+func (e *Experiment) Assign(userID primitive.ObjectID) ExperimentArm {
+	total := 0
+	for _, arm := range e.Arms {
+		total += armWeight(arm)
+	}
+
+	sum := sha256.Sum256([]byte(e.Key + ":" + userID.Hex()))
+	point := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, arm := range e.Arms {
+		point -= armWeight(arm)
+		if point < 0 {
+			return arm
+		}
+	}
+	return e.Arms[len(e.Arms)-1]
+}
+
+// Assignment 群の割り当てを記録用の形式で取得
+func (e *Experiment) Assignment(arm ExperimentArm) ExperimentAssignment {
+	return ExperimentAssignment{ExperimentID: e.ID, Key: e.Key, Arm: arm.Name}
+}
+
+// armWeight 群の割り当て比率（0以下の場合は1）
+func armWeight(arm ExperimentArm) int {
+	if arm.Weight <= 0 {
+		return 1
+	}
+	return arm.Weight
+}
+
+// ExperimentRequest 実験作成リクエスト
+type ExperimentRequest struct {
+	Key         string          `json:"key" binding:"required"`
+	Tone        string          `json:"tone" binding:"required"`
+	Description string          `json:"description,omitempty"`
+	Arms        []ExperimentArm `json:"arms" binding:"required,min=2,dive"`
+}
+
+// Validate リクエスト内容を検証
+func (r *ExperimentRequest) Validate() error {
+	r.Key = strings.TrimSpace(r.Key)
+	if !experimentKeyPattern.MatchString(r.Key) {
+		return errors.New("実験キーは英小文字・数字・'-'・'_' で50文字以内にしてください")
+	}
+	// 実験の対象は tone_prompts.yaml のトーンのみ
+	r.Tone = strings.TrimSpace(r.Tone)
+	toneConfig := config.CurrentToneConfig()
+	if toneConfig == nil {
+		return errors.New("トーン設定が読み込まれていません")
+	}
+	if _, ok := toneConfig.Tones[r.Tone]; !ok {
+		return fmt.Errorf("サポートされていないトーンです: %s", r.Tone)
+	}
+	if len(r.Arms) < 2 {
+		return errors.New("群は2つ以上指定してください")
+	}
+
+	names := make(map[string]bool, len(r.Arms))
+	for i := range r.Arms {
+		arm := &r.Arms[i]
+		arm.Name = strings.TrimSpace(arm.Name)
+		if arm.Name == "" {
+			return errors.New("群の名前を入力してください")
+		}
+		if names[arm.Name] {
+			return fmt.Errorf("群の名前が重複しています: %s", arm.Name)
+		}
+		names[arm.Name] = true
+
+		if arm.InstructionTemplate != "" {
+			if _, err := template.New(arm.Name).Parse(arm.InstructionTemplate); err != nil {
+				return fmt.Errorf("群 %s のテンプレートが不正です: %w", arm.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExperimentArmReport 群ごとの集計結果
+type ExperimentArmReport struct {
+	Arm           string   `bson:"_id" json:"arm"`
+	SampleSize    int64    `bson:"sampleSize" json:"sampleSize"` // 生成された変換結果の数
+	Decided       int64    `bson:"decided" json:"decided"`       // うちトーンが選択済みのメッセージ数
+	Selected      int64    `bson:"selected" json:"selected"`     // うちこの群の変換結果が選ばれた数
+	SelectionRate float64  `bson:"-" json:"selectionRate"`       // Selected / Decided
+	RatedCount    int64    `bson:"ratedCount" json:"ratedCount"` // 選ばれた変換結果のうち受信者が評価した数
+	MeanRating    *float64 `bson:"meanRating" json:"meanRating"` // 評価の平均（評価が無い場合は null）
+}
+
+// ExperimentReport 実験の集計結果
+type ExperimentReport struct {
+	Experiment  *Experiment           `json:"experiment"`
+	Arms        []ExperimentArmReport `json:"arms"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+}
+
+// experimentCacheTTL 実施中の実験一覧をキャッシュする時間
+const experimentCacheTTL = 30 * time.Second
+
+// ExperimentService A/B 実験サービス
+type ExperimentService struct {
+	collection *mongo.Collection
+	messages   *mongo.Collection
+
+	// トーン変換のたびに問い合わせないよう、実施中の実験をトーン別にキャッシュする
+	mu       sync.Mutex
+	running  map[string]*Experiment
+	loadedAt time.Time
+}
+
+// NewExperimentService 実験サービスを作成
+func NewExperimentService(db *mongo.Database) *ExperimentService {
+	return &ExperimentService{
+		collection: db.Collection("experiments"),
+		messages:   db.Collection("messages"),
+	}
+}
+
+// CreateExperiment 実験を作成（開始はしない）
+func (s *ExperimentService) CreateExperiment(ctx context.Context, req *ExperimentRequest, createdBy string) (*Experiment, error) {
+	experiment := &Experiment{
+		ID:          primitive.NewObjectID(),
+		Key:         req.Key,
+		Tone:        req.Tone,
+		Description: req.Description,
+		Arms:        req.Arms,
+		Status:      ExperimentDraft,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+
+	if _, err := s.collection.InsertOne(ctx, experiment); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("実験キーが重複しています: %s", req.Key)
+		}
+		return nil, err
+	}
+	return experiment, nil
+}
+
+// GetExperiment 実験を取得
+func (s *ExperimentService) GetExperiment(ctx context.Context, id primitive.ObjectID) (*Experiment, error) {
+	var experiment Experiment
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&experiment); err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// ListExperiments 実験一覧を新しい順に取得
+func (s *ExperimentService) ListExperiments(ctx context.Context) ([]Experiment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	experiments := []Experiment{}
+	if err := cursor.All(ctx, &experiments); err != nil {
+		return nil, err
+	}
+	return experiments, nil
+}
+
+// StartExperiment 実験を開始（同じトーンで実施中の実験がある場合はエラー）
+func (s *ExperimentService) StartExperiment(ctx context.Context, id primitive.ObjectID) (*Experiment, error) {
+	experiment, err := s.GetExperiment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if experiment.Status != ExperimentDraft {
+		return nil, ErrExperimentInvalidStatus
+	}
+
+	count, err := s.collection.CountDocuments(ctx, bson.M{"tone": experiment.Tone, "status": ExperimentRunning})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrExperimentConflict
+	}
+
+	return s.updateStatus(ctx, id, ExperimentDraft, bson.M{"status": ExperimentRunning, "startedAt": time.Now()})
+}
+
+// StopExperiment 実験を終了
+func (s *ExperimentService) StopExperiment(ctx context.Context, id primitive.ObjectID) (*Experiment, error) {
+	return s.updateStatus(ctx, id, ExperimentRunning, bson.M{"status": ExperimentStopped, "stoppedAt": time.Now()})
+}
+
+// updateStatus 状態が from の場合のみ更新し、実施中の実験のキャッシュを破棄する
+func (s *ExperimentService) updateStatus(ctx context.Context, id primitive.ObjectID, from ExperimentStatus, set bson.M) (*Experiment, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var experiment Experiment
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set}, opts).Decode(&experiment)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := s.GetExperiment(ctx, id); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrExperimentInvalidStatus
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.running = nil
+	s.mu.Unlock()
+
+	return &experiment, nil
+}
+
+// RunningExperiment トーンで実施中の実験を取得（無い場合は nil）
+// 他のインスタンスでの開始・終了は最大 experimentCacheTTL 遅れて反映される
+func (s *ExperimentService) RunningExperiment(ctx context.Context, tone string) (*Experiment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running == nil || time.Since(s.loadedAt) > experimentCacheTTL {
+		cursor, err := s.collection.Find(ctx, bson.M{"status": ExperimentRunning})
+		if err != nil {
+			return nil, err
+		}
+		var experiments []Experiment
+		if err := cursor.All(ctx, &experiments); err != nil {
+			return nil, err
+		}
+
+		running := make(map[string]*Experiment, len(experiments))
+		for i := range experiments {
+			running[experiments[i].Tone] = &experiments[i]
+		}
+		s.running = running
+		s.loadedAt = time.Now()
+	}
+
+	return s.running[tone], nil
+}
+
+// GetReport 群ごとのサンプル数・選択率・平均評価を集計
+// 変換結果に記録された割り当てを、メッセージの選択トーンと受信者の評価（MessageRating）に結合する
+func (s *ExperimentService) GetReport(ctx context.Context, id primitive.ObjectID) (*ExperimentReport, error) {
+	experiment, err := s.GetExperiment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"variations.experiment.experimentId": id}}},
+		{{Key: "$unwind", Value: "$variations"}},
+		{{Key: "$match", Value: bson.M{"variations.experiment.experimentId": id}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "message_ratings",
+			"localField":   "_id",
+			"foreignField": "messageId",
+			"as":           "ratings",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"arm":      "$variations.experiment.arm",
+			"decided":  bson.M{"$gt": bson.A{bson.M{"$strLenCP": bson.M{"$ifNull": bson.A{"$selectedTone", ""}}}, 0}},
+			"selected": bson.M{"$eq": bson.A{"$selectedTone", "$variations.tone"}},
+			"rating":   bson.M{"$avg": "$ratings.rating"},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$arm",
+			"sampleSize": bson.M{"$sum": 1},
+			"decided":    bson.M{"$sum": bson.M{"$cond": bson.A{"$decided", 1, 0}}},
+			"selected":   bson.M{"$sum": bson.M{"$cond": bson.A{"$selected", 1, 0}}},
+			"ratedCount": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{"$selected", bson.M{"$ne": bson.A{"$rating", nil}}}}, 1, 0,
+			}}},
+			// 選ばれなかった変換結果の評価は群の評価ではないため除く（$avg は null を無視する）
+			"meanRating": bson.M{"$avg": bson.M{"$cond": bson.A{"$selected", "$rating", nil}}},
+		}}},
+	}
+
+	cursor, err := s.messages.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []ExperimentArmReport
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	byArm := make(map[string]ExperimentArmReport, len(results))
+	for _, result := range results {
+		byArm[result.Arm] = result
+	}
+
+	// データの無い群も含め、定義順に並べる
+	arms := make([]ExperimentArmReport, 0, len(experiment.Arms))
+	for _, arm := range experiment.Arms {
+		report, ok := byArm[arm.Name]
+		if !ok {
+			report = ExperimentArmReport{Arm: arm.Name}
+		}
+		if report.Decided > 0 {
+			report.SelectionRate = float64(report.Selected) / float64(report.Decided)
+		}
+		arms = append(arms, report)
+	}
+
+	return &ExperimentReport{
+		Experiment:  experiment,
+		Arms:        arms,
+		GeneratedAt: time.Now(),
+	}, nil
+}
+
+// CreateIndexes 実験コレクションとメッセージの集計用インデックスを作成
+func (s *ExperimentService) CreateIndexes(ctx context.Context) error {
+	if _, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tone", Value: 1},
+				{Key: "status", Value: 1},
+			},
+		},
+	}); err != nil {
+		return err
+	}
+
+	_, err := s.messages.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "variations.experiment.experimentId", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FriendRelationship はユーザーが友達ごとに登録する関係（トーン変換で受信者との距離感を決めるのに使う）
+type FriendRelationship struct {
+	Type      string    `bson:"type" json:"type"`                       // 関係の種類（FriendRelationshipTypes のキー）
+	Label     string    `bson:"label" json:"label"`                     // 関係の表示名
+	Notes     string    `bson:"notes,omitempty" json:"notes,omitempty"` // 補足（「厳しめの上司」「敬語は苦手」など）
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// FriendRelationshipType は登録できる関係の種類
+type FriendRelationshipType struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// FriendRelationshipTypes は登録できる関係の一覧（表示順）
+// キーは tone_prompts.yaml の relationship_guidance と対応する
+var FriendRelationshipTypes = []FriendRelationshipType{
+	{Key: "boss", Label: "上司"},
+	{Key: "senior", Label: "先輩"},
+	{Key: "colleague", Label: "同僚"},
+	{Key: "junior", Label: "後輩"},
+	{Key: "subordinate", Label: "部下"},
+	{Key: "client", Label: "取引先"},
+	{Key: "friend", Label: "友人"},
+	{Key: "close_friend", Label: "親友"},
+	{Key: "family", Label: "家族"},
+	{Key: "partner", Label: "パートナー"},
+	{Key: "other", Label: "その他"},
+}
+
+// ErrFriendshipNotFound は友達関係が存在しない
+var ErrFriendshipNotFound = errors.New("友達関係が見つかりません")
+
+// NewFriendRelationship は関係の種類を検証して FriendRelationship を作成
+func NewFriendRelationship(relationshipType, notes string) (*FriendRelationship, error) {
+	for _, t := range FriendRelationshipTypes {
+		if t.Key == relationshipType {
+			return &FriendRelationship{Type: t.Key, Label: t.Label, Notes: notes, UpdatedAt: time.Now()}, nil
+		}
+	}
+	return nil, errors.New("サポートされていない関係です: " + relationshipType)
+}
+
+// relationshipField はユーザーが登録した関係を保存するフィールド名
+func (s *FriendshipService) relationshipField(userID, user1ID primitive.ObjectID) string {
+	if userID == user1ID {
+		return "user1_relationship"
+	}
+	return "user2_relationship"
+}
+
+// SetRelationship はユーザーから見た友達との関係を登録（relationship が nil の場合は登録を解除）
+func (s *FriendshipService) SetRelationship(ctx context.Context, userID, friendID primitive.ObjectID, relationship *FriendRelationship) error {
+	user1ID, user2ID := s.normalizeUserIDs(userID, friendID)
+	field := s.relationshipField(userID, user1ID)
+
+	update := bson.M{"$set": bson.M{field: relationship}}
+	if relationship == nil {
+		update = bson.M{"$unset": bson.M{field: ""}}
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{
+		"user1_id": user1ID,
+		"user2_id": user2ID,
+	}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrFriendshipNotFound
+	}
+	return nil
+}
+
+// GetRelationship はユーザーから見た友達との関係を取得（友達でない場合・未登録の場合は nil）
+func (s *FriendshipService) GetRelationship(ctx context.Context, userID, friendID primitive.ObjectID) (*FriendRelationship, error) {
+	user1ID, user2ID := s.normalizeUserIDs(userID, friendID)
+
+	var friendship Friendship
+	err := s.collection.FindOne(ctx, bson.M{
+		"user1_id": user1ID,
+		"user2_id": user2ID,
+	}).Decode(&friendship)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == user1ID {
+		return friendship.User1Relationship, nil
+	}
+	return friendship.User2Relationship, nil
+}
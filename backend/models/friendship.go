@@ -17,13 +17,18 @@ type Friendship struct {
 	User1ID   primitive.ObjectID `bson:"user1_id" json:"user1_id"` // 小さいID
 	User2ID   primitive.ObjectID `bson:"user2_id" json:"user2_id"` // 大きいID
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+
+	// 関係は一方向（user1 から見た user2 が上司でも、user2 から見た user1 は部下）のため、ユーザーごとに保持する
+	User1Relationship *FriendRelationship `bson:"user1_relationship,omitempty" json:"user1_relationship,omitempty"` // user1 が登録した user2 との関係
+	User2Relationship *FriendRelationship `bson:"user2_relationship,omitempty" json:"user2_relationship,omitempty"` // user2 が登録した user1 との関係
 }
 
 // FriendshipWithUser は友達関係とユーザー情報を含む構造体
 type FriendshipWithUser struct {
-	FriendshipID primitive.ObjectID `json:"friendship_id"`
-	Friend       *User              `json:"friend"`
-	CreatedAt    time.Time          `json:"created_at"`
+	FriendshipID primitive.ObjectID  `json:"friendship_id"`
+	Friend       *User               `json:"friend"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Relationship *FriendRelationship `json:"relationship,omitempty"` // 自分が登録した友達との関係
 }
 
 // FriendshipService は友達関係に関する操作を提供
@@ -141,6 +146,13 @@ func (s *FriendshipService) GetFriends(ctx context.Context, userID primitive.Obj
 		{{Key: "$project", Value: bson.M{
 			"_id":        1,
 			"created_at": 1,
+			"relationship": bson.M{
+				"$cond": bson.M{
+					"if":   bson.M{"$eq": []interface{}{"$user1_id", userID}},
+					"then": "$user1_relationship",
+					"else": "$user2_relationship",
+				},
+			},
 			"friend_id": bson.M{
 				"$cond": bson.M{
 					"if":   bson.M{"$eq": []interface{}{"$user1_id", userID}},
@@ -173,9 +185,10 @@ func (s *FriendshipService) GetFriends(ctx context.Context, userID primitive.Obj
 	var friends []*FriendshipWithUser
 	for cursor.Next(ctx) {
 		var result struct {
-			ID        primitive.ObjectID `bson:"_id"`
-			CreatedAt time.Time          `bson:"created_at"`
-			Friend    User               `bson:"friend"`
+			ID           primitive.ObjectID  `bson:"_id"`
+			CreatedAt    time.Time           `bson:"created_at"`
+			Friend       User                `bson:"friend"`
+			Relationship *FriendRelationship `bson:"relationship"`
 		}
 		
 		if err := cursor.Decode(&result); err != nil {
@@ -186,6 +199,7 @@ func (s *FriendshipService) GetFriends(ctx context.Context, userID primitive.Obj
 			FriendshipID: result.ID,
 			Friend:       &result.Friend,
 			CreatedAt:    result.CreatedAt,
+			Relationship: result.Relationship,
 		})
 	}
 	
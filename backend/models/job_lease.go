@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobLease バックグラウンドジョブのリーダーのリース（ジョブごとに1件）
+// リーダーは期限が切れる前に更新し続け、更新が止まって期限が切れると他のインスタンスがリーダーになれる
+// 期限の判定は各インスタンスの時刻で行うため、インスタンス間の時刻のずれはTTLより十分小さいこと
+type JobLease struct {
+	Name       string    `bson:"_id" json:"name"`                // ジョブ名
+	Holder     string    `bson:"holder" json:"holder"`           // リーダーのインスタンスID
+	AcquiredAt time.Time `bson:"acquiredAt" json:"acquiredAt"`   // 現在のリーダーがリースを取得した日時
+	RenewedAt  time.Time `bson:"renewedAt" json:"lastHeartbeat"` // 最後に更新した日時（ハートビート）
+	ExpiresAt  time.Time `bson:"expiresAt" json:"expiresAt"`
+	// Active リースが期限内か（一覧の取得時に計算）
+	Active bool `bson:"-" json:"active"`
+}
+
+// JobLeaseService バックグラウンドジョブのリーダー選出用のリースを管理
+type JobLeaseService struct {
+	collection *mongo.Collection
+}
+
+// NewJobLeaseService リースサービスを作成
+func NewJobLeaseService(db *mongo.Database) *JobLeaseService {
+	return &JobLeaseService{
+		collection: db.Collection("job_leases"),
+	}
+}
+
+// Acquire ジョブのリースを取得・更新する（取得できた場合は true）
+// 自分が保持しているリース・期限切れのリース・まだ無いリースのみ取得できる
+// 他のインスタンスが期限内のリースを保持している場合は条件に一致せず upsert が _id の重複になるため false を返す
+func (s *JobLeaseService) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*JobLease, bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"holder": holder},
+			{"expiresAt": bson.M{"$lte": now}},
+		},
+	}
+	// 更新の場合は取得日時を保ち、リーダーが替わった場合・新規作成の場合のみ現在時刻にする
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"acquiredAt": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$holder", holder}}, "$acquiredAt", now}},
+			"holder":     holder,
+			"renewedAt":  now,
+			"expiresAt":  now.Add(ttl),
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var lease JobLease
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&lease)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	lease.Active = true
+	return &lease, true, nil
+}
+
+// Release 自分が保持しているリースを解放する（停止時に他のインスタンスがすぐリーダーになれるようにする）
+func (s *JobLeaseService) Release(ctx context.Context, name, holder string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	return err
+}
+
+// ListLeases 全ジョブのリースを取得（ジョブ名順）
+func (s *JobLeaseService) ListLeases(ctx context.Context) ([]JobLease, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	leases := []JobLease{}
+	if err := cursor.All(ctx, &leases); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range leases {
+		leases[i].Active = now.Before(leases[i].ExpiresAt)
+	}
+	return leases, nil
+}
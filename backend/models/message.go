@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,21 +15,38 @@ import (
 
 // Message やんわり伝言のメッセージモデル
 type Message struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	SenderID     primitive.ObjectID `bson:"senderId" json:"senderId"`
-	RecipientID  primitive.ObjectID `bson:"recipientId,omitempty" json:"recipientId,omitempty"`
-	OriginalText string             `bson:"originalText" json:"originalText"`
-	Reason       string             `bson:"reason,omitempty" json:"reason,omitempty"`
-	Variations   MessageVariations  `bson:"variations" json:"variations"`
-	SelectedTone string             `bson:"selectedTone,omitempty" json:"selectedTone,omitempty"`
-	FinalText    string             `bson:"finalText,omitempty" json:"finalText,omitempty"`
-	ScheduledAt  *time.Time         `bson:"scheduledAt,omitempty" json:"scheduledAt,omitempty"`
-	Status       MessageStatus      `bson:"status" json:"status"`
-	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
-	SentAt       *time.Time         `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
-	DeliveredAt  *time.Time         `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
-	ReadAt       *time.Time         `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	ID                 primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	SenderID           primitive.ObjectID  `bson:"senderId" json:"senderId"`
+	RecipientID        primitive.ObjectID  `bson:"recipientId,omitempty" json:"recipientId,omitempty"`
+	OriginalText       string              `bson:"originalText" json:"originalText"`
+	Reason             string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	Variations         MessageVariations   `bson:"variations" json:"variations"`
+	FailedTones        []string            `bson:"failedTones,omitempty" json:"failedTones,omitempty"` // 変換に失敗し再試行待ちのトーン
+	SelectedTone       string              `bson:"selectedTone,omitempty" json:"selectedTone,omitempty"`
+	FinalText          string              `bson:"finalText,omitempty" json:"finalText,omitempty"`
+	SelectedRevisionID *primitive.ObjectID `bson:"selectedRevisionId,omitempty" json:"selectedRevisionId,omitempty"` // 最終テキストとして選択した改訂（変換結果をそのまま選んだ場合は nil）
+	Refinements        []ToneRefinement    `bson:"refinements,omitempty" json:"refinements,omitempty"`               // 追加指示による改訂履歴
+	Analysis           *MessageAnalysis    `bson:"analysis,omitempty" json:"analysis,omitempty"`                     // 直近に分析したテキストの強さの分析結果
+	ScheduledAt        *time.Time          `bson:"scheduledAt,omitempty" json:"scheduledAt,omitempty"`
+	Status             MessageStatus       `bson:"status" json:"status"`
+	CreatedAt          time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt          time.Time           `bson:"updatedAt" json:"updatedAt"`
+	SentAt             *time.Time          `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+	DeliveredAt        *time.Time          `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	ReadAt             *time.Time          `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	DeliveryClaim      *DeliveryClaim      `bson:"deliveryClaim,omitempty" json:"-"` // 配信ワーカーによる確保（配信中のみ）
+	// DeliveredChannels 配信に成功したチャネル（再試行時に同じチャネルへ再送しない）
+	DeliveredChannels []string `bson:"deliveredChannels,omitempty" json:"deliveredChannels,omitempty"`
+	// ChannelFailures 受信箱以外のチャネルへの配信失敗（チャネル名 → 失敗内容、成功すると削除）
+	ChannelFailures map[string]ChannelFailure `bson:"channelFailures,omitempty" json:"channelFailures,omitempty"`
+	// DeliveryAttempts 失敗した配信の試行回数
+	DeliveryAttempts int `bson:"deliveryAttempts,omitempty" json:"deliveryAttempts,omitempty"`
+	// NextAttemptAt 次に配信を試行する日時（配信に失敗して再試行を待っている場合のみ）
+	NextAttemptAt *time.Time `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	// LastDeliveryError 直近の配信失敗の原因
+	LastDeliveryError string `bson:"lastDeliveryError,omitempty" json:"lastDeliveryError,omitempty"`
+	// FailedAt 配信失敗（failed）になった日時
+	FailedAt *time.Time `bson:"failedAt,omitempty" json:"failedAt,omitempty"`
 }
 
 // MessageWithSender 送信者情報を含むメッセージ
@@ -39,13 +56,6 @@ type MessageWithSender struct {
 	SenderName  string `json:"senderName,omitempty"`
 }
 
-// MessageVariations AIトーン変換結果
-type MessageVariations struct {
-	Gentle       string `bson:"gentle,omitempty" json:"gentle,omitempty"`
-	Constructive string `bson:"constructive,omitempty" json:"constructive,omitempty"`
-	Casual       string `bson:"casual,omitempty" json:"casual,omitempty"`
-}
-
 // MessageStatus メッセージの状態
 type MessageStatus string
 
@@ -56,6 +66,7 @@ const (
 	MessageStatusSent       MessageStatus = "sent"       // 送信完了
 	MessageStatusDelivered  MessageStatus = "delivered"  // 配信完了
 	MessageStatusRead       MessageStatus = "read"       // 既読
+	MessageStatusFailed     MessageStatus = "failed"     // 配信失敗（再試行の上限に達した・再試行しても配信できない。手動で再試行できる）
 )
 
 // CreateMessageRequest メッセージ作成リクエスト
@@ -70,10 +81,49 @@ type UpdateMessageRequest struct {
 	RecipientEmail   string            `json:"recipientEmail,omitempty"`
 	OriginalText     string            `json:"originalText,omitempty"`
 	Reason           string            `json:"reason,omitempty"`
-	Variations       MessageVariations `json:"variations,omitempty"`
+	Variations       map[string]string `json:"variations,omitempty"`     // トーン名 → 変換後テキスト（手動編集を含む）
 	ToneVariations   map[string]string `json:"toneVariations,omitempty"` // トーン変換結果用
 	SelectedTone     string            `json:"selectedTone,omitempty"`
 	ScheduledAt      *time.Time        `json:"scheduledAt,omitempty"`
+	// ConfirmHarsh 送信するテキストが強く伝わる可能性がある場合でも送信予約する（CreateScheduleRequest と同じ）
+	ConfirmHarsh bool `json:"confirmHarsh"`
+}
+
+// ToneTexts variations と toneVariations をまとめたトーン名 → テキスト（同じトーンは toneVariations を優先）
+func (req *UpdateMessageRequest) ToneTexts() map[string]string {
+	texts := make(map[string]string, len(req.Variations)+len(req.ToneVariations))
+	for tone, text := range req.Variations {
+		texts[tone] = text
+	}
+	for tone, text := range req.ToneVariations {
+		texts[tone] = text
+	}
+	return texts
+}
+
+// ChangesSendText 更新で送信するテキスト（最終テキスト・最終テキストが無い場合の元のテキスト）が変わる可能性があるか
+func (req *UpdateMessageRequest) ChangesSendText() bool {
+	return req.SelectedTone != "" || req.OriginalText != ""
+}
+
+// SendTextAfter req で更新した後に送信するテキスト（UpdateMessage と同じ規則で最終テキストを決める）
+func (m *Message) SendTextAfter(req *UpdateMessageRequest) string {
+	if req.SelectedTone != "" {
+		finalText := req.ToneTexts()[req.SelectedTone]
+		if finalText == "" {
+			finalText = m.Variations.Text(req.SelectedTone)
+		}
+		if finalText != "" {
+			return finalText
+		}
+	}
+	if m.FinalText != "" {
+		return m.FinalText
+	}
+	if req.OriginalText != "" {
+		return req.OriginalText
+	}
+	return m.OriginalText
 }
 
 // MessageService メッセージサービス
@@ -110,6 +160,7 @@ func (s *MessageService) CreateDraft(ctx context.Context, senderID primitive.Obj
 		SenderID:     senderID,
 		OriginalText: req.OriginalText,
 		Reason:       req.Reason,
+		Variations:   MessageVariations{},
 		Status:       MessageStatusDraft,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -160,41 +211,48 @@ func (s *MessageService) UpdateMessage(ctx context.Context, messageID, senderID
 		updateData["reason"] = req.Reason
 	}
 	
-	if req.Variations.Gentle != "" || req.Variations.Constructive != "" || req.Variations.Casual != "" {
-		updateData["variations"] = req.Variations
-	}
-	
-	// トーン変換結果を直接設定する場合（APIから呼び出される場合）
-	if req.ToneVariations != nil {
-		variations := MessageVariations{}
-		if gentle, ok := req.ToneVariations["gentle"]; ok {
-			variations.Gentle = gentle
+	// variations と toneVariations はどちらもトーン名 → テキストとして扱う
+	texts := req.ToneTexts()
+
+	var current *Message
+	if len(texts) > 0 || req.SelectedTone != "" {
+		var err error
+		current, err = s.GetMessage(ctx, messageID, senderID)
+		if err != nil {
+			return nil, err
 		}
-		if constructive, ok := req.ToneVariations["constructive"]; ok {
-			variations.Constructive = constructive
+	}
+
+	// 内容が変わったトーンのみ保存（AI生成時のメタデータを保持するため）
+	tones := make([]string, 0, len(texts))
+	for tone := range texts {
+		tones = append(tones, tone)
+	}
+	sort.Strings(tones)
+
+	var edited []ToneVariant
+	for _, tone := range tones {
+		text := texts[tone]
+		if text == "" || current.Variations.Text(tone) == text {
+			continue
 		}
-		if casual, ok := req.ToneVariations["casual"]; ok {
-			variations.Casual = casual
+		variant := ToneVariant{Tone: tone, Text: text, GeneratedAt: now}
+		if existing, ok := current.Variations.Get(tone); ok {
+			variant.DisplayName = existing.DisplayName
 		}
-		updateData["variations"] = variations
+		edited = append(edited, variant)
 	}
-	
+
 	if req.SelectedTone != "" {
 		updateData["selectedTone"] = req.SelectedTone
-		// 選択されたトーンに基づいて最終テキストを設定
-		switch req.SelectedTone {
-		case "gentle":
-			if req.Variations.Gentle != "" {
-				updateData["finalText"] = req.Variations.Gentle
-			}
-		case "constructive":
-			if req.Variations.Constructive != "" {
-				updateData["finalText"] = req.Variations.Constructive
-			}
-		case "casual":
-			if req.Variations.Casual != "" {
-				updateData["finalText"] = req.Variations.Casual
-			}
+		updateData["selectedRevisionId"] = nil
+		// 選択されたトーンに基づいて最終テキストを設定（リクエストになければ保存済みの変換結果）
+		finalText := texts[req.SelectedTone]
+		if finalText == "" {
+			finalText = current.Variations.Text(req.SelectedTone)
+		}
+		if finalText != "" {
+			updateData["finalText"] = finalText
 		}
 	}
 	
@@ -228,7 +286,19 @@ func (s *MessageService) UpdateMessage(ctx context.Context, messageID, senderID
 		"senderId": senderID,
 	}
 
-	_, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": updateData})
+	var update interface{} = bson.M{"$set": updateData}
+	if len(edited) > 0 {
+		// 変換結果のトーン単位の置き換えには更新パイプラインを使う
+		// パイプライン内では "$" で始まる文字列がフィールド参照になるため値は $literal で囲む
+		pipelineData := bson.M{}
+		for key, value := range updateData {
+			pipelineData[key] = bson.M{"$literal": value}
+		}
+		pipelineData["variations"] = mergeVariantsPipeline(edited)
+		update = mongo.Pipeline{{{Key: "$set", Value: pipelineData}}}
+	}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return nil, err
 	}
@@ -236,6 +306,42 @@ func (s *MessageService) UpdateMessage(ctx context.Context, messageID, senderID
 	return s.GetMessage(ctx, messageID, senderID)
 }
 
+// SaveToneResults トーン変換結果を部分的に保存
+// 成功したトーンのみ上書きし（既存の他トーンは保持）、失敗したトーンを再試行用に記録する
+func (s *MessageService) SaveToneResults(ctx context.Context, messageID, senderID primitive.ObjectID, succeeded []ToneVariant, failedTones []string) error {
+	setData := bson.M{
+		"updatedAt": time.Now(),
+	}
+	if len(succeeded) > 0 {
+		setData["variations"] = mergeVariantsPipeline(succeeded)
+	}
+
+	update := mongo.Pipeline{}
+	if len(failedTones) > 0 {
+		// パイプライン内では配列リテラルが式として解釈されるため $literal で囲む
+		setData["failedTones"] = bson.M{"$literal": failedTones}
+		update = append(update, bson.D{{Key: "$set", Value: setData}})
+	} else {
+		update = append(update, bson.D{{Key: "$set", Value: setData}}, bson.D{{Key: "$unset", Value: "failedTones"}})
+	}
+
+	filter := bson.M{
+		"_id":      messageID,
+		"senderId": senderID,
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
 // GetMessage メッセージを取得
 func (s *MessageService) GetMessage(ctx context.Context, messageID, userID primitive.ObjectID) (*Message, error) {
 	var message Message
@@ -324,74 +430,6 @@ func (s *MessageService) DeleteMessage(ctx context.Context, messageID, senderID
 	return nil
 }
 
-// DeliverScheduledMessages スケジュール配信: scheduled → sent
-func (s *MessageService) DeliverScheduledMessages(ctx context.Context) ([]Message, error) {
-	now := time.Now()
-	
-	// デバッグログ: クエリ条件を詳細出力
-	log.Printf("🔍 [DeliverScheduledMessages] 現在時刻: %v", now.Format("2006-01-02 15:04:05"))
-	log.Printf("🔍 [DeliverScheduledMessages] 検索条件: status='%s', scheduledAt<='%v'", MessageStatusScheduled, now.Format("2006-01-02 15:04:05"))
-	
-	// 配信時刻が過ぎたスケジュールメッセージを取得
-	filter := bson.M{
-		"status":      MessageStatusScheduled,
-		"scheduledAt": bson.M{"$lte": now},
-	}
-
-	var messages []Message
-	cursor, err := s.collection.Find(ctx, filter)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	if err = cursor.All(ctx, &messages); err != nil {
-		return nil, err
-	}
-
-	// デバッグログ: 取得したメッセージの詳細を出力
-	log.Printf("🔍 [DeliverScheduledMessages] 取得したメッセージ数: %d件", len(messages))
-	for i, msg := range messages {
-		log.Printf("🔍 [DeliverScheduledMessages] メッセージ%d: ID=%s, status='%s', scheduledAt=%v, createdAt=%v", 
-			i+1, msg.ID.Hex(), msg.Status, 
-			msg.ScheduledAt, msg.CreatedAt)
-	}
-
-	// バッチで配信済みに更新
-	if len(messages) > 0 {
-		messageIDs := make([]primitive.ObjectID, len(messages))
-		for i, msg := range messages {
-			messageIDs[i] = msg.ID
-		}
-
-		updateFilter := bson.M{
-			"_id": bson.M{"$in": messageIDs},
-		}
-
-		updateData := bson.M{
-			"$set": bson.M{
-				"status":    MessageStatusSent,
-				"sentAt":    now,
-				"updatedAt": now,
-			},
-		}
-
-		_, err = s.collection.UpdateMany(ctx, updateFilter, updateData)
-		if err != nil {
-			return nil, err
-		}
-
-		// 更新後のメッセージを取得
-		for i := range messages {
-			messages[i].Status = MessageStatusSent
-			messages[i].SentAt = &now
-			messages[i].UpdatedAt = now
-		}
-	}
-
-	return messages, nil
-}
-
 // GetReceivedMessages 受信メッセージ一覧を取得（受信者向け）
 func (s *MessageService) GetReceivedMessages(ctx context.Context, recipientID primitive.ObjectID, page, limit int) ([]Message, int64, error) {
 	var messages []Message
@@ -525,6 +563,13 @@ func (s *MessageService) CreateIndexes(ctx context.Context) error {
 				{Key: "status", Value: 1},
 			},
 		},
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "scheduledAt", Value: 1},
+				{Key: "deliveryClaim.expiresAt", Value: 1}, // 配信ワーカーの確保用
+			},
+		},
 		{
 			Keys: bson.D{
 				{Key: "sentAt", Value: -1}, // 受信メッセージのソート用
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// メッセージの強さの分析の観点
+const (
+	AnalysisAggression = "aggression" // 攻撃性
+	AnalysisSarcasm    = "sarcasm"    // 皮肉・嫌味
+	AnalysisBlame      = "blame"      // 非難
+	AnalysisUrgency    = "urgency"    // 緊急度・急かし
+)
+
+// AnalysisDimensions 分析の観点の一覧
+var AnalysisDimensions = []string{AnalysisAggression, AnalysisSarcasm, AnalysisBlame, AnalysisUrgency}
+
+// 分析結果の生成元
+const (
+	AnalysisSourceAI    = "ai"
+	AnalysisSourceRules = "rules"
+)
+
+// 分析結果の総合レベル
+const (
+	AnalysisLevelLow    = "low"
+	AnalysisLevelMedium = "medium"
+	AnalysisLevelHigh   = "high"
+)
+
+// ruleHitScore ルールベースの分析で語句が1つ見つかるごとに加算するスコア（1つでも guard_threshold の既定値に達する）
+const ruleHitScore = 60
+
+// MessageAnalysisSchema 分析の応答の JSON Schema（LLMリクエストの ResponseFormat に指定する）
+var MessageAnalysisSchema = json.RawMessage(`{
+  "type": "object",
+  "required": ["scores", "spans", "summary"],
+  "properties": {
+    "scores": {
+      "type": "object",
+      "required": ["aggression", "sarcasm", "blame", "urgency"],
+      "properties": {
+        "aggression": {"type": "integer", "minimum": 0, "maximum": 100},
+        "sarcasm": {"type": "integer", "minimum": 0, "maximum": 100},
+        "blame": {"type": "integer", "minimum": 0, "maximum": 100},
+        "urgency": {"type": "integer", "minimum": 0, "maximum": 100}
+      }
+    },
+    "spans": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["text", "dimension"],
+        "properties": {
+          "text": {"type": "string", "description": "メッセージから一字一句そのまま抜き出した箇所"},
+          "dimension": {"type": "string", "enum": ["aggression", "sarcasm", "blame", "urgency"]},
+          "reason": {"type": "string"}
+        }
+      }
+    },
+    "summary": {"type": "string"}
+  }
+}`)
+
+// AnalysisScores 観点ごとのスコア（0-100）
+type AnalysisScores struct {
+	Aggression int `bson:"aggression" json:"aggression"`
+	Sarcasm    int `bson:"sarcasm" json:"sarcasm"`
+	Blame      int `bson:"blame" json:"blame"`
+	Urgency    int `bson:"urgency" json:"urgency"`
+}
+
+// AnalysisSpan 分析で指摘された箇所
+type AnalysisSpan struct {
+	Start     int    `bson:"start" json:"start"` // 分析したテキスト中の開始位置（文字数）
+	End       int    `bson:"end" json:"end"`     // 終了位置（文字数、この位置の文字は含まない）
+	Text      string `bson:"text" json:"text"`
+	Dimension string `bson:"dimension" json:"dimension"`
+	Reason    string `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// MessageAnalysis メッセージの強さの分析結果
+type MessageAnalysis struct {
+	Text    string         `bson:"text" json:"text"` // 分析したテキスト
+	Scores  AnalysisScores `bson:"scores" json:"scores"`
+	Overall int            `bson:"overall" json:"overall"` // 総合スコア（攻撃性・皮肉・非難の最大値。緊急度は含まない）
+	Level   string         `bson:"level" json:"level"`     // low | medium | high
+	Spans   []AnalysisSpan `bson:"spans" json:"spans"`
+	Summary string         `bson:"summary,omitempty" json:"summary,omitempty"`
+	// Source 分析結果の生成元（ai: モデルの応答 / rules: tone_prompts.yaml の語句）
+	Source     string    `bson:"source" json:"source"`
+	AnalyzedAt time.Time `bson:"analyzedAt" json:"analyzedAt"`
+}
+
+// Harsh 総合スコアが threshold 以上か（送信前の確認が必要か）
+func (a *MessageAnalysis) Harsh(threshold int) bool {
+	return a.Overall >= threshold
+}
+
+// ParseMessageAnalysis 分析のJSONを解析し、指摘箇所を text 中の位置に対応づける
+// text に見つからない指摘箇所・不明な観点の指摘は除外する
+func ParseMessageAnalysis(data []byte, text string) (*MessageAnalysis, error) {
+	var raw struct {
+		Scores *AnalysisScores `json:"scores"`
+		Spans  []struct {
+			Text      string `json:"text"`
+			Dimension string `json:"dimension"`
+			Reason    string `json:"reason"`
+		} `json:"spans"`
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("AI応答の解析に失敗: %w", err)
+	}
+	if raw.Scores == nil {
+		return nil, errors.New("AI応答に scores がありません")
+	}
+
+	analysis := &MessageAnalysis{
+		Text:    text,
+		Scores:  *raw.Scores,
+		Summary: strings.TrimSpace(raw.Summary),
+		Source:  AnalysisSourceAI,
+	}
+	for _, span := range raw.Spans {
+		if !containsString(AnalysisDimensions, span.Dimension) {
+			continue
+		}
+		analysis.Spans = appendSpans(analysis.Spans, text, strings.TrimSpace(span.Text), span.Dimension, span.Reason)
+	}
+	analysis.finish()
+	return analysis, nil
+}
+
+// NewRuleBasedAnalysis tone_prompts.yaml の語句で分析する（AIで分析できない場合に使う）
+// 観点ごとに、見つかった語句1つにつき ruleHitScore を加算する
+func NewRuleBasedAnalysis(rules map[string][]string, text string) *MessageAnalysis {
+	analysis := &MessageAnalysis{Text: text, Source: AnalysisSourceRules}
+	for _, dimension := range AnalysisDimensions {
+		hits := 0
+		for _, phrase := range rules[dimension] {
+			before := len(analysis.Spans)
+			analysis.Spans = appendSpans(analysis.Spans, text, phrase, dimension, "「"+phrase+"」を含みます")
+			hits += len(analysis.Spans) - before
+		}
+		analysis.Scores.set(dimension, hits*ruleHitScore)
+	}
+	if len(analysis.Spans) > 0 {
+		analysis.Summary = "強く伝わる可能性のある表現が含まれています"
+	} else {
+		analysis.Summary = "強く伝わる表現は見つかりませんでした"
+	}
+	analysis.finish()
+	return analysis
+}
+
+// set 観点のスコアを設定
+func (s *AnalysisScores) set(dimension string, score int) {
+	switch dimension {
+	case AnalysisAggression:
+		s.Aggression = score
+	case AnalysisSarcasm:
+		s.Sarcasm = score
+	case AnalysisBlame:
+		s.Blame = score
+	case AnalysisUrgency:
+		s.Urgency = score
+	}
+}
+
+// finish スコアを 0-100 に収め、総合スコア・レベルを計算して指摘箇所を位置順に並べる
+func (a *MessageAnalysis) finish() {
+	a.Scores.Aggression = clampScore(a.Scores.Aggression)
+	a.Scores.Sarcasm = clampScore(a.Scores.Sarcasm)
+	a.Scores.Blame = clampScore(a.Scores.Blame)
+	a.Scores.Urgency = clampScore(a.Scores.Urgency)
+
+	a.Overall = max(a.Scores.Aggression, a.Scores.Sarcasm, a.Scores.Blame)
+	switch {
+	case a.Overall >= 70:
+		a.Level = AnalysisLevelHigh
+	case a.Overall >= 40:
+		a.Level = AnalysisLevelMedium
+	default:
+		a.Level = AnalysisLevelLow
+	}
+
+	if a.Spans == nil {
+		a.Spans = []AnalysisSpan{}
+	}
+	sort.SliceStable(a.Spans, func(i, j int) bool { return a.Spans[i].Start < a.Spans[j].Start })
+	a.AnalyzedAt = time.Now()
+}
+
+// clampScore スコアを 0-100 に収める
+func clampScore(score int) int {
+	return min(max(score, 0), 100)
+}
+
+// appendSpans text 中の phrase の出現箇所を指摘箇所として追加（同じ観点で既存の指摘と重なる箇所は追加しない）
+func appendSpans(spans []AnalysisSpan, text, phrase, dimension, reason string) []AnalysisSpan {
+	if phrase == "" {
+		return spans
+	}
+	offset := 0
+	for {
+		i := strings.Index(text[offset:], phrase)
+		if i < 0 {
+			return spans
+		}
+		byteStart := offset + i
+		start := utf8.RuneCountInString(text[:byteStart])
+		span := AnalysisSpan{
+			Start:     start,
+			End:       start + utf8.RuneCountInString(phrase),
+			Text:      phrase,
+			Dimension: dimension,
+			Reason:    strings.TrimSpace(reason),
+		}
+		duplicate := false
+		for _, existing := range spans {
+			if existing.Dimension == span.Dimension && existing.Start < span.End && span.Start < existing.End {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			spans = append(spans, span)
+		}
+		offset = byteStart + len(phrase)
+	}
+}
+
+// SaveAnalysis メッセージに分析結果を保存
+func (s *MessageService) SaveAnalysis(ctx context.Context, messageID, userID primitive.ObjectID, analysis *MessageAnalysis) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": messageID, "senderId": userID},
+		bson.M{"$set": bson.M{"analysis": analysis, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("メッセージが見つからないか、アクセス権限がありません")
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeliveryClaim 配信ワーカーによる送信予約済みメッセージの確保（リース）
+// 確保したワーカーだけが配信を完了でき、期限切れの確保は他のワーカーが取り直せる
+type DeliveryClaim struct {
+	Owner     string    `bson:"owner" json:"owner"` // 確保したワーカーのID
+	ClaimedAt time.Time `bson:"claimedAt" json:"claimedAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Active リースが期限内か
+func (c *DeliveryClaim) Active(now time.Time) bool {
+	return c != nil && now.Before(c.ExpiresAt)
+}
+
+// ChannelFailure 受信箱以外のチャネル（メール・Webhook）への配信失敗
+// メッセージの配信完了後も、NextAttemptAt が設定されている間はチャネルだけを再試行する
+type ChannelFailure struct {
+	Error         string     `bson:"error" json:"error"`
+	Retryable     bool       `bson:"retryable" json:"retryable"`                             // 一時的な失敗か
+	Attempts      int        `bson:"attempts" json:"attempts"`                               // 失敗した試行回数
+	NextAttemptAt *time.Time `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"` // 次に再試行する日時（恒久的な失敗・再試行の上限に達した場合は nil）
+	FailedAt      time.Time  `bson:"failedAt" json:"failedAt"`
+}
+
+// dueDeliveryFilter 配信時刻（再試行待ちの場合は次の試行日時）を過ぎ、どのワーカーも確保していない（または確保の期限が切れた）送信予約済みメッセージ
+func dueDeliveryFilter(now time.Time) bson.M {
+	return bson.M{
+		"status":      MessageStatusScheduled,
+		"scheduledAt": bson.M{"$lte": now},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"deliveryClaim": bson.M{"$exists": false}},
+				{"deliveryClaim.expiresAt": bson.M{"$lte": now}},
+			}},
+			{"$or": []bson.M{
+				{"nextAttemptAt": bson.M{"$exists": false}},
+				{"nextAttemptAt": bson.M{"$lte": now}},
+			}},
+		},
+	}
+}
+
+// ClaimScheduledMessage 配信時刻を過ぎた送信予約済みメッセージを1件確保する（対象が無い場合は nil）
+// findOneAndUpdate で条件の確認と確保を1回で行うため、複数のワーカーが同じメッセージを確保することはない
+func (s *MessageService) ClaimScheduledMessage(ctx context.Context, owner string, lease time.Duration) (*Message, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"deliveryClaim": DeliveryClaim{Owner: owner, ClaimedAt: now, ExpiresAt: now.Add(lease)},
+			"updatedAt":     now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "scheduledAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message Message
+	err := s.collection.FindOneAndUpdate(ctx, dueDeliveryFilter(now), update, opts).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// CompleteDelivery 確保したメッセージを配信完了（delivered）にして確保を解除する
+// 確保したワーカーのみ完了できる。確保の期限が切れて他のワーカーが取り直した場合・既に配信済みの場合は false を返す
+// （同じメッセージの配信完了を二重に処理しない）
+func (s *MessageService) CompleteDelivery(ctx context.Context, messageID primitive.ObjectID, owner string) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set":   bson.M{"status": MessageStatusDelivered, "sentAt": now, "deliveredAt": now, "updatedAt": now},
+		"$unset": bson.M{"deliveryClaim": "", "nextAttemptAt": ""},
+	}
+	message, err := s.transitionWithEvent(ctx, s.claimedFilter(messageID, owner), update, OutboxMessageDelivered)
+	return message != nil, err
+}
+
+// ScheduleDeliveryRetry 確保したメッセージの配信失敗を記録し、nextAttemptAt に再試行するよう確保を解除する
+// 試行回数を1増やす。確保したワーカーのみ記録でき、記録できなかった場合は false を返す
+func (s *MessageService) ScheduleDeliveryRetry(ctx context.Context, messageID primitive.ObjectID, owner string, nextAttemptAt time.Time, reason string) (bool, error) {
+	update := bson.M{
+		"$inc":   bson.M{"deliveryAttempts": 1},
+		"$set":   bson.M{"nextAttemptAt": nextAttemptAt, "lastDeliveryError": reason, "updatedAt": time.Now()},
+		"$unset": bson.M{"deliveryClaim": ""},
+	}
+	message, err := s.transitionWithEvent(ctx, s.claimedFilter(messageID, owner), update, OutboxMessageRetryScheduled)
+	return message != nil, err
+}
+
+// FailDelivery 確保したメッセージを配信失敗（failed）にして確保を解除する
+// 再試行の上限に達した場合・再試行しても配信できない場合に使う。送信者が RetryFailedMessage で再試行するまで配信しない
+func (s *MessageService) FailDelivery(ctx context.Context, messageID primitive.ObjectID, owner string, reason string) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$inc":   bson.M{"deliveryAttempts": 1},
+		"$set":   bson.M{"status": MessageStatusFailed, "failedAt": now, "lastDeliveryError": reason, "updatedAt": now},
+		"$unset": bson.M{"deliveryClaim": "", "nextAttemptAt": ""},
+	}
+	message, err := s.transitionWithEvent(ctx, s.claimedFilter(messageID, owner), update, OutboxMessageFailed)
+	return message != nil, err
+}
+
+// ReleaseDeliveryClaim 確保したメッセージを試行回数を増やさずに解除する（次回の配信チェックで再び確保できる）
+// ワーカー側の都合（タイムアウト・停止）で配信を終えられなかった場合と、チャネルの再試行を終えた場合に使う
+func (s *MessageService) ReleaseDeliveryClaim(ctx context.Context, messageID primitive.ObjectID, owner string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": messageID, "deliveryClaim.owner": owner},
+		bson.M{"$unset": bson.M{"deliveryClaim": ""}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	return err
+}
+
+// claimedFilter ワーカーが確保している送信予約済みメッセージ
+func (s *MessageService) claimedFilter(messageID primitive.ObjectID, owner string) bson.M {
+	return bson.M{"_id": messageID, "status": MessageStatusScheduled, "deliveryClaim.owner": owner}
+}
+
+// transitionWithEvent メッセージの状態遷移と outbox イベントを1つのトランザクションで書き込む
+// 通知・スケジュールの同期などはイベントを受け取ったディスパッチャーが行うため、状態遷移とずれることはない
+// 条件に一致するメッセージが無い場合はイベントを書き込まず nil を返す
+func (s *MessageService) transitionWithEvent(ctx context.Context, filter, update bson.M, eventType OutboxEventType) (*Message, error) {
+	var message *Message
+	err := withTransaction(ctx, s.db, func(sc mongo.SessionContext) error {
+		message = nil
+		var updated Message
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := s.collection.FindOneAndUpdate(sc, filter, update, opts).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := insertOutboxEvent(sc, s.db, newOutboxEvent(eventType, updated.event())); err != nil {
+			return err
+		}
+		message = &updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// event 状態遷移後のメッセージから outbox イベントの内容を作成
+func (m *Message) event() MessageEvent {
+	return MessageEvent{
+		MessageID:     m.ID,
+		SenderID:      m.SenderID,
+		RecipientID:   m.RecipientID,
+		Status:        m.Status,
+		Attempts:      m.DeliveryAttempts,
+		Reason:        m.LastDeliveryError,
+		NextAttemptAt: m.NextAttemptAt,
+	}
+}
+
+// GetFailedMessages 配信失敗（failed）のメッセージ一覧を取得（送信者向け、失敗日時の新しい順）
+func (s *MessageService) GetFailedMessages(ctx context.Context, senderID primitive.ObjectID, page, limit int) ([]Message, int64, error) {
+	filter := bson.M{"senderId": senderID, "status": MessageStatusFailed}
+
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "failedAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+// RetryFailedMessage 配信失敗（failed）のメッセージを送信予約済みに戻し、次回の配信チェックで再び配信する（送信者のみ）
+// 試行回数はリセットする。配信に成功したチャネルの記録は残すため、成功済みのチャネルには再送しない
+// 対象のメッセージが無い・配信失敗ではない場合は mongo.ErrNoDocuments を返す
+func (s *MessageService) RetryFailedMessage(ctx context.Context, messageID, senderID primitive.ObjectID) (*Message, error) {
+	update := bson.M{
+		"$set":   bson.M{"status": MessageStatusScheduled, "updatedAt": time.Now()},
+		"$unset": bson.M{"deliveryAttempts": "", "nextAttemptAt": "", "lastDeliveryError": "", "failedAt": ""},
+	}
+	filter := bson.M{"_id": messageID, "senderId": senderID, "status": MessageStatusFailed}
+
+	message, err := s.transitionWithEvent(ctx, filter, update, OutboxMessageRetried)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	return message, nil
+}
+
+// MarkChannelDelivered 確保したメッセージのチャネルへの配信成功を記録（再試行時に同じチャネルへ再送しない）
+func (s *MessageService) MarkChannelDelivered(ctx context.Context, messageID primitive.ObjectID, owner, channel string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": messageID, "deliveryClaim.owner": owner},
+		bson.M{
+			"$addToSet": bson.M{"deliveredChannels": channel},
+			"$unset":    bson.M{"channelFailures." + channel: ""},
+		},
+	)
+	return err
+}
+
+// RecordChannelFailure 確保したメッセージの受信箱以外のチャネル（メール・Webhook）への配信失敗を記録
+// メッセージの配信の完了は妨げない。failure.NextAttemptAt を設定した場合は ClaimChannelRetry で再試行する
+func (s *MessageService) RecordChannelFailure(ctx context.Context, messageID primitive.ObjectID, owner, channel string, failure ChannelFailure) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": messageID, "deliveryClaim.owner": owner},
+		bson.M{"$set": bson.M{"channelFailures." + channel: failure}},
+	)
+	return err
+}
+
+// ClaimChannelRetry channels のいずれかの再試行日時を過ぎた配信済みのメッセージを1件確保する（対象が無い場合は nil）
+// 受信箱への配信は完了しているため、確保したワーカーは再試行日時を過ぎたチャネルだけに配信する
+func (s *MessageService) ClaimChannelRetry(ctx context.Context, owner string, lease time.Duration, channels []string) (*Message, error) {
+	if len(channels) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	due := make([]bson.M, 0, len(channels))
+	for _, channel := range channels {
+		due = append(due, bson.M{"channelFailures." + channel + ".nextAttemptAt": bson.M{"$lte": now}})
+	}
+	filter := bson.M{
+		"status": MessageStatusDelivered,
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"deliveryClaim": bson.M{"$exists": false}},
+				{"deliveryClaim.expiresAt": bson.M{"$lte": now}},
+			}},
+			{"$or": due},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"deliveryClaim": DeliveryClaim{Owner: owner, ClaimedAt: now, ExpiresAt: now.Add(lease)},
+			"updatedAt":     now,
+		},
+	}
+
+	var message Message
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxRefinementsPerMessage 1メッセージあたりの改訂履歴の上限
+const MaxRefinementsPerMessage = 50
+
+// ErrRefinementLimitExceeded 改訂履歴の上限超過エラー
+var ErrRefinementLimitExceeded = errors.New("このメッセージの改訂回数が上限に達しました")
+
+// ToneRefinement トーン変換結果への追加指示による改訂1件
+// ParentID が nil の場合は Tone の変換結果を、それ以外は ParentID の改訂を基にしている
+type ToneRefinement struct {
+	ID            primitive.ObjectID  `bson:"id" json:"id"`
+	Tone          string              `bson:"tone" json:"tone"`
+	ParentID      *primitive.ObjectID `bson:"parentId,omitempty" json:"parentId,omitempty"`
+	Instruction   string              `bson:"instruction" json:"instruction"`
+	Text          string              `bson:"text" json:"text"`
+	Model         string              `bson:"model,omitempty" json:"model,omitempty"`
+	PromptVersion string              `bson:"promptVersion,omitempty" json:"promptVersion,omitempty"`
+	CreatedAt     time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// FindRefinement 改訂IDから改訂を取得
+func (m *Message) FindRefinement(id primitive.ObjectID) (ToneRefinement, bool) {
+	for _, refinement := range m.Refinements {
+		if refinement.ID == id {
+			return refinement, true
+		}
+	}
+	return ToneRefinement{}, false
+}
+
+// RefinementChain 指定した改訂に至るまでの改訂を古い順に取得
+func (m *Message) RefinementChain(id primitive.ObjectID) []ToneRefinement {
+	var chain []ToneRefinement
+	current, ok := m.FindRefinement(id)
+	// 親をたどる（壊れたデータで循環しないよう履歴数で打ち切る）
+	for ok && len(chain) <= len(m.Refinements) {
+		chain = append([]ToneRefinement{current}, chain...)
+		if current.ParentID == nil {
+			break
+		}
+		current, ok = m.FindRefinement(*current.ParentID)
+	}
+	return chain
+}
+
+// AddRefinement 改訂を履歴に追加
+func (s *MessageService) AddRefinement(ctx context.Context, messageID, senderID primitive.ObjectID, refinement *ToneRefinement) error {
+	if refinement.ID.IsZero() {
+		refinement.ID = primitive.NewObjectID()
+	}
+	if refinement.CreatedAt.IsZero() {
+		refinement.CreatedAt = time.Now()
+	}
+
+	// 上限未満の場合のみ追加（refinements.N が存在しない = 要素数が N 以下）
+	filter := bson.M{
+		"_id":      messageID,
+		"senderId": senderID,
+		"refinements." + strconv.Itoa(MaxRefinementsPerMessage-1): bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$push": bson.M{"refinements": refinement},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// メッセージが存在するなら上限超過
+		if _, err := s.GetMessage(ctx, messageID, senderID); err != nil {
+			return err
+		}
+		return ErrRefinementLimitExceeded
+	}
+
+	return nil
+}
+
+// SelectRefinement 改訂を最終テキストとして選択
+func (s *MessageService) SelectRefinement(ctx context.Context, messageID, senderID, refinementID primitive.ObjectID) (*Message, error) {
+	message, err := s.GetMessage(ctx, messageID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != senderID {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	refinement, ok := message.FindRefinement(refinementID)
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	filter := bson.M{
+		"_id":      messageID,
+		"senderId": senderID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"selectedTone":       refinement.Tone,
+			"selectedRevisionId": refinement.ID,
+			"finalText":          refinement.Text,
+			"updatedAt":          time.Now(),
+		},
+	}
+	if _, err := s.collection.UpdateOne(ctx, filter, update); err != nil {
+		return nil, err
+	}
+
+	return s.GetMessage(ctx, messageID, senderID)
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ToneVariant トーン変換結果1件（生成時のメタデータ付き）
+type ToneVariant struct {
+	Tone          string    `bson:"tone" json:"tone"`
+	DisplayName   string    `bson:"displayName,omitempty" json:"displayName,omitempty"`
+	Text          string    `bson:"text" json:"text"`
+	Model         string    `bson:"model,omitempty" json:"model,omitempty"`                 // 生成したモデル（手動編集時は空）
+	PromptVersion string    `bson:"promptVersion,omitempty" json:"promptVersion,omitempty"` // 生成に使ったプロンプトのバージョン
+	Language      string    `bson:"language,omitempty" json:"language,omitempty"`           // 変換結果の言語（ja, en, zh, ko）
+	GeneratedAt   time.Time `bson:"generatedAt" json:"generatedAt"`
+	// Experiment A/B 実験の群で生成された場合の割り当て
+	Experiment *ExperimentAssignment `bson:"experiment,omitempty" json:"experiment,omitempty"`
+	// Violations 再生成しても満たせなかったトーン設定の制約（空の場合は制約を満たしている）
+	Violations []string `bson:"violations,omitempty" json:"violations,omitempty"`
+	// Explanation 元のメッセージからの差分と変更ごとの理由（POST /transform/explain で生成）
+	Explanation *VariantExplanation `bson:"explanation,omitempty" json:"explanation,omitempty"`
+}
+
+// Flagged 制約を満たさないまま保存された変換結果か
+func (v ToneVariant) Flagged() bool {
+	return len(v.Violations) > 0
+}
+
+// MessageVariations AIトーン変換結果（トーン順に並んだ任意個の変換結果）
+type MessageVariations []ToneVariant
+
+// Get 指定トーンの変換結果を取得
+func (v MessageVariations) Get(tone string) (ToneVariant, bool) {
+	for _, variant := range v {
+		if variant.Tone == tone {
+			return variant, true
+		}
+	}
+	return ToneVariant{}, false
+}
+
+// Text 指定トーンの変換後テキストを取得（無い場合は空文字）
+func (v MessageVariations) Text(tone string) string {
+	variant, _ := v.Get(tone)
+	return variant.Text
+}
+
+// UnmarshalBSONValue 配列形式に加え、旧形式（トーン名をキーとするドキュメント）も読み込む
+// 旧形式はマイグレーション前のドキュメントのみで、メタデータはトーン名とテキストのみとなる
+func (v *MessageVariations) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Array:
+		var variants []ToneVariant
+		if err := bson.UnmarshalValue(t, data, &variants); err != nil {
+			return err
+		}
+		*v = variants
+	case bsontype.EmbeddedDocument:
+		elements, err := bson.Raw(data).Elements()
+		if err != nil {
+			return err
+		}
+		variants := make(MessageVariations, 0, len(elements))
+		for _, element := range elements {
+			text, ok := element.Value().StringValueOK()
+			if !ok || text == "" {
+				continue
+			}
+			variants = append(variants, ToneVariant{Tone: element.Key(), Text: text})
+		}
+		*v = variants
+	case bsontype.Null, bsontype.Undefined:
+		*v = nil
+	default:
+		return fmt.Errorf("variations の型が不正です: %s", t)
+	}
+	return nil
+}
+
+// mergeVariantsPipeline 変換結果をトーン単位で置き換える更新パイプラインの式
+// 既存のトーンは位置を保ったまま置き換え、新しいトーンは末尾に追加する（他のトーンは保持）
+// 旧形式（ドキュメント）の variations は空配列として扱う
+func mergeVariantsPipeline(variants []ToneVariant) bson.M {
+	tones := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		tones = append(tones, variant.Tone)
+	}
+
+	// テキストに "$" が含まれてもフィールド参照と解釈されないよう $literal で囲む
+	literalVariants := bson.M{"$literal": variants}
+
+	return bson.M{
+		"$let": bson.M{
+			"vars": bson.M{
+				"existing": bson.M{"$cond": bson.A{bson.M{"$isArray": "$variations"}, "$variations", bson.A{}}},
+			},
+			"in": bson.M{
+				"$concatArrays": bson.A{
+					bson.M{"$map": bson.M{
+						"input": "$$existing",
+						"as":    "v",
+						"in": bson.M{"$let": bson.M{
+							"vars": bson.M{"i": bson.M{"$indexOfArray": bson.A{bson.M{"$literal": tones}, "$$v.tone"}}},
+							"in": bson.M{"$cond": bson.A{
+								bson.M{"$gte": bson.A{"$$i", 0}},
+								bson.M{"$arrayElemAt": bson.A{literalVariants, "$$i"}},
+								"$$v",
+							}},
+						}},
+					}},
+					bson.M{"$filter": bson.M{
+						"input": literalVariants,
+						"as":    "n",
+						"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$n.tone", "$$existing.tone"}}}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// MigrateLegacyVariations 旧形式（トーン名をキーとするドキュメント）の variations を配列形式に変換
+// 起動時に実行される。変換済みのドキュメントは対象外のため何度実行しても安全
+func (s *MessageService) MigrateLegacyVariations(ctx context.Context) (int64, error) {
+	filter := bson.M{"variations": bson.M{"$type": "object"}}
+
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID         primitive.ObjectID `bson:"_id"`
+			Variations MessageVariations  `bson:"variations"`
+			UpdatedAt  time.Time          `bson:"updatedAt"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("警告: variations マイグレーションでデコードに失敗 (%v): %v", cursor.Current.Lookup("_id"), err)
+			continue
+		}
+
+		// 旧形式には生成日時が無いため最終更新日時で代用する
+		variants := make([]ToneVariant, 0, len(doc.Variations))
+		for _, variant := range doc.Variations {
+			variant.GeneratedAt = doc.UpdatedAt
+			variants = append(variants, variant)
+		}
+
+		// 並行して新形式で保存された場合に上書きしないよう、旧形式のままの場合のみ更新
+		result, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": doc.ID, "variations": bson.M{"$type": "object"}},
+			bson.M{"$set": bson.M{"variations": variants}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	return migrated, cursor.Err()
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationType アプリ内通知の種類
+type NotificationType string
+
+const (
+	NotificationMessageDelivered NotificationType = "message_delivered" // 送信したメッセージの配信完了
+	NotificationMessageFailed    NotificationType = "message_failed"    // 送信したメッセージの配信失敗
+)
+
+// Notification アプリ内通知（送信者向けの配信完了・配信失敗など）
+type Notification struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	Type        NotificationType   `bson:"type" json:"type"`
+	MessageID   primitive.ObjectID `bson:"messageId" json:"messageId"`
+	RecipientID primitive.ObjectID `bson:"recipientId,omitempty" json:"recipientId,omitempty"`
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"` // 配信失敗の原因
+	EventID     primitive.ObjectID `bson:"eventId" json:"-"`                         // 元の outbox イベント（重複作成の防止）
+	Read        bool               `bson:"read" json:"read"`
+	ReadAt      *time.Time         `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// NotificationService アプリ内通知を管理
+type NotificationService struct {
+	collection *mongo.Collection
+}
+
+// NewNotificationService アプリ内通知サービスを作成
+func NewNotificationService(db *mongo.Database) *NotificationService {
+	return &NotificationService{
+		collection: db.Collection("notifications"),
+	}
+}
+
+// CreateIndexes 通知コレクションのインデックスを作成
+func (s *NotificationService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "eventId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// CreateNotification 通知を作成
+// outbox イベントは再配信されることがあるため、同じイベントの通知が作成済みの場合は何もしない
+func (s *NotificationService) CreateNotification(ctx context.Context, notification *Notification) error {
+	notification.Read = false
+	notification.ReadAt = nil
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"eventId": notification.EventID},
+		bson.M{"$setOnInsert": notification},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// GetNotifications ユーザーの通知を新しい順に取得（総数・未読数も返す）
+func (s *NotificationService) GetNotifications(ctx context.Context, userID primitive.ObjectID, page, limit int) ([]Notification, int64, int64, error) {
+	filter := bson.M{"userId": userID}
+
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	unread, err := s.collection.CountDocuments(ctx, bson.M{"userId": userID, "read": false})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	skip := int64((page - 1) * limit)
+	limitInt64 := int64(limit)
+	cursor, err := s.collection.Find(ctx, filter, &options.FindOptions{
+		Sort:  bson.D{{Key: "createdAt", Value: -1}},
+		Skip:  &skip,
+		Limit: &limitInt64,
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, 0, err
+	}
+	return notifications, total, unread, nil
+}
+
+// MarkAsRead 通知を既読にする（ユーザーの通知が無い場合は mongo.ErrNoDocuments）
+func (s *NotificationService) MarkAsRead(ctx context.Context, notificationID, userID primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": notificationID, "userId": userID},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// MarkAllAsRead ユーザーの未読の通知を全て既読にし、既読にした件数を返す
+func (s *NotificationService) MarkAllAsRead(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := s.collection.UpdateMany(ctx,
+		bson.M{"userId": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxCollection outbox イベントのコレクション名
+const outboxCollection = "outbox_events"
+
+// OutboxEventType outbox イベントの種類（メッセージの状態遷移）
+type OutboxEventType string
+
+const (
+	OutboxMessageDelivered      OutboxEventType = "message.delivered"       // 配信完了
+	OutboxMessageRetryScheduled OutboxEventType = "message.retry_scheduled" // 配信に失敗し、再試行を予定
+	OutboxMessageFailed         OutboxEventType = "message.failed"          // 配信失敗（failed）
+	OutboxMessageRetried        OutboxEventType = "message.retried"         // 送信者による手動再試行
+)
+
+// OutboxEventStatus outbox イベントの処理状態
+type OutboxEventStatus string
+
+const (
+	OutboxPending   OutboxEventStatus = "pending"   // 未処理（処理中・再試行待ちを含む）
+	OutboxPublished OutboxEventStatus = "published" // 全ての購読者が処理済み
+	OutboxFailed    OutboxEventStatus = "failed"    // 再試行の上限に達した
+)
+
+// MessageEvent メッセージの状態遷移の内容
+type MessageEvent struct {
+	MessageID     primitive.ObjectID `bson:"messageId" json:"messageId"`
+	SenderID      primitive.ObjectID `bson:"senderId" json:"senderId"`
+	RecipientID   primitive.ObjectID `bson:"recipientId,omitempty" json:"recipientId,omitempty"`
+	Status        MessageStatus      `bson:"status" json:"status"`                                   // 遷移後のメッセージの状態
+	Attempts      int                `bson:"attempts,omitempty" json:"attempts,omitempty"`           // 配信の試行回数
+	Reason        string             `bson:"reason,omitempty" json:"reason,omitempty"`               // 配信失敗の原因
+	NextAttemptAt *time.Time         `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"` // 次の配信の試行日時
+}
+
+// OutboxEvent 状態遷移と同じトランザクションで書き込むイベント
+// ディスパッチャーが購読者（通知・スケジュール同期・Webhook）に配信し、購読者ごとに処理済みを記録する
+type OutboxEvent struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type       OutboxEventType    `bson:"type" json:"type"`
+	Message    MessageEvent       `bson:"message" json:"message"`
+	OccurredAt time.Time          `bson:"occurredAt" json:"occurredAt"`
+	Status     OutboxEventStatus  `bson:"status" json:"status"`
+	// Completed 処理済みの購読者（再試行時に同じ購読者へ再配信しない）
+	Completed     []string       `bson:"completed,omitempty" json:"completed,omitempty"`
+	Attempts      int            `bson:"attempts,omitempty" json:"attempts,omitempty"`
+	NextAttemptAt *time.Time     `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	LastError     string         `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	Claim         *DeliveryClaim `bson:"claim,omitempty" json:"-"` // ディスパッチャーによる確保（処理中のみ）
+	PublishedAt   *time.Time     `bson:"publishedAt,omitempty" json:"publishedAt,omitempty"`
+}
+
+// newOutboxEvent 未処理の outbox イベントを作成
+func newOutboxEvent(eventType OutboxEventType, message MessageEvent) *OutboxEvent {
+	return &OutboxEvent{
+		Type:       eventType,
+		Message:    message,
+		OccurredAt: time.Now(),
+		Status:     OutboxPending,
+	}
+}
+
+// insertOutboxEvent outbox イベントを書き込む（状態遷移と同じトランザクションの中で呼ぶ）
+func insertOutboxEvent(ctx context.Context, db *mongo.Database, event *OutboxEvent) error {
+	result, err := db.Collection(outboxCollection).InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+	event.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// withTransaction fn を MongoDB のトランザクションで実行（レプリカセットが必要）
+// 一時的なトランザクションエラーの場合はドライバーが再実行するため、fn は再実行できるように書く
+func withTransaction(ctx context.Context, db *mongo.Database, fn func(sc mongo.SessionContext) error) error {
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// OutboxService outbox イベントを管理（ディスパッチャー用）
+type OutboxService struct {
+	collection *mongo.Collection
+}
+
+// NewOutboxService outbox サービスを作成
+func NewOutboxService(db *mongo.Database) *OutboxService {
+	return &OutboxService{
+		collection: db.Collection(outboxCollection),
+	}
+}
+
+// CreateIndexes outbox コレクションのインデックスを作成
+// トランザクションの中ではコレクションを作成できない場合があるため、起動時に作成しておく
+func (s *OutboxService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "occurredAt", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "message.messageId", Value: 1}},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// ClaimPendingEvent 処理できる未処理イベントを1件確保する（発生順、対象が無い場合は nil）
+// メッセージの確保と同じく findOneAndUpdate で確保するため、複数のディスパッチャーが同じイベントを処理することはない
+func (s *OutboxService) ClaimPendingEvent(ctx context.Context, owner string, lease time.Duration) (*OutboxEvent, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status": OutboxPending,
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"claim": bson.M{"$exists": false}},
+				{"claim.expiresAt": bson.M{"$lte": now}},
+			}},
+			{"$or": []bson.M{
+				{"nextAttemptAt": bson.M{"$exists": false}},
+				{"nextAttemptAt": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"claim": DeliveryClaim{Owner: owner, ClaimedAt: now, ExpiresAt: now.Add(lease)}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "occurredAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var event OutboxEvent
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// MarkConsumerCompleted 確保したイベントを購読者が処理済みであることを記録
+func (s *OutboxService) MarkConsumerCompleted(ctx context.Context, eventID primitive.ObjectID, owner, consumer string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID, "claim.owner": owner},
+		bson.M{"$addToSet": bson.M{"completed": consumer}},
+	)
+	return err
+}
+
+// MarkPublished 確保したイベントを全ての購読者が処理済みにして確保を解除
+func (s *OutboxService) MarkPublished(ctx context.Context, eventID primitive.ObjectID, owner string) error {
+	now := time.Now()
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID, "claim.owner": owner},
+		bson.M{
+			"$set":   bson.M{"status": OutboxPublished, "publishedAt": now},
+			"$unset": bson.M{"claim": "", "nextAttemptAt": ""},
+		},
+	)
+	return err
+}
+
+// ScheduleRetry 確保したイベントの処理失敗を記録し、nextAttemptAt に再試行するよう確保を解除する（試行回数を1増やす）
+func (s *OutboxService) ScheduleRetry(ctx context.Context, eventID primitive.ObjectID, owner string, nextAttemptAt time.Time, reason string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID, "claim.owner": owner},
+		bson.M{
+			"$inc":   bson.M{"attempts": 1},
+			"$set":   bson.M{"nextAttemptAt": nextAttemptAt, "lastError": reason},
+			"$unset": bson.M{"claim": ""},
+		},
+	)
+	return err
+}
+
+// MarkFailed 確保したイベントを再試行の上限に達した（failed）にして確保を解除
+func (s *OutboxService) MarkFailed(ctx context.Context, eventID primitive.ObjectID, owner string, reason string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID, "claim.owner": owner},
+		bson.M{
+			"$inc":   bson.M{"attempts": 1},
+			"$set":   bson.M{"status": OutboxFailed, "lastError": reason},
+			"$unset": bson.M{"claim": "", "nextAttemptAt": ""},
+		},
+	)
+	return err
+}
@@ -0,0 +1,346 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"yanwari-message-backend/config"
+)
+
+// PromptConfigSystemAuthor 起動時の取り込みなどシステムが作成したバージョンの作成者
+const PromptConfigSystemAuthor = "system"
+
+// ErrPromptConfigUnchanged 最新バージョンと内容が同じ場合のエラー
+var ErrPromptConfigUnchanged = errors.New("最新のバージョンと内容が同じです")
+
+// PromptConfigVersion 保存されたトーン設定（tone_prompts.yaml の内容）の1バージョン
+type PromptConfigVersion struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Version     int                 `bson:"version" json:"version"`
+	Content     string              `bson:"content" json:"content,omitempty"`
+	Checksum    string              `bson:"checksum" json:"checksum"`
+	Author      string              `bson:"author" json:"author"` // 作成者のメールアドレス（システムの場合は "system"）
+	AuthorID    *primitive.ObjectID `bson:"authorId,omitempty" json:"authorId,omitempty"`
+	Comment     string              `bson:"comment,omitempty" json:"comment,omitempty"`
+	Diff        string              `bson:"diff,omitempty" json:"diff,omitempty"` // 直前のバージョンとの差分（unified diff）
+	Active      bool                `bson:"active" json:"active"`
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+	ActivatedAt *time.Time          `bson:"activatedAt,omitempty" json:"activatedAt,omitempty"`
+	ActivatedBy string              `bson:"activatedBy,omitempty" json:"activatedBy,omitempty"`
+}
+
+// PromptConfigAuthor バージョンの作成・有効化を行ったユーザー
+type PromptConfigAuthor struct {
+	ID    *primitive.ObjectID
+	Email string
+}
+
+// NewPromptConfigAuthor ユーザーから作成者情報を作成
+func NewPromptConfigAuthor(user *User) PromptConfigAuthor {
+	return PromptConfigAuthor{ID: &user.ID, Email: user.Email}
+}
+
+// ToneConfig バージョンの内容をトーン設定として解析
+func (v *PromptConfigVersion) ToneConfig() (*config.ToneConfig, error) {
+	toneConfig, err := config.ParseToneConfig([]byte(v.Content))
+	if err != nil {
+		return nil, fmt.Errorf("バージョン%dの解析に失敗: %w", v.Version, err)
+	}
+	toneConfig.Version = v.Version
+	return toneConfig, nil
+}
+
+// PromptConfigService プロンプト設定のバージョン管理サービス
+type PromptConfigService struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	state      *mongo.Collection // 有効なバージョン番号（1ドキュメント）
+}
+
+// promptConfigActiveStateID 有効なバージョン番号を記録するドキュメントのID
+const promptConfigActiveStateID = "active"
+
+// NewPromptConfigService プロンプト設定サービスを作成
+func NewPromptConfigService(db *mongo.Database) *PromptConfigService {
+	return &PromptConfigService{
+		db:         db,
+		collection: db.Collection("prompt_config_versions"),
+		state:      db.Collection("prompt_config_state"),
+	}
+}
+
+// promptConfigChecksum 設定内容のチェックサム
+func promptConfigChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CreateVersion 新しいバージョンを保存（有効化はしない）
+// 内容が最新バージョンと同じ場合は最新バージョンと ErrPromptConfigUnchanged を返す
+func (s *PromptConfigService) CreateVersion(ctx context.Context, content string, author PromptConfigAuthor, comment string) (*PromptConfigVersion, error) {
+	// 解析できない設定は保存しない
+	if _, err := config.ParseToneConfig([]byte(content)); err != nil {
+		return nil, err
+	}
+	checksum := promptConfigChecksum(content)
+
+	// 同時に作成された場合はバージョン番号の一意制約で検出して採番し直す
+	for attempt := 0; attempt < 3; attempt++ {
+		latest, err := s.GetLatestVersion(ctx)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		version := &PromptConfigVersion{
+			ID:        primitive.NewObjectID(),
+			Version:   1,
+			Content:   content,
+			Checksum:  checksum,
+			Author:    author.Email,
+			AuthorID:  author.ID,
+			Comment:   comment,
+			CreatedAt: time.Now(),
+		}
+		if latest != nil {
+			if latest.Checksum == checksum {
+				return latest, ErrPromptConfigUnchanged
+			}
+			version.Version = latest.Version + 1
+			version.Diff = unifiedDiff(
+				fmt.Sprintf("v%d", latest.Version), fmt.Sprintf("v%d", version.Version),
+				latest.Content, content,
+			)
+		}
+
+		_, err = s.collection.InsertOne(ctx, version)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return version, nil
+	}
+
+	return nil, errors.New("バージョン番号の採番に失敗しました")
+}
+
+// GetLatestVersion 最新のバージョンを取得
+func (s *PromptConfigService) GetLatestVersion(ctx context.Context) (*PromptConfigVersion, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+
+	var version PromptConfigVersion
+	if err := s.collection.FindOne(ctx, bson.M{}, opts).Decode(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetVersion 指定したバージョンを取得
+func (s *PromptConfigService) GetVersion(ctx context.Context, number int) (*PromptConfigVersion, error) {
+	var version PromptConfigVersion
+	if err := s.collection.FindOne(ctx, bson.M{"version": number}).Decode(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetActiveVersion 有効なバージョンを取得
+// 有効化はトランザクションで行うため有効なバージョンは1つだけだが、トランザクション導入前のデータに備えて最後に有効化されたものを返す
+func (s *PromptConfigService) GetActiveVersion(ctx context.Context) (*PromptConfigVersion, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "activatedAt", Value: -1}})
+
+	var version PromptConfigVersion
+	if err := s.collection.FindOne(ctx, bson.M{"active": true}, opts).Decode(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ListVersions バージョン一覧を新しい順に取得（内容と差分は含まない）
+func (s *PromptConfigService) ListVersions(ctx context.Context, limit int64) ([]PromptConfigVersion, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"content": 0, "diff": 0})
+
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := []PromptConfigVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// DiffVersions 2つのバージョンの差分を unified diff 形式で取得
+func (s *PromptConfigService) DiffVersions(ctx context.Context, from, to int) (string, error) {
+	before, err := s.GetVersion(ctx, from)
+	if err != nil {
+		return "", err
+	}
+	after, err := s.GetVersion(ctx, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to), before.Content, after.Content), nil
+}
+
+// ActivateVersion 指定したバージョンを有効化し、このインスタンスのトーン設定を差し替える
+func (s *PromptConfigService) ActivateVersion(ctx context.Context, number int, activatedBy PromptConfigAuthor) (*PromptConfigVersion, error) {
+	version, err := s.GetVersion(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	toneConfig, err := version.ToneConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// 有効なバージョン番号のドキュメントを必ず書き換えるため、同時に有効化した場合は後のトランザクションが競合してやり直し、
+	// 有効なバージョンは常に1つになる
+	now := time.Now()
+	err = withTransaction(ctx, s.db, func(sc mongo.SessionContext) error {
+		if _, err := s.state.UpdateOne(sc,
+			bson.M{"_id": promptConfigActiveStateID},
+			bson.M{"$set": bson.M{"version": number, "activatedAt": now}, "$inc": bson.M{"revision": 1}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return err
+		}
+		if _, err := s.collection.UpdateMany(sc,
+			bson.M{"active": true, "version": bson.M{"$ne": number}},
+			bson.M{"$set": bson.M{"active": false}},
+		); err != nil {
+			return err
+		}
+		_, err := s.collection.UpdateOne(sc,
+			bson.M{"version": number},
+			bson.M{"$set": bson.M{"active": true, "activatedAt": now, "activatedBy": activatedBy.Email}},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.ActivateToneConfig(toneConfig)
+	log.Printf("✅ プロンプト設定 v%d を有効化しました (by %s)", number, activatedBy.Email)
+
+	version.Active = true
+	version.ActivatedAt = &now
+	version.ActivatedBy = activatedBy.Email
+	return version, nil
+}
+
+// RollbackVersion 有効なバージョンより1つ前のバージョンを有効化
+func (s *PromptConfigService) RollbackVersion(ctx context.Context, activatedBy PromptConfigAuthor) (*PromptConfigVersion, error) {
+	active, err := s.GetActiveVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.M{"version": 1})
+
+	var previous PromptConfigVersion
+	if err := s.collection.FindOne(ctx, bson.M{"version": bson.M{"$lt": active.Version}}, opts).Decode(&previous); err != nil {
+		return nil, err
+	}
+
+	return s.ActivateVersion(ctx, previous.Version, activatedBy)
+}
+
+// ApplyActiveVersion 有効なバージョンをこのインスタンスのトーン設定に反映
+// 既に反映済みの場合は何もしない。他のインスタンスでの有効化を取り込むために定期的に呼ばれる
+func (s *PromptConfigService) ApplyActiveVersion(ctx context.Context) error {
+	active, err := s.GetActiveVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current := config.CurrentToneConfig(); current != nil && current.Version == active.Version {
+		return nil
+	}
+
+	toneConfig, err := active.ToneConfig()
+	if err != nil {
+		return err
+	}
+	config.ActivateToneConfig(toneConfig)
+	log.Printf("✅ プロンプト設定 v%d を反映しました", active.Version)
+	return nil
+}
+
+// InitActiveVersion 起動時に有効なバージョンを反映
+// バージョンが1つも無い場合は設定ファイルの内容をバージョン1として保存して有効化する
+func (s *PromptConfigService) InitActiveVersion(ctx context.Context) error {
+	err := s.ApplyActiveVersion(ctx)
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	data, err := config.ReadToneConfigFile()
+	if err != nil {
+		return err
+	}
+	system := PromptConfigAuthor{Email: PromptConfigSystemAuthor}
+	version, err := s.CreateVersion(ctx, string(data), system, "設定ファイルから取り込み")
+	if err != nil && err != ErrPromptConfigUnchanged {
+		return err
+	}
+	_, err = s.ActivateVersion(ctx, version.Version, system)
+	return err
+}
+
+// StartSync 有効なバージョンを定期的に反映（ctx のキャンセルで停止）
+func (s *PromptConfigService) StartSync(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.ApplyActiveVersion(ctx); err != nil && err != mongo.ErrNoDocuments {
+					log.Printf("警告: プロンプト設定の同期エラー: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// CreateIndexes プロンプト設定コレクションのインデックスを作成
+func (s *PromptConfigService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "active", Value: 1},
+				{Key: "activatedAt", Value: -1},
+			},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// readHistoryWindow 既読時刻の分布を集計する期間
+	readHistoryWindow = 90 * 24 * time.Hour
+	// minReadSamples 既読時刻の分布を時間提案に使う最低件数（少ないと偶然の偏りで時間帯を除外してしまうため）
+	minReadSamples = 20
+	// maxAdjustHours 送信日時を受信者の読む時間帯までずらす上限
+	maxAdjustHours = 7 * 24
+)
+
+// RecipientScheduleProfile 時間提案に使う受信者の情報
+type RecipientScheduleProfile struct {
+	Location        *time.Location // 受信者のタイムゾーン
+	TimeRestriction string         // 受信者のメッセージ設定（none | business_hours | extended_hours）
+	ReadHours       [24]int        // 受信者のタイムゾーンでの既読時刻（時）の分布
+	ReadSamples     int            // 分布の元になった既読メッセージ数
+}
+
+// RecipientSignals 時間提案で考慮した受信者の情報（レスポンスで説明に使う）
+type RecipientSignals struct {
+	Timezone        string   `json:"timezone"`
+	TimeRestriction string   `json:"time_restriction,omitempty"`
+	AllowedHours    string   `json:"allowed_hours,omitempty"` // 時間制限による受信可能な時間帯（例: 9:00-18:00）
+	ReadSamples     int      `json:"read_samples"`
+	QuietHours      []int    `json:"quiet_hours,omitempty"` // 既読の無い時間帯（受信者のタイムゾーンの時）
+	Explanations    []string `json:"explanations"`          // 考慮した・しなかった情報の説明
+}
+
+// TimeRestrictionWindow 時間制限の設定値ごとの受信可能な時間帯（受信者のタイムゾーンの時、end は含まない）
+// 制限が無い場合は ok が false
+func TimeRestrictionWindow(restriction string) (start, end int, ok bool) {
+	switch restriction {
+	case "business_hours":
+		return 9, 18, true
+	case "extended_hours":
+		return 8, 20, true
+	default:
+		return 0, 24, false
+	}
+}
+
+// timeRestrictionLabel 時間制限の表示名
+func timeRestrictionLabel(restriction string) string {
+	switch restriction {
+	case "business_hours":
+		return "営業時間のみ"
+	case "extended_hours":
+		return "拡張時間"
+	default:
+		return "制限なし"
+	}
+}
+
+// usesReadHistory 既読時刻の分布を使えるだけの件数があるか
+func (p *RecipientScheduleProfile) usesReadHistory() bool {
+	return p.ReadSamples >= minReadSamples
+}
+
+// quietHour 既読の無い時間帯か（前後1時間にも既読が無い場合のみ。分布が少ない場合は常に false）
+func (p *RecipientScheduleProfile) quietHour(hour int) bool {
+	if !p.usesReadHistory() {
+		return false
+	}
+	return p.ReadHours[(hour+23)%24]+p.ReadHours[hour]+p.ReadHours[(hour+1)%24] == 0
+}
+
+// allowedHour 受信者の時間制限内で、かつ既読の無い時間帯でないか
+func (p *RecipientScheduleProfile) allowedHour(hour int) bool {
+	if start, end, ok := TimeRestrictionWindow(p.TimeRestriction); ok && (hour < start || hour >= end) {
+		return false
+	}
+	return !p.quietHour(hour)
+}
+
+// disallowReason 時間帯を避ける理由
+func (p *RecipientScheduleProfile) disallowReason(hour int) string {
+	if start, end, ok := TimeRestrictionWindow(p.TimeRestriction); ok && (hour < start || hour >= end) {
+		return "受信者の時間制限外"
+	}
+	return "受信者が普段読まない時間帯"
+}
+
+// quietHours 既読の無い時間帯の一覧
+func (p *RecipientScheduleProfile) quietHours() []int {
+	var hours []int
+	for hour := 0; hour < 24; hour++ {
+		if p.quietHour(hour) {
+			hours = append(hours, hour)
+		}
+	}
+	return hours
+}
+
+// PromptContext モデルへのプロンプトに含める受信者の情報
+func (p *RecipientScheduleProfile) PromptContext(now time.Time) string {
+	lines := []string{fmt.Sprintf("受信者の現在時刻: %s（%s）", now.In(p.Location).Format("2006-01-02 15:04"), p.Location)}
+	if start, end, ok := TimeRestrictionWindow(p.TimeRestriction); ok {
+		lines = append(lines, fmt.Sprintf("受信者の受信可能な時間帯: %d:00-%d:00", start, end))
+	}
+	if quiet := p.quietHours(); len(quiet) > 0 {
+		lines = append(lines, "受信者がメッセージを読まない時間帯: "+formatHours(quiet))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ApplyRecipientProfile 受信者の情報に合わせて各選択肢の送信日時を調整し、考慮した情報を RecipientSignals に記録する
+// 受信可能な時間帯外・既読の無い時間帯に当たる選択肢は、次に受信者が読む時間帯の開始時刻（正時）にずらす
+// ずらした結果、送信日時が重複した選択肢は先のものだけを残す
+func (s *ScheduleSuggestionResponse) ApplyRecipientProfile(profile *RecipientScheduleProfile, now time.Time) {
+	signals := &RecipientSignals{
+		Timezone:        profile.Location.String(),
+		TimeRestriction: profile.TimeRestriction,
+		ReadSamples:     profile.ReadSamples,
+		QuietHours:      profile.quietHours(),
+	}
+	signals.Explanations = append(signals.Explanations, fmt.Sprintf("受信者のタイムゾーン（%s）の時刻で判断しました", signals.Timezone))
+	if start, end, ok := TimeRestrictionWindow(profile.TimeRestriction); ok {
+		signals.AllowedHours = fmt.Sprintf("%d:00-%d:00", start, end)
+		signals.Explanations = append(signals.Explanations, fmt.Sprintf("受信者の時間制限（%s %s）外の送信は避けました", timeRestrictionLabel(profile.TimeRestriction), signals.AllowedHours))
+	}
+	switch {
+	case !profile.usesReadHistory():
+		signals.Explanations = append(signals.Explanations, fmt.Sprintf("既読履歴が少ないため（%d件）、読まれやすい時間帯は考慮していません", profile.ReadSamples))
+	case len(signals.QuietHours) > 0:
+		signals.Explanations = append(signals.Explanations, fmt.Sprintf("直近90日の既読時刻（%d件）から、読まれていない時間帯（%s）を避けました", profile.ReadSamples, formatHours(signals.QuietHours)))
+	default:
+		signals.Explanations = append(signals.Explanations, fmt.Sprintf("直近90日の既読時刻（%d件）では、避けるべき時間帯はありませんでした", profile.ReadSamples))
+	}
+	s.RecipientSignals = signals
+
+	options := make([]SuggestionOption, 0, len(s.SuggestedOptions))
+	seen := make(map[time.Time]bool, len(s.SuggestedOptions))
+	for _, option := range s.SuggestedOptions {
+		if option.ScheduledAt != nil {
+			if adjusted, ok := profile.nextAllowedTime(*option.ScheduledAt); ok && !adjusted.Equal(*option.ScheduledAt) {
+				reason := profile.disallowReason(option.ScheduledAt.In(profile.Location).Hour())
+				option.Adjustment = fmt.Sprintf("%sのため、受信者の時刻で %s に調整しました", reason, adjusted.In(profile.Location).Format("1/2 15:04"))
+				option.DelayMinutes = int(adjusted.Sub(now).Round(time.Minute) / time.Minute)
+				option.ScheduledAt = &adjusted
+			}
+			if seen[*option.ScheduledAt] {
+				continue
+			}
+			seen[*option.ScheduledAt] = true
+		}
+		options = append(options, option)
+	}
+	s.SuggestedOptions = normalizeOptionPriorities(options)
+}
+
+// nextAllowedTime at 以降で受信者が読む時間帯に入る最初の時刻（at が既に読む時間帯ならそのまま）
+// 上限までに見つからない場合は ok が false
+func (p *RecipientScheduleProfile) nextAllowedTime(at time.Time) (time.Time, bool) {
+	local := at.In(p.Location)
+	if p.allowedHour(local.Hour()) {
+		return at, true
+	}
+	candidate := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, p.Location)
+	for i := 0; i < maxAdjustHours; i++ {
+		candidate = candidate.Add(time.Hour)
+		if p.allowedHour(candidate.Hour()) {
+			return candidate.UTC(), true
+		}
+	}
+	return at, false
+}
+
+// formatHours 時の一覧を「0時〜5時, 23時」の形式で表示
+func formatHours(hours []int) string {
+	var parts []string
+	for i := 0; i < len(hours); {
+		j := i
+		for j+1 < len(hours) && hours[j+1] == hours[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprintf("%d時", hours[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d時〜%d時", hours[i], hours[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetReadHourHistogram 受信者が直近90日に既読にしたメッセージの、既読時刻（受信者のタイムゾーンの時）の分布を取得
+func (s *MessageService) GetReadHourHistogram(ctx context.Context, recipientID primitive.ObjectID, loc *time.Location) ([24]int, int, error) {
+	var histogram [24]int
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"recipientId": recipientID,
+			"readAt":      bson.M{"$gte": time.Now().Add(-readHistoryWindow)},
+		}},
+		{"$group": bson.M{
+			"_id":   bson.M{"$hour": bson.M{"date": "$readAt", "timezone": loc.String()}},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return histogram, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Hour  int `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return histogram, 0, err
+	}
+
+	total := 0
+	for _, row := range rows {
+		if row.Hour >= 0 && row.Hour < 24 {
+			histogram[row.Hour] = row.Count
+			total += row.Count
+		}
+	}
+	return histogram, total, nil
+}
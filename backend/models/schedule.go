@@ -22,6 +22,8 @@ type Schedule struct {
 	SentAt         *time.Time         `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
 	FailureReason  string             `bson:"failureReason,omitempty" json:"failureReason,omitempty"`
 	RetryCount     int                `bson:"retryCount" json:"retryCount"`
+	NextAttemptAt  *time.Time         `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"` // 配信に失敗して再試行を待っている場合の次の試行日時
+	LastEventAt    *time.Time         `bson:"lastEventAt,omitempty" json:"-"`                         // 反映済みの配信イベントの発生日時（古いイベントで上書きしないため）
 	Timezone       string             `bson:"timezone" json:"timezone"`
 }
 
@@ -38,6 +40,10 @@ type SuggestionOption struct {
 	Priority     string `json:"priority"`     // 最推奨|推奨|選択肢
 	Reason       string `json:"reason"`
 	DelayMinutes interface{} `json:"delay_minutes"` // number or "next_business_day_9am"
+	// ScheduledAt DelayMinutes を送信者のタイムゾーンで解決した送信日時（UTC）
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// Adjustment 受信者の時間帯に合わせて送信日時をずらした場合の説明
+	Adjustment string `json:"adjustment,omitempty"`
 }
 
 // ScheduleSuggestionResponse AI時間提案レスポンス
@@ -47,6 +53,14 @@ type ScheduleSuggestionResponse struct {
 	RecommendedTiming string             `json:"recommended_timing"`
 	Reasoning         string             `json:"reasoning"`
 	SuggestedOptions  []SuggestionOption `json:"suggested_options"`
+
+	// Source 提案の生成元（ai: モデルの応答 / rules: schedule_prompts.yaml のルール）
+	Source   string `json:"source,omitempty"`
+	Timezone string `json:"timezone,omitempty"` // ScheduledAt の解決に使った送信者のタイムゾーン
+	// Notes 応答の補正内容やルールに切り替えた理由
+	Notes []string `json:"notes,omitempty"`
+	// RecipientSignals 考慮した受信者の情報（受信者が未設定の場合は nil）
+	RecipientSignals *RecipientSignals `json:"recipient_signals,omitempty"`
 }
 
 // CreateScheduleRequest スケジュール作成リクエスト
@@ -56,12 +70,16 @@ type CreateScheduleRequest struct {
 	Timezone     string    `json:"timezone"`
 	FinalText    string    `json:"finalText"`
 	SelectedTone string    `json:"selectedTone"`
+	// ConfirmHarsh 送信するテキストが強く伝わる可能性がある場合でも送信する（確認ダイアログで「このまま送信」を選んだ場合）
+	ConfirmHarsh bool `json:"confirmHarsh"`
 }
 
 // UpdateScheduleRequest スケジュール更新リクエスト
 type UpdateScheduleRequest struct {
 	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
 	Status      string     `json:"status,omitempty"`
+	// ConfirmHarsh 送信するテキストが強く伝わる可能性がある場合でも送信する（CreateScheduleRequest と同じ）
+	ConfirmHarsh bool `json:"confirmHarsh"`
 }
 
 // ScheduleService スケジュール関連サービス
@@ -323,6 +341,89 @@ func (s *ScheduleService) MarkAsFailed(ctx context.Context, scheduleID primitive
 	return err
 }
 
+// messageEventFilter メッセージIDのスケジュールのうち、occurredAt より後に発生したイベントを反映していないもの
+// outbox イベントは遅れて届く・再試行されることがあるため、古いイベントで新しい状態（配信完了など）を上書きしない
+func messageEventFilter(messageID primitive.ObjectID, occurredAt time.Time) bson.M {
+	return bson.M{
+		"messageId": messageID,
+		"$or": []bson.M{
+			{"lastEventAt": bson.M{"$exists": false}},
+			{"lastEventAt": bson.M{"$lt": occurredAt}},
+		},
+	}
+}
+
+// MarkAsSentByMessageID メッセージIDによる送信済みマーク（occurredAt に発生した配信完了イベントを反映）
+func (s *ScheduleService) MarkAsSentByMessageID(ctx context.Context, messageID primitive.ObjectID, occurredAt time.Time) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":      "sent",
+			"sentAt":      occurredAt,
+			"lastEventAt": occurredAt,
+			"updatedAt":   now,
+		},
+		"$unset": bson.M{"nextAttemptAt": ""},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, messageEventFilter(messageID, occurredAt), update)
+	return err
+}
+
+// RecordRetryByMessageID メッセージIDによる配信失敗の記録（再試行待ち、status は pending のまま）
+// occurredAt より後のイベントを反映済みの場合は何もしない
+func (s *ScheduleService) RecordRetryByMessageID(ctx context.Context, messageID primitive.ObjectID, reason string, retryCount int, nextAttemptAt, occurredAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"failureReason": reason,
+			"retryCount":    retryCount,
+			"nextAttemptAt": nextAttemptAt,
+			"lastEventAt":   occurredAt,
+			"updatedAt":     time.Now(),
+		},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, messageEventFilter(messageID, occurredAt), update)
+	return err
+}
+
+// MarkAsFailedByMessageID メッセージIDによる送信失敗マーク（再試行の上限に達した・再試行しても配信できない）
+// occurredAt より後のイベントを反映済みの場合は何もしない
+func (s *ScheduleService) MarkAsFailedByMessageID(ctx context.Context, messageID primitive.ObjectID, reason string, retryCount int, occurredAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":        "failed",
+			"failureReason": reason,
+			"retryCount":    retryCount,
+			"lastEventAt":   occurredAt,
+			"updatedAt":     time.Now(),
+		},
+		"$unset": bson.M{"nextAttemptAt": ""},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, messageEventFilter(messageID, occurredAt), update)
+	return err
+}
+
+// ResetForRetryByMessageID メッセージIDによる送信失敗からの手動再試行（pending に戻し、再試行回数をリセット）
+// occurredAt より後のイベントを反映済みの場合は何もしない
+func (s *ScheduleService) ResetForRetryByMessageID(ctx context.Context, messageID primitive.ObjectID, occurredAt time.Time) error {
+	filter := messageEventFilter(messageID, occurredAt)
+	filter["status"] = "failed"
+	update := bson.M{
+		"$set": bson.M{
+			"status":      "pending",
+			"retryCount":  0,
+			"lastEventAt": occurredAt,
+			"updatedAt":   time.Now(),
+		},
+		"$unset": bson.M{"failureReason": "", "nextAttemptAt": ""},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
 // UpdateScheduleStatusByMessageID メッセージIDによるスケジュールステータス更新
 func (s *ScheduleService) UpdateScheduleStatusByMessageID(ctx context.Context, messageID primitive.ObjectID, status string) error {
 	now := time.Now()
@@ -337,6 +438,7 @@ func (s *ScheduleService) UpdateScheduleStatusByMessageID(ctx context.Context, m
 	// 送信済みの場合は送信時刻も記録
 	if status == "sent" {
 		update["$set"].(bson.M)["sentAt"] = now
+		update["$unset"] = bson.M{"nextAttemptAt": ""}
 	}
 
 	_, err := s.collection.UpdateOne(ctx, filter, update)
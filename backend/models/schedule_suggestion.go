@@ -0,0 +1,371 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"yanwari-message-backend/config"
+)
+
+// 時間提案の生成元
+const (
+	SuggestionSourceAI    = "ai"    // モデルの応答
+	SuggestionSourceRules = "rules" // schedule_prompts.yaml のルール（モデルの応答が使えない場合）
+)
+
+// 時間提案の各項目で使える値
+var (
+	suggestionMessageTypes  = []string{"謝罪", "お礼", "依頼", "報告", "相談", "確認", "連絡", "その他"}
+	suggestionUrgencyLevels = []string{"高", "中", "低"}
+	suggestionTimings       = []string{"今すぐ", "1時間以内", "当日中", "翌朝", "翌日中", "来週"}
+	suggestionPriorities    = []string{"最推奨", "推奨", "選択肢"}
+)
+
+// ScheduleSuggestionSchema 時間提案の応答の JSON Schema（LLMリクエストの ResponseFormat に指定する）
+var ScheduleSuggestionSchema = json.RawMessage(`{
+  "type": "object",
+  "required": ["message_type", "urgency_level", "recommended_timing", "reasoning", "suggested_options"],
+  "properties": {
+    "message_type": {"type": "string", "enum": ["謝罪", "お礼", "依頼", "報告", "相談", "確認", "連絡", "その他"]},
+    "urgency_level": {"type": "string", "enum": ["高", "中", "低"]},
+    "recommended_timing": {"type": "string", "enum": ["今すぐ", "1時間以内", "当日中", "翌朝", "翌日中", "来週"]},
+    "reasoning": {"type": "string"},
+    "suggested_options": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "required": ["option", "priority", "reason", "delay_minutes"],
+        "properties": {
+          "option": {"type": "string"},
+          "priority": {"type": "string", "enum": ["最推奨", "推奨", "選択肢"]},
+          "reason": {"type": "string"},
+          "delay_minutes": {
+            "description": "分数、または next_business_day_9am / tomorrow_10am / today_6pm / next_week_9am 形式",
+            "type": ["integer", "string"]
+          }
+        }
+      }
+    }
+  }
+}`)
+
+// maxSuggestionDelay 提案できる送信日時の上限（現在時刻から）
+const maxSuggestionDelay = 14 * 24 * time.Hour
+
+// delayExpressionPattern delay_minutes の日時表現（例: next_business_day_9am, tomorrow_8:30am, today_18）
+var delayExpressionPattern = regexp.MustCompile(`^(today|tomorrow|next_business_day|next_week)_(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+// ParseScheduleSuggestion 時間提案のJSONを解析してスキーマを検証し、各選択肢の送信日時を解決する
+// 選択肢単位の不備（優先度の表記揺れ・解決できない delay_minutes）は補正・除外して Notes に記録する
+// 必須項目が不正な場合や、有効な選択肢が1つも残らない場合はエラーを返す
+func ParseScheduleSuggestion(data []byte, now time.Time, loc *time.Location) (*ScheduleSuggestionResponse, error) {
+	var suggestion ScheduleSuggestionResponse
+	if err := json.Unmarshal(data, &suggestion); err != nil {
+		return nil, fmt.Errorf("AI応答の解析に失敗: %w", err)
+	}
+
+	var problems []string
+	if !containsString(suggestionUrgencyLevels, suggestion.UrgencyLevel) {
+		problems = append(problems, fmt.Sprintf("urgency_level が不正です: %q", suggestion.UrgencyLevel))
+	}
+	if !containsString(suggestionTimings, suggestion.RecommendedTiming) {
+		problems = append(problems, fmt.Sprintf("recommended_timing が不正です: %q", suggestion.RecommendedTiming))
+	}
+	if strings.TrimSpace(suggestion.Reasoning) == "" {
+		problems = append(problems, "reasoning がありません")
+	}
+	if !containsString(suggestionMessageTypes, suggestion.MessageType) {
+		suggestion.Notes = append(suggestion.Notes, fmt.Sprintf("message_type %q を「その他」として扱いました", suggestion.MessageType))
+		suggestion.MessageType = "その他"
+	}
+
+	options := make([]SuggestionOption, 0, len(suggestion.SuggestedOptions))
+	for i, option := range suggestion.SuggestedOptions {
+		if strings.TrimSpace(option.Option) == "" {
+			suggestion.Notes = append(suggestion.Notes, fmt.Sprintf("%d番目の選択肢は option が空のため除外しました", i+1))
+			continue
+		}
+		scheduledAt, err := ResolveSuggestionDelay(option.DelayMinutes, now, loc)
+		if err != nil {
+			suggestion.Notes = append(suggestion.Notes, fmt.Sprintf("選択肢「%s」を除外しました: %v", option.Option, err))
+			continue
+		}
+		if !containsString(suggestionPriorities, option.Priority) {
+			option.Priority = "選択肢"
+		}
+		option.ScheduledAt = &scheduledAt
+		options = append(options, option)
+	}
+	if len(options) == 0 {
+		problems = append(problems, "有効な suggested_options がありません")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("AI応答がスキーマに一致しません: %s", strings.Join(problems, ", "))
+	}
+
+	suggestion.SuggestedOptions = normalizeOptionPriorities(options)
+	suggestion.Source = SuggestionSourceAI
+	suggestion.Timezone = loc.String()
+	return &suggestion, nil
+}
+
+// ResolveSuggestionDelay delay_minutes を送信日時（UTC）に解決する
+//
+// 数値（文字列の数値を含む）は現在時刻からの分数として扱う。日時表現は送信者のタイムゾーンで解釈する:
+//   - today_6pm:             今日の18時（過去の場合はエラー）
+//   - tomorrow_9am:          翌日の9時
+//   - next_business_day_9am: 翌営業日（土日を除く）の9時
+//   - next_week_9am:         翌週月曜日の9時
+func ResolveSuggestionDelay(delay interface{}, now time.Time, loc *time.Location) (time.Time, error) {
+	var minutes float64
+	switch v := delay.(type) {
+	case float64:
+		minutes = v
+	case int:
+		minutes = float64(v)
+	case string:
+		expression := strings.ToLower(strings.TrimSpace(v))
+		if n, err := strconv.ParseFloat(expression, 64); err == nil {
+			minutes = n
+			break
+		}
+		return resolveDelayExpression(expression, now, loc)
+	case nil:
+		return time.Time{}, fmt.Errorf("delay_minutes がありません")
+	default:
+		return time.Time{}, fmt.Errorf("delay_minutes の形式が不正です: %v", v)
+	}
+
+	if math.IsNaN(minutes) || math.IsInf(minutes, 0) {
+		return time.Time{}, fmt.Errorf("delay_minutes が数値ではありません: %v", minutes)
+	}
+	if minutes < 0 {
+		return time.Time{}, fmt.Errorf("delay_minutes が負の値です: %v", minutes)
+	}
+	// Duration に変換するとオーバーフローするため、上限は分数のまま比較する
+	if minutes > maxSuggestionDelay.Minutes() {
+		return time.Time{}, fmt.Errorf("delay_minutes が長すぎます: %v分", minutes)
+	}
+	return now.Add(time.Duration(math.Round(minutes)) * time.Minute).UTC(), nil
+}
+
+// resolveDelayExpression next_business_day_9am 形式の日時表現を解決する
+func resolveDelayExpression(expression string, now time.Time, loc *time.Location) (time.Time, error) {
+	match := delayExpressionPattern.FindStringSubmatch(expression)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("delay_minutes の日時表現を解釈できません: %q", expression)
+	}
+
+	hour, _ := strconv.Atoi(match[2])
+	minute := 0
+	if match[3] != "" {
+		minute, _ = strconv.Atoi(match[3])
+	}
+	if match[4] != "" && (hour == 0 || hour > 12) {
+		return time.Time{}, fmt.Errorf("delay_minutes の時刻が不正です: %q", expression)
+	}
+	switch match[4] {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("delay_minutes の時刻が不正です: %q", expression)
+	}
+
+	local := now.In(loc)
+	days := 0
+	switch match[1] {
+	case "tomorrow":
+		days = 1
+	case "next_business_day":
+		for days = 1; scheduleDayKey(local.AddDate(0, 0, days).Weekday()) == "weekend"; days++ {
+		}
+	case "next_week":
+		days = (int(time.Monday) - int(local.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+	}
+
+	scheduledAt := time.Date(local.Year(), local.Month(), local.Day()+days, hour, minute, 0, 0, loc)
+	if !scheduledAt.After(now) {
+		return time.Time{}, fmt.Errorf("delay_minutes が過去の時刻です: %q", expression)
+	}
+	return scheduledAt.UTC(), nil
+}
+
+// normalizeOptionPriorities 「最推奨」がちょうど1つになるよう補正する（無い場合は先頭、複数ある場合は2つ目以降を「推奨」に）
+func normalizeOptionPriorities(options []SuggestionOption) []SuggestionOption {
+	recommended := false
+	for i := range options {
+		if options[i].Priority != "最推奨" {
+			continue
+		}
+		if recommended {
+			options[i].Priority = "推奨"
+		}
+		recommended = true
+	}
+	if !recommended && len(options) > 0 {
+		options[0].Priority = "最推奨"
+	}
+	return options
+}
+
+// messageTypeKeywords メッセージ種別の判定キーワード（先に一致した種別を優先）
+var messageTypeKeywords = []struct {
+	messageType string
+	keywords    []string
+}{
+	{"謝罪", []string{"すみません", "申し訳", "ごめん", "失礼しました"}},
+	{"お礼", []string{"ありがとう", "感謝", "助かりました"}},
+	{"依頼", []string{"ください", "お願い", "もらえ", "いただけ"}},
+	{"報告", []string{"報告", "完了", "終わりました", "しました"}},
+}
+
+// ClassifyMessageType キーワードからメッセージ種別を判定（該当なしの場合は「連絡」）
+func ClassifyMessageType(messageText string) string {
+	for _, candidate := range messageTypeKeywords {
+		for _, keyword := range candidate.keywords {
+			if strings.Contains(messageText, keyword) {
+				return candidate.messageType
+			}
+		}
+	}
+	return "連絡"
+}
+
+// NewRuleBasedScheduleSuggestion schedule_prompts.yaml のルールから決定的な時間提案を作成
+// default_suggestions でメッセージ種別ごとの緊急度・推奨タイミングを決め、
+// time_considerations / day_considerations で送信者の現在時刻に応じた配慮を加える（cfg が nil の場合は組み込みの既定値）
+func NewRuleBasedScheduleSuggestion(cfg *config.ScheduleConfig, messageText string, now time.Time, loc *time.Location) *ScheduleSuggestionResponse {
+	suggestion := &ScheduleSuggestionResponse{
+		MessageType:       ClassifyMessageType(messageText),
+		UrgencyLevel:      "中",
+		RecommendedTiming: "当日中",
+		Reasoning:         "緊急性の高くない連絡のため、相手の都合の良い時間帯での送信を推奨します。",
+		Source:            SuggestionSourceRules,
+		Timezone:          loc.String(),
+	}
+	if cfg != nil {
+		if d, ok := cfg.DefaultSuggestions[suggestion.MessageType]; ok {
+			suggestion.UrgencyLevel = d.UrgencyLevel
+			suggestion.RecommendedTiming = d.RecommendedTiming
+			suggestion.Reasoning = d.Reasoning
+		}
+	}
+
+	// 送信者の現在時刻が業務時間外・休日の場合は、緊急でなければ翌営業日の朝を勧める
+	local := now.In(loc)
+	band, dayKey := scheduleTimeBand(local.Hour()), scheduleDayKey(local.Weekday())
+	offHours := band != "business_hours" || dayKey == "weekend"
+	var considerations []string
+	if cfg != nil {
+		if t, ok := cfg.TimeConsiderations[band]; ok {
+			considerations = appendNonEmpty(considerations, firstNonEmpty(t.StrongCaution, t.Caution))
+		}
+		if d, ok := cfg.DayConsiderations[dayKey]; ok {
+			considerations = appendNonEmpty(considerations, firstNonEmpty(d.Caution, d.Note))
+		}
+	}
+	deferToMorning := offHours && suggestion.UrgencyLevel != "高"
+	if deferToMorning {
+		switch suggestion.RecommendedTiming {
+		case "今すぐ", "1時間以内", "当日中":
+			suggestion.RecommendedTiming = "翌朝"
+		}
+	}
+	if len(considerations) > 0 {
+		suggestion.Reasoning += strings.Join(considerations, "。") + "。"
+	}
+
+	options := []SuggestionOption{
+		{Option: "今すぐ送信", Priority: "選択肢", Reason: "すぐに内容を伝えられます", DelayMinutes: 0},
+		{Option: "1時間後", Priority: "選択肢", Reason: "少し時間を置いて落ち着いて送信できます", DelayMinutes: 60},
+		{Option: "翌営業日の朝9時", Priority: "選択肢", Reason: "相手が確認しやすい時間帯です", DelayMinutes: "next_business_day_9am"},
+		{Option: "翌営業日の朝10時", Priority: "選択肢", Reason: "朝の立て込む時間を避けられます", DelayMinutes: "next_business_day_10am"},
+	}
+	switch {
+	case suggestion.UrgencyLevel == "高" || suggestion.RecommendedTiming == "今すぐ":
+		options[0].Priority = "最推奨"
+	case suggestion.RecommendedTiming == "1時間以内" || suggestion.RecommendedTiming == "当日中":
+		options[1].Priority = "最推奨"
+	default:
+		options[2].Priority = "最推奨"
+	}
+	for i := range options {
+		scheduledAt, _ := ResolveSuggestionDelay(options[i].DelayMinutes, now, loc)
+		options[i].ScheduledAt = &scheduledAt
+	}
+	suggestion.SuggestedOptions = options
+
+	return suggestion
+}
+
+// scheduleTimeBand 時刻から time_considerations のキーを決める
+func scheduleTimeBand(hour int) string {
+	switch {
+	case hour >= 6 && hour < 9:
+		return "early_morning"
+	case hour >= 9 && hour < 18:
+		return "business_hours"
+	case hour >= 18 && hour < 22:
+		return "evening"
+	default:
+		return "night"
+	}
+}
+
+// scheduleDayKey 曜日から day_considerations のキーを決める
+func scheduleDayKey(weekday time.Weekday) string {
+	switch weekday {
+	case time.Saturday, time.Sunday:
+		return "weekend"
+	case time.Monday:
+		return "monday"
+	case time.Friday:
+		return "friday"
+	default:
+		return ""
+	}
+}
+
+// containsString values に value が含まれるか
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// firstNonEmpty 最初の空でない文字列
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// appendNonEmpty 空でない場合のみ追加
+func appendNonEmpty(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	return append(values, value)
+}
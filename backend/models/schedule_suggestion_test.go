@@ -0,0 +1,176 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// jst テスト用の送信者のタイムゾーン
+var jst = time.FixedZone("JST", 9*60*60)
+
+func TestResolveSuggestionDelay(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, jst) // 金曜日 10:00
+
+	tests := []struct {
+		name    string
+		delay   interface{}
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "分数", delay: float64(30), want: now.Add(30 * time.Minute)},
+		{name: "整数", delay: 45, want: now.Add(45 * time.Minute)},
+		{name: "文字列の分数", delay: " 90 ", want: now.Add(90 * time.Minute)},
+		{name: "端数は丸める", delay: "1.4", want: now.Add(time.Minute)},
+		{name: "上限ちょうど", delay: maxSuggestionDelay.Minutes(), want: now.Add(maxSuggestionDelay)},
+		{name: "today", delay: "today_6pm", want: time.Date(2026, 10, 16, 18, 0, 0, 0, jst)},
+		{name: "today 24時間表記", delay: "today_18", want: time.Date(2026, 10, 16, 18, 0, 0, 0, jst)},
+		{name: "tomorrow 分あり", delay: "tomorrow_8:30am", want: time.Date(2026, 10, 17, 8, 30, 0, 0, jst)},
+		{name: "next_business_day は週末を飛ばす", delay: "next_business_day_9am", want: time.Date(2026, 10, 19, 9, 0, 0, 0, jst)},
+		{name: "next_week は翌週月曜日", delay: "NEXT_WEEK_9AM", want: time.Date(2026, 10, 19, 9, 0, 0, 0, jst)},
+		{name: "12am は0時", delay: "tomorrow_12am", want: time.Date(2026, 10, 17, 0, 0, 0, 0, jst)},
+		{name: "過去の時刻", delay: "today_9am", wantErr: true},
+		{name: "不正な時刻", delay: "today_13pm", wantErr: true},
+		{name: "不正な分", delay: "tomorrow_9:75", wantErr: true},
+		{name: "解釈できない表現", delay: "someday", wantErr: true},
+		{name: "負の値", delay: "-5", wantErr: true},
+		{name: "上限超過", delay: maxSuggestionDelay.Minutes() + 1, wantErr: true},
+		{name: "Duration がオーバーフローする値", delay: 1e300, wantErr: true},
+		{name: "inf", delay: "inf", wantErr: true},
+		{name: "Infinity", delay: "Infinity", wantErr: true},
+		{name: "-Infinity", delay: "-Infinity", wantErr: true},
+		{name: "NaN", delay: "NaN", wantErr: true},
+		{name: "なし", delay: nil, wantErr: true},
+		{name: "不正な型", delay: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSuggestionDelay(tt.delay, now, jst)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveSuggestionDelay(%v) = %v, want error", tt.delay, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSuggestionDelay(%v) error: %v", tt.delay, err)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("ResolveSuggestionDelay(%v) = %v, want %v in UTC", tt.delay, got, tt.want.UTC())
+			}
+		})
+	}
+}
+
+func TestParseScheduleSuggestion(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, jst)
+
+	data := `{
+		"message_type": "問い合わせ",
+		"urgency_level": "中",
+		"recommended_timing": "当日中",
+		"reasoning": "業務時間内の送信が適切です",
+		"suggested_options": [
+			{"option": "1時間後", "priority": "推奨", "reason": "r", "delay_minutes": 60},
+			{"option": "無期限", "priority": "最推奨", "reason": "r", "delay_minutes": "Infinity"},
+			{"option": "", "priority": "推奨", "reason": "r", "delay_minutes": 30},
+			{"option": "夕方", "priority": "おすすめ", "reason": "r", "delay_minutes": "today_6pm"}
+		]
+	}`
+	suggestion, err := ParseScheduleSuggestion([]byte(data), now, jst)
+	if err != nil {
+		t.Fatalf("ParseScheduleSuggestion error: %v", err)
+	}
+	if suggestion.MessageType != "その他" || suggestion.Source != SuggestionSourceAI {
+		t.Errorf("MessageType = %q, Source = %q, want その他, %s", suggestion.MessageType, suggestion.Source, SuggestionSourceAI)
+	}
+	if len(suggestion.SuggestedOptions) != 2 {
+		t.Fatalf("SuggestedOptions = %+v, want 2 options", suggestion.SuggestedOptions)
+	}
+	if got := suggestion.SuggestedOptions[0].Priority; got != "最推奨" {
+		t.Errorf("first option priority = %q, want 最推奨", got)
+	}
+	if got := suggestion.SuggestedOptions[1].Priority; got != "選択肢" {
+		t.Errorf("unknown priority = %q, want 選択肢", got)
+	}
+	if len(suggestion.Notes) != 3 {
+		t.Errorf("Notes = %v, want 3 notes", suggestion.Notes)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"message_type": "依頼", "urgency_level": "最高", "recommended_timing": "当日中", "reasoning": "r", "suggested_options": [{"option": "今すぐ", "delay_minutes": 0}]}`,
+		`{"message_type": "依頼", "urgency_level": "中", "recommended_timing": "当日中", "reasoning": " ", "suggested_options": [{"option": "今すぐ", "delay_minutes": 0}]}`,
+		`{"message_type": "依頼", "urgency_level": "中", "recommended_timing": "当日中", "reasoning": "r", "suggested_options": [{"option": "いつか", "delay_minutes": "inf"}]}`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseScheduleSuggestion([]byte(data), now, jst); err == nil {
+			t.Errorf("ParseScheduleSuggestion(%s) error = nil, want error", data)
+		}
+	}
+}
+
+func TestNewRuleBasedScheduleSuggestion(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		now         time.Time
+		wantType    string
+		wantTiming  string
+		recommended string
+	}{
+		{
+			name:        "業務時間内は1時間後を勧める",
+			text:        "資料を確認していただけますか",
+			now:         time.Date(2026, 10, 14, 10, 0, 0, 0, jst), // 水曜日 10:00
+			wantType:    "依頼",
+			wantTiming:  "当日中",
+			recommended: "1時間後",
+		},
+		{
+			name:        "業務時間外は翌営業日の朝を勧める",
+			text:        "資料を確認していただけますか",
+			now:         time.Date(2026, 10, 16, 21, 0, 0, 0, jst), // 金曜日 21:00
+			wantType:    "依頼",
+			wantTiming:  "翌朝",
+			recommended: "翌営業日の朝9時",
+		},
+		{
+			name:        "休日は翌営業日の朝を勧める",
+			text:        "先日はありがとうございました",
+			now:         time.Date(2026, 10, 17, 11, 0, 0, 0, jst), // 土曜日 11:00
+			wantType:    "お礼",
+			wantTiming:  "翌朝",
+			recommended: "翌営業日の朝9時",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestion := NewRuleBasedScheduleSuggestion(nil, tt.text, tt.now, jst)
+			if suggestion.MessageType != tt.wantType || suggestion.RecommendedTiming != tt.wantTiming {
+				t.Errorf("MessageType = %q, RecommendedTiming = %q, want %q, %q", suggestion.MessageType, suggestion.RecommendedTiming, tt.wantType, tt.wantTiming)
+			}
+			if suggestion.Source != SuggestionSourceRules || suggestion.Timezone != jst.String() {
+				t.Errorf("Source = %q, Timezone = %q, want %s, %s", suggestion.Source, suggestion.Timezone, SuggestionSourceRules, jst)
+			}
+
+			var recommended []string
+			for _, option := range suggestion.SuggestedOptions {
+				if option.ScheduledAt == nil || option.ScheduledAt.Before(tt.now) {
+					t.Errorf("option %q ScheduledAt = %v, want resolved time not before now", option.Option, option.ScheduledAt)
+				}
+				if option.Priority == "最推奨" {
+					recommended = append(recommended, option.Option)
+				}
+			}
+			if len(recommended) != 1 || recommended[0] != tt.recommended {
+				t.Errorf("最推奨 = %v, want [%s]", recommended, tt.recommended)
+			}
+			if strings.TrimSpace(suggestion.Reasoning) == "" {
+				t.Error("Reasoning is empty")
+			}
+		})
+	}
+}
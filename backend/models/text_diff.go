@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOpKind 差分の操作種別
+type diffOpKind int
+
+const (
+	diffEqual  diffOpKind = iota // 共通
+	diffDelete                   // 削除（変更前のみ）
+	diffInsert                   // 追加（変更後のみ）
+)
+
+// diffOp 差分の1要素
+type diffOp struct {
+	kind diffOpKind
+	text string
+}
+
+// diffTokens 最長共通部分列に基づいて2つの列の差分を計算
+func diffTokens(before, after []string) []diffOp {
+	// lcs[i][j] = before[i:] と after[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(before)+len(after))
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			ops = append(ops, diffOp{diffEqual, before[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{diffDelete, before[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{diffInsert, after[j]})
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		ops = append(ops, diffOp{diffDelete, before[i]})
+	}
+	for ; j < len(after); j++ {
+		ops = append(ops, diffOp{diffInsert, after[j]})
+	}
+	return ops
+}
+
+// unifiedDiffContext unified diff で変更箇所の前後に表示する行数
+const unifiedDiffContext = 3
+
+// unifiedDiff 行単位の差分を unified diff 形式で生成（差分が無い場合は空文字）
+func unifiedDiff(beforeName, afterName, before, after string) string {
+	ops := diffTokens(splitLines(before), splitLines(after))
+
+	// 変更行の前後 unifiedDiffContext 行を含む範囲をハンクとしてまとめる
+	type hunk struct{ start, end int }
+	var hunks []hunk
+	for i, op := range ops {
+		if op.kind == diffEqual {
+			continue
+		}
+		start := max(i-unifiedDiffContext, 0)
+		end := min(i+unifiedDiffContext+1, len(ops))
+		if n := len(hunks); n > 0 && start <= hunks[n-1].end {
+			hunks[n-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", beforeName, afterName)
+
+	beforeLine, afterLine := 1, 1
+	pos := 0
+	for _, h := range hunks {
+		// ハンク開始位置までの行番号を進める
+		for ; pos < h.start; pos++ {
+			if ops[pos].kind != diffInsert {
+				beforeLine++
+			}
+			if ops[pos].kind != diffDelete {
+				afterLine++
+			}
+		}
+
+		beforeCount, afterCount := 0, 0
+		for _, op := range ops[h.start:h.end] {
+			if op.kind != diffInsert {
+				beforeCount++
+			}
+			if op.kind != diffDelete {
+				afterCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", beforeLine, beforeCount, afterLine, afterCount)
+
+		for ; pos < h.end; pos++ {
+			op := ops[pos]
+			switch op.kind {
+			case diffEqual:
+				b.WriteString(" " + op.text + "\n")
+				beforeLine++
+				afterLine++
+			case diffDelete:
+				b.WriteString("-" + op.text + "\n")
+				beforeLine++
+			case diffInsert:
+				b.WriteString("+" + op.text + "\n")
+				afterLine++
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// splitLines テキストを行に分割（末尾の改行は無視）
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
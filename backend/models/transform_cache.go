@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransformCacheEntry AIトーン変換結果のキャッシュエントリ
+// キーはレンダリング済みプロンプトとモデル名のハッシュのため、
+// tone_prompts.yaml を変更すると自然に別キーとなり古いエントリは使われなくなる
+type TransformCacheEntry struct {
+	Key       string    `bson:"_id" json:"key"`
+	Provider  string    `bson:"provider" json:"provider"`
+	Model     string    `bson:"model" json:"model"`
+	Tone      string    `bson:"tone" json:"tone"`
+	Text      string    `bson:"text" json:"text"`
+	HitCount  int64     `bson:"hitCount" json:"hitCount"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// TransformCacheStats キャッシュの統計情報
+type TransformCacheStats struct {
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	Bypassed   int64   `json:"bypassed"`
+	HitRate    float64 `json:"hitRate"`
+	Entries    int64   `json:"entries"`
+	TTLSeconds int64   `json:"ttlSeconds"`
+}
+
+// TransformCacheService AIトーン変換キャッシュサービス
+type TransformCacheService struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+	hits       int64
+	misses     int64
+	bypassed   int64
+}
+
+// NewTransformCacheService トーン変換キャッシュサービスを作成
+func NewTransformCacheService(db *mongo.Database, ttl time.Duration) *TransformCacheService {
+	return &TransformCacheService{
+		collection: db.Collection("transform_cache"),
+		ttl:        ttl,
+	}
+}
+
+// TransformCacheKey プロバイダー名・モデル名・レンダリング済みプロンプトからキャッシュキーを計算
+func TransformCacheKey(provider, model, prompt string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + model + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get キャッシュを検索（ヒットした場合はヒット数を加算）
+func (s *TransformCacheService) Get(ctx context.Context, key string) (*TransformCacheEntry, bool, error) {
+	var entry TransformCacheEntry
+
+	// TTLインデックスの削除は遅延があるため有効期限も条件に含める
+	filter := bson.M{
+		"_id":       key,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	update := bson.M{"$inc": bson.M{"hitCount": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		atomic.AddInt64(&s.misses, 1)
+		return nil, false, nil
+	}
+	if err != nil {
+		atomic.AddInt64(&s.misses, 1)
+		return nil, false, err
+	}
+
+	atomic.AddInt64(&s.hits, 1)
+	return &entry, true, nil
+}
+
+// Set 変換結果をキャッシュに保存
+func (s *TransformCacheService) Set(ctx context.Context, entry *TransformCacheEntry) error {
+	now := time.Now()
+	entry.CreatedAt = now
+	entry.ExpiresAt = now.Add(s.ttl)
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": entry.Key}, entry, opts)
+	return err
+}
+
+// RecordBypass force 指定によりキャッシュを迂回したことを記録
+func (s *TransformCacheService) RecordBypass() {
+	atomic.AddInt64(&s.bypassed, 1)
+}
+
+// GetStats キャッシュの統計情報を取得（ヒット・ミス数はプロセス起動以降の累計）
+func (s *TransformCacheService) GetStats(ctx context.Context) (*TransformCacheStats, error) {
+	entries, err := s.collection.CountDocuments(ctx, bson.M{"expiresAt": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := atomic.LoadInt64(&s.hits)
+	misses := atomic.LoadInt64(&s.misses)
+	stats := &TransformCacheStats{
+		Hits:       hits,
+		Misses:     misses,
+		Bypassed:   atomic.LoadInt64(&s.bypassed),
+		Entries:    entries,
+		TTLSeconds: int64(s.ttl.Seconds()),
+	}
+	if hits+misses > 0 {
+		stats.HitRate = float64(hits) / float64(hits+misses)
+	}
+
+	return stats, nil
+}
+
+// CreateIndexes キャッシュコレクションのインデックスを作成
+func (s *TransformCacheService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			// 有効期限を過ぎたエントリを自動削除
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
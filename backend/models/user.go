@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -22,8 +23,13 @@ type User struct {
 	Timezone     string             `bson:"timezone" json:"timezone"`
 	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	// PreferredLanguage メッセージを受け取るときの希望言語（ja, en, zh, ko。未設定の場合は翻訳しない）
+	PreferredLanguage string `bson:"preferred_language,omitempty" json:"preferred_language,omitempty"`
 }
 
+// ErrUserNotFound 指定したユーザーが存在しない
+var ErrUserNotFound = errors.New("ユーザーが見つかりません")
+
 // UserService ユーザー関連のデータベース操作を担当
 type UserService struct {
 	collection *mongo.Collection
@@ -93,7 +99,7 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*User, error)
 	
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("ユーザーが見つかりません")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("ユーザー取得エラー: %w", err)
 	}
@@ -281,6 +287,30 @@ func (s *UserService) UpdateProfile(ctx context.Context, userID primitive.Object
 	return nil
 }
 
+// UpdatePreferredLanguage ユーザーの希望言語を更新
+func (s *UserService) UpdatePreferredLanguage(ctx context.Context, userID primitive.ObjectID, lang string) error {
+	now := time.Now()
+
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"preferred_language": lang,
+			"updated_at":         now,
+		},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("希望言語の更新エラー: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("更新対象のユーザーが見つかりません")
+	}
+
+	return nil
+}
+
 // UpdatePassword ユーザーのパスワードを更新
 func (s *UserService) UpdatePassword(ctx context.Context, userID primitive.ObjectID, passwordHash string) error {
 	now := time.Now()
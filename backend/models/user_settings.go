@@ -20,6 +20,8 @@ type UserSettings struct {
 	TimeRestriction       string             `bson:"timeRestriction" json:"timeRestriction"`
 	CreatedAt             time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt             time.Time          `bson:"updatedAt" json:"updatedAt"`
+	// WebhookURL 受信したメッセージの転送と、送信したメッセージの配信状況の通知に使うURL（未設定の場合は呼び出さない）
+	WebhookURL string `bson:"webhookUrl,omitempty" json:"webhookUrl,omitempty"`
 }
 
 // NotificationSettings 通知設定
@@ -27,6 +29,8 @@ type NotificationSettings struct {
 	EmailNotifications   bool `json:"emailNotifications"`
 	SendNotifications    bool `json:"sendNotifications"`
 	BrowserNotifications bool `json:"browserNotifications"`
+	// WebhookURL 受信したメッセージの転送先（省略時は変更しない、空文字で解除）
+	WebhookURL *string `json:"webhookUrl,omitempty" binding:"omitempty,max=500"`
 }
 
 // MessageSettings メッセージ設定
@@ -39,6 +43,8 @@ type MessageSettings struct {
 type UpdateProfileRequest struct {
 	Name  string `json:"name" binding:"max=100"`
 	Email string `json:"email" binding:"omitempty,email,max=255"`
+	// PreferredLanguage メッセージを受け取るときの希望言語（送信者が翻訳を選んだ場合にこの言語で届く）
+	PreferredLanguage string `json:"preferredLanguage" binding:"omitempty,oneof=ja en zh ko"`
 }
 
 // ChangePasswordRequest パスワード変更リクエスト
@@ -61,6 +67,21 @@ func NewUserSettingsService(db *mongo.Database, userService *UserService) *UserS
 	}
 }
 
+// defaultUserSettings 設定が存在しないユーザーのデフォルト設定
+func defaultUserSettings(userID primitive.ObjectID) UserSettings {
+	now := time.Now()
+	return UserSettings{
+		UserID:               userID,
+		EmailNotifications:   true,
+		SendNotifications:    true,
+		BrowserNotifications: false,
+		DefaultTone:          "gentle",
+		TimeRestriction:      "none",
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+}
+
 // GetOrCreateSettings ユーザー設定を取得または作成
 func (s *UserSettingsService) GetOrCreateSettings(ctx context.Context, userID primitive.ObjectID) (*UserSettings, error) {
 	var settings UserSettings
@@ -73,17 +94,7 @@ func (s *UserSettingsService) GetOrCreateSettings(ctx context.Context, userID pr
 
 	// 設定が存在しない場合、デフォルト設定を作成
 	if err == mongo.ErrNoDocuments {
-		now := time.Now()
-		settings = UserSettings{
-			UserID:               userID,
-			EmailNotifications:   true,
-			SendNotifications:    true,
-			BrowserNotifications: false,
-			DefaultTone:          "gentle",
-			TimeRestriction:      "none",
-			CreatedAt:            now,
-			UpdatedAt:            now,
-		}
+		settings = defaultUserSettings(userID)
 
 		result, err := s.collection.InsertOne(ctx, settings)
 		if err != nil {
@@ -97,6 +108,35 @@ func (s *UserSettingsService) GetOrCreateSettings(ctx context.Context, userID pr
 	return nil, err
 }
 
+// GetSettings ユーザー設定を取得（設定が無い場合はデフォルト設定）
+// 他のユーザー（受信者）の設定を参照するため、GetOrCreateSettings と違い設定を作成しない
+func (s *UserSettingsService) GetSettings(ctx context.Context, userID primitive.ObjectID) (*UserSettings, error) {
+	var settings UserSettings
+	err := s.collection.FindOne(ctx, bson.M{"userId": userID}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		settings = defaultUserSettings(userID)
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetTimeRestriction ユーザーの時間制限の設定を取得（設定が無い場合は "none"）
+// 他のユーザー（受信者）の設定を参照するため、GetOrCreateSettings と違い設定を作成しない
+func (s *UserSettingsService) GetTimeRestriction(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	var settings UserSettings
+	err := s.collection.FindOne(ctx, bson.M{"userId": userID}).Decode(&settings)
+	if err == mongo.ErrNoDocuments || (err == nil && settings.TimeRestriction == "") {
+		return "none", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return settings.TimeRestriction, nil
+}
+
 // UpdateNotificationSettings 通知設定を更新
 func (s *UserSettingsService) UpdateNotificationSettings(ctx context.Context, userID primitive.ObjectID, settings *NotificationSettings) error {
 	now := time.Now()
@@ -109,6 +149,13 @@ func (s *UserSettingsService) UpdateNotificationSettings(ctx context.Context, us
 			"updatedAt":            now,
 		},
 	}
+	if settings.WebhookURL != nil {
+		if *settings.WebhookURL == "" {
+			update["$unset"] = bson.M{"webhookUrl": ""}
+		} else {
+			update["$set"].(bson.M)["webhookUrl"] = *settings.WebhookURL
+		}
+	}
 
 	_, err := s.collection.UpdateOne(
 		ctx,
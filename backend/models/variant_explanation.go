@@ -0,0 +1,324 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 差分の区間の種別
+const (
+	DiffOpEqual  = "equal"  // 元のメッセージと変換結果で共通
+	DiffOpDelete = "delete" // 元のメッセージのみ（削除された部分）
+	DiffOpInsert = "insert" // 変換結果のみ（追加された部分）
+)
+
+// 変更理由の生成元
+const (
+	ExplanationSourceAI    = "ai"
+	ExplanationSourceRules = "rules"
+)
+
+// ChangeCategory 変更理由の分類
+type ChangeCategory struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// ChangeCategories 変更理由の分類の一覧（モデルにはこの中から選ばせる）
+var ChangeCategories = []ChangeCategory{
+	{Key: "cushion", Label: "クッション言葉を追加"},
+	{Key: "softened", Label: "表現を和らげた"},
+	{Key: "removed_blame", Label: "責める表現を削除"},
+	{Key: "removed_sarcasm", Label: "皮肉を削除"},
+	{Key: "honorific", Label: "敬語・丁寧語に変更"},
+	{Key: "gratitude", Label: "感謝を追加"},
+	{Key: "empathy", Label: "気遣いを追加"},
+	{Key: "emoji", Label: "絵文字を調整"},
+	{Key: "clarified", Label: "内容を明確化"},
+	{Key: "restructured", Label: "構成を変更"},
+	{Key: "other", Label: "その他"},
+}
+
+// cushionPhrases ルールベースで「クッション言葉を追加」と判定する語句
+var cushionPhrases = []string{"恐れ入りますが", "恐縮", "お忙しい", "差し支えなければ", "申し訳", "もしよろしければ", "お手数"}
+
+// gratitudePhrases ルールベースで「感謝を追加」と判定する語句
+var gratitudePhrases = []string{"ありがとう", "感謝", "助かります", "お疲れ様"}
+
+// honorificPhrases ルールベースで「敬語・丁寧語に変更」と判定する語句
+var honorificPhrases = []string{"ください", "いただ", "ます", "です", "でしょうか"}
+
+// VariantExplanationSchema 変更理由の応答の JSON Schema（LLMリクエストの ResponseFormat に指定する）
+var VariantExplanationSchema = json.RawMessage(`{
+  "type": "object",
+  "required": ["changes"],
+  "properties": {
+    "changes": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["id", "category", "reason"],
+        "properties": {
+          "id": {"type": "integer"},
+          "category": {"type": "string", "enum": ["cushion", "softened", "removed_blame", "removed_sarcasm", "honorific", "gratitude", "empathy", "emoji", "clarified", "restructured", "other"]},
+          "reason": {"type": "string"}
+        }
+      }
+    }
+  }
+}`)
+
+// DiffSegment 元のメッセージと変換結果の差分の1区間
+type DiffSegment struct {
+	Op       string `bson:"op" json:"op"` // equal | delete | insert
+	Text     string `bson:"text" json:"text"`
+	ChangeID int    `bson:"changeId,omitempty" json:"changeId,omitempty"` // 属する変更（Changes の ID、equal の場合は 0）
+}
+
+// VariantChange 連続する削除・追加をまとめた1つの変更と、その理由
+type VariantChange struct {
+	ID       int    `bson:"id" json:"id"`
+	Before   string `bson:"before,omitempty" json:"before,omitempty"` // 削除された部分
+	After    string `bson:"after,omitempty" json:"after,omitempty"`   // 追加された部分
+	Category string `bson:"category" json:"category"`                 // ChangeCategories のキー
+	Label    string `bson:"label" json:"label"`
+	Reason   string `bson:"reason" json:"reason"`
+}
+
+// VariantExplanation 変換結果がなぜそうなったかの説明（差分と変更ごとの理由）
+type VariantExplanation struct {
+	Segments    []DiffSegment   `bson:"segments" json:"segments"`
+	Changes     []VariantChange `bson:"changes" json:"changes"`
+	Source      string          `bson:"source" json:"source"` // ai | rules
+	GeneratedAt time.Time       `bson:"generatedAt" json:"generatedAt"`
+}
+
+// NewVariantDiff 元のメッセージと変換結果の差分を計算する（理由は空）
+// 文字種の切れ目で区切った単位で比較し、変更の間に挟まった1文字だけの共通部分は変更に含める
+func NewVariantDiff(original, variant string) *VariantExplanation {
+	ops := diffTokens(tokenizeText(original), tokenizeText(variant))
+
+	// 変更に挟まれた1文字だけの共通部分（助詞・句読点など）は、細切れの変更にならないよう削除＋追加として扱う
+	for i := 1; i+1 < len(ops); i++ {
+		if ops[i].kind == diffEqual && utf8.RuneCountInString(ops[i].text) <= 1 &&
+			ops[i-1].kind != diffEqual && ops[i+1].kind != diffEqual {
+			text := ops[i].text
+			ops = append(ops[:i], append([]diffOp{{diffDelete, text}, {diffInsert, text}}, ops[i+1:]...)...)
+		}
+	}
+
+	explanation := &VariantExplanation{Segments: []DiffSegment{}, Changes: []VariantChange{}}
+	var before, after strings.Builder
+	flush := func() {
+		if before.Len() == 0 && after.Len() == 0 {
+			return
+		}
+		id := len(explanation.Changes) + 1
+		if before.Len() > 0 {
+			explanation.Segments = append(explanation.Segments, DiffSegment{Op: DiffOpDelete, Text: before.String(), ChangeID: id})
+		}
+		if after.Len() > 0 {
+			explanation.Segments = append(explanation.Segments, DiffSegment{Op: DiffOpInsert, Text: after.String(), ChangeID: id})
+		}
+		explanation.Changes = append(explanation.Changes, VariantChange{ID: id, Before: before.String(), After: after.String()})
+		before.Reset()
+		after.Reset()
+	}
+	for _, op := range ops {
+		switch op.kind {
+		case diffDelete:
+			before.WriteString(op.text)
+		case diffInsert:
+			after.WriteString(op.text)
+		default:
+			flush()
+			if n := len(explanation.Segments); n > 0 && explanation.Segments[n-1].Op == DiffOpEqual {
+				explanation.Segments[n-1].Text += op.text
+			} else {
+				explanation.Segments = append(explanation.Segments, DiffSegment{Op: DiffOpEqual, Text: op.text})
+			}
+		}
+	}
+	flush()
+	return explanation
+}
+
+// Matches 説明が元のメッセージ・変換結果の組に対するものか（どちらかが編集された場合は false）
+func (e *VariantExplanation) Matches(original, variant string) bool {
+	var before, after strings.Builder
+	for _, segment := range e.Segments {
+		if segment.Op != DiffOpInsert {
+			before.WriteString(segment.Text)
+		}
+		if segment.Op != DiffOpDelete {
+			after.WriteString(segment.Text)
+		}
+	}
+	return before.String() == original && after.String() == variant
+}
+
+// ApplyReasons モデルの応答（変更IDごとの分類・理由）を各変更に設定する
+// 応答に含まれない変更・不明な分類は ApplyRuleReasons と同じ規則で補う
+func (e *VariantExplanation) ApplyReasons(data []byte, rules map[string][]string) error {
+	var raw struct {
+		Changes []struct {
+			ID       int    `json:"id"`
+			Category string `json:"category"`
+			Reason   string `json:"reason"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("AI応答の解析に失敗: %w", err)
+	}
+
+	for _, reason := range raw.Changes {
+		if reason.ID < 1 || reason.ID > len(e.Changes) {
+			continue
+		}
+		label, ok := changeCategoryLabel(reason.Category)
+		if !ok {
+			continue
+		}
+		change := &e.Changes[reason.ID-1]
+		change.Category, change.Label, change.Reason = reason.Category, label, strings.TrimSpace(reason.Reason)
+		if change.Reason == "" {
+			change.Reason = label
+		}
+	}
+	e.ApplyRuleReasons(rules)
+	e.Source = ExplanationSourceAI
+	return nil
+}
+
+// ApplyRuleReasons 理由が未設定の変更に、追加・削除された語句から判定した理由を設定する（AIで説明できない場合に使う）
+// rules は tone_prompts.yaml の harshness_analysis.rules（削除された非難・皮肉の判定に使う）
+func (e *VariantExplanation) ApplyRuleReasons(rules map[string][]string) {
+	for i := range e.Changes {
+		change := &e.Changes[i]
+		if change.Category != "" {
+			continue
+		}
+		category, reason := ruleChangeReason(change.Before, change.After, rules)
+		change.Category, change.Reason = category, reason
+		change.Label, _ = changeCategoryLabel(category)
+	}
+	e.Source = ExplanationSourceRules
+	e.GeneratedAt = time.Now()
+}
+
+// ruleChangeReason 追加・削除された語句から変更の分類と理由を判定
+func ruleChangeReason(before, after string, rules map[string][]string) (string, string) {
+	for _, dimension := range []string{AnalysisBlame, AnalysisAggression} {
+		if phrase := findPhrase(before, rules[dimension]); phrase != "" && !strings.Contains(after, phrase) {
+			return "removed_blame", "「" + phrase + "」のような責める表現を取り除きました"
+		}
+	}
+	if phrase := findPhrase(before, rules[AnalysisSarcasm]); phrase != "" && !strings.Contains(after, phrase) {
+		return "removed_sarcasm", "「" + phrase + "」のような皮肉に聞こえる表現を取り除きました"
+	}
+	if phrase := findPhrase(after, cushionPhrases); phrase != "" && !strings.Contains(before, phrase) {
+		return "cushion", "「" + phrase + "」を添えて、依頼や指摘の印象を和らげました"
+	}
+	if phrase := findPhrase(after, gratitudePhrases); phrase != "" && !strings.Contains(before, phrase) {
+		return "gratitude", "感謝の言葉を添えました"
+	}
+	if after != "" && strings.TrimFunc(after, isEmojiOrSpace) == "" || before != "" && strings.TrimFunc(before, isEmojiOrSpace) == "" {
+		return "emoji", "絵文字で雰囲気を調整しました"
+	}
+	if phrase := findPhrase(after, honorificPhrases); phrase != "" && !strings.Contains(before, phrase) {
+		return "honorific", "丁寧な言い回しに変えました"
+	}
+	switch {
+	case before == "":
+		return "other", "言葉を補いました"
+	case after == "":
+		return "softened", "強く伝わりやすい部分を省きました"
+	default:
+		return "softened", "柔らかい表現に言い換えました"
+	}
+}
+
+// findPhrase text に含まれる最初の語句（含まれない場合は空文字）
+func findPhrase(text string, phrases []string) string {
+	for _, phrase := range phrases {
+		if phrase != "" && strings.Contains(text, phrase) {
+			return phrase
+		}
+	}
+	return ""
+}
+
+// changeCategoryLabel 変更理由の分類の表示名
+func changeCategoryLabel(key string) (string, bool) {
+	for _, category := range ChangeCategories {
+		if category.Key == key {
+			return category.Label, true
+		}
+	}
+	return "", false
+}
+
+// isEmojiOrSpace 絵文字（記号類）または空白か
+func isEmojiOrSpace(r rune) bool {
+	return unicode.IsSpace(r) || unicode.Is(unicode.So, r) || r == 0xFE0F || r == 0x200D
+}
+
+// tokenClass 差分の単位を決める文字種
+func tokenClass(r rune) int {
+	switch {
+	case unicode.Is(unicode.Han, r) || r == '々':
+		return 1
+	case unicode.Is(unicode.Hiragana, r):
+		return 2
+	case unicode.Is(unicode.Katakana, r) || r == 'ー':
+		return 3
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 4
+	case unicode.IsSpace(r):
+		return 5
+	default:
+		return 0 // 句読点・記号・絵文字は1文字ずつ
+	}
+}
+
+// tokenizeText 文字種の切れ目でテキストを区切る（句読点・記号・絵文字は1文字ずつ）
+func tokenizeText(text string) []string {
+	var tokens []string
+	start, prevClass := 0, -1
+	for i, r := range text {
+		class := tokenClass(r)
+		if i > start && (class == 0 || class != prevClass) {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		prevClass = class
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+// SaveVariantExplanation トーン変換結果に変更の説明を保存
+func (s *MessageService) SaveVariantExplanation(ctx context.Context, messageID, senderID primitive.ObjectID, tone string, explanation *VariantExplanation) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": messageID, "senderId": senderID, "variations.tone": tone},
+		bson.M{"$set": bson.M{"variations.$.explanation": explanation}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/database"
+	"yanwari-message-backend/handlers"
+	"yanwari-message-backend/models"
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/prompteval"
+)
+
+// storedVersionPattern 保存済みのプロンプト設定バージョンの指定（例: v3）
+var storedVersionPattern = regexp.MustCompile(`^v(\d+)$`)
+
+// トーン変換プロンプトのオフライン評価
+//
+// データセットの全ケースを設定ファイルの各トーンで変換し、文字数・禁止語句・絵文字数・
+// 日付や数値の保持・<thinking> タグの漏れをチェックする。-baseline を指定すると2つの設定を比較する。
+//
+//	go run scripts/prompt_eval.go -dataset config/eval/golden_messages.yaml \
+//	  -config config/tone_prompts.yaml -baseline v3 -out report.md
+//
+// -config / -baseline にはファイルパスか、保存済みのバージョン（v<番号>、MongoDBから取得）を指定できる。
+// 不合格（比較時は回帰）があった場合は終了コード1で終了する
+func main() {
+	datasetPath := flag.String("dataset", "config/eval/golden_messages.yaml", "データセット（.yaml / .jsonl）")
+	candidateSpec := flag.String("config", "config/tone_prompts.yaml", "評価するトーン設定（ファイルパスまたは v<番号>）")
+	baselineSpec := flag.String("baseline", "", "比較対象のトーン設定（ファイルパスまたは v<番号>、省略時は比較しない）")
+	providerName := flag.String("provider", "fake", "LLMプロバイダー（fake | anthropic | openai）")
+	tones := flag.String("tones", "", "評価するトーン（カンマ区切り、省略時は全トーン）")
+	concurrency := flag.Int("concurrency", 4, "同時に実行するリクエスト数")
+	outPath := flag.String("out", "", "Markdownレポートの出力先（省略時は標準出力）")
+	jsonPath := flag.String("json", "", "JSONレポートの出力先（省略時は出力しない）")
+	flag.Parse()
+
+	// 環境変数の読み込み（APIキー・MongoDB接続先）
+	if err := godotenv.Load(".env"); err != nil {
+		log.Println("Warning: .env file not found - using system environment variables")
+	}
+
+	dataset, err := prompteval.LoadDataset(*datasetPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Setenv("LLM_PROVIDER", *providerName)
+	provider, err := llm.NewProviderFromEnv(handlers.OfflineResponder)
+	if err != nil {
+		log.Fatal("LLMプロバイダーの初期化に失敗: ", err)
+	}
+
+	candidate, err := loadTarget(*candidateSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	runner := &prompteval.Runner{Provider: provider, Concurrency: *concurrency}
+	if *tones != "" {
+		for _, tone := range strings.Split(*tones, ",") {
+			runner.Tones = append(runner.Tones, strings.TrimSpace(tone))
+		}
+	}
+
+	ctx := context.Background()
+	log.Printf("評価開始: %s（%d件 × トーン, provider=%s）", candidate.Name, len(dataset.Cases), provider.Name())
+	candidateRun, err := runner.Run(ctx, candidate, dataset)
+	if err != nil {
+		log.Fatal("評価に失敗: ", err)
+	}
+
+	var report any = candidateRun
+	failed := candidateRun.FailedCount() > 0
+	writeMarkdown := func(w io.Writer) error { return prompteval.WriteRunMarkdown(w, candidateRun) }
+
+	if *baselineSpec != "" {
+		baseline, err := loadTarget(*baselineSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("ベースライン評価開始: %s", baseline.Name)
+		baselineRun, err := runner.Run(ctx, baseline, dataset)
+		if err != nil {
+			log.Fatal("ベースラインの評価に失敗: ", err)
+		}
+
+		comparison := prompteval.Compare(baselineRun, candidateRun)
+		report = comparison
+		failed = len(comparison.Regressions) > 0
+		writeMarkdown = func(w io.Writer) error { return prompteval.WriteComparisonMarkdown(w, comparison) }
+		log.Printf("比較結果: 回帰 %d件 / 改善 %d件 / 出力のみ変化 %d件",
+			len(comparison.Regressions), len(comparison.Fixes), len(comparison.Changed))
+	}
+
+	if *outPath == "" {
+		err = writeMarkdown(os.Stdout)
+	} else {
+		err = writeFile(*outPath, writeMarkdown)
+	}
+	if err != nil {
+		log.Fatal("レポートの出力に失敗: ", err)
+	}
+
+	if *jsonPath != "" {
+		err := writeFile(*jsonPath, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		})
+		if err != nil {
+			log.Fatal("JSONレポートの出力に失敗: ", err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadTarget ファイルパスまたは保存済みのバージョン（v<番号>）からトーン設定を読み込む
+func loadTarget(spec string) (prompteval.Target, error) {
+	if match := storedVersionPattern.FindStringSubmatch(spec); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		toneConfig, err := loadStoredVersion(number)
+		if err != nil {
+			return prompteval.Target{}, err
+		}
+		return prompteval.Target{Name: spec, Config: toneConfig}, nil
+	}
+
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		return prompteval.Target{}, fmt.Errorf("トーン設定の読み込みに失敗 (%s): %w", spec, err)
+	}
+	toneConfig, err := config.ParseToneConfig(data)
+	if err != nil {
+		return prompteval.Target{}, fmt.Errorf("%s: %w", spec, err)
+	}
+	return prompteval.Target{Name: spec, Config: toneConfig}, nil
+}
+
+// loadStoredVersion MongoDBに保存されたプロンプト設定のバージョンを読み込む
+func loadStoredVersion(number int) (*config.ToneConfig, error) {
+	db, err := database.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB接続に失敗: %w", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("MongoDB切断エラー: %v", err)
+		}
+	}()
+
+	version, err := models.NewPromptConfigService(db.Database).GetVersion(context.Background(), number)
+	if err != nil {
+		return nil, fmt.Errorf("プロンプト設定 v%d の取得に失敗: %w", number, err)
+	}
+	return version.ToneConfig()
+}
+
+// writeFile ファイルを作成して書き込む
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -2,33 +2,88 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
-	"strings"
+	"os"
 	"time"
 
 	"yanwari-message-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 配信ワーカーの既定値
+const (
+	// defaultDeliveryLease 確保したメッセージのリース期間（この間に配信を完了できなければ他のワーカーが取り直す）
+	defaultDeliveryLease = 5 * time.Minute
+	// defaultDeliveryBatchSize 1回の配信チェックで配信するメッセージの最大件数
+	defaultDeliveryBatchSize = 100
+	// deliveryMessageBudget 1件の配信に見込む時間（配信チェックの残り時間がこれより短い場合は新たに確保しない）
+	deliveryMessageBudget = 15 * time.Second
+	// releaseClaimTimeout 配信チェックの期限切れ後に確保を解除する処理のタイムアウト
+	releaseClaimTimeout = 5 * time.Second
 )
 
 // DeliveryService メッセージ配信サービス
+// 複数のインスタンスで動かしても、メッセージを確保（リース）したワーカーだけが配信するため二重に配信しない
 type DeliveryService struct {
 	messageService  *models.MessageService
-	scheduleService *models.ScheduleService
+	settingsService *models.UserSettingsService // 受信者の設定（配信チャネルの選択に使う）
+	channels        []DeliveryChannel           // 配信チャネル（先頭から順に配信する）
+	retryPolicy     DeliveryRetryPolicy         // 配信に失敗した場合の再試行ポリシー
+	leader          *LeaderElector              // 定期配信を1つのインスタンスだけで実行する（nil の場合は常に実行）
+	workerID        string                      // メッセージの確保に使うこのワーカーのID
+	lease           time.Duration               // 確保のリース期間
+	batchSize       int                         // 1回に確保する最大件数
 	ticker          *time.Ticker
 	done            chan bool
 }
 
 // NewDeliveryService 配信サービスを作成
-func NewDeliveryService(messageService *models.MessageService, scheduleService *models.ScheduleService) *DeliveryService {
+// leader を指定した場合、定期配信はリーダーのインスタンスだけが実行する（手動配信はどのインスタンスでも実行できる）
+// channels のうち受信者の設定で有効なチャネルに配信し、一時的な失敗は retryPolicy に従って再試行する
+func NewDeliveryService(messageService *models.MessageService, settingsService *models.UserSettingsService, leader *LeaderElector, channels []DeliveryChannel, retryPolicy DeliveryRetryPolicy) *DeliveryService {
+	workerID := NewInstanceID()
+	if leader != nil {
+		workerID = leader.Holder()
+	}
 	return &DeliveryService{
 		messageService:  messageService,
-		scheduleService: scheduleService,
+		settingsService: settingsService,
+		channels:        channels,
+		retryPolicy:     retryPolicy,
+		leader:          leader,
+		workerID:        workerID,
+		lease:           defaultDeliveryLease,
+		batchSize:       defaultDeliveryBatchSize,
 		done:            make(chan bool),
 	}
 }
 
+// NewInstanceID インスタンスIDを生成（ホスト名・プロセスID・乱数。同じホストで再起動しても重複しない）
+func NewInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// WorkerID このワーカーのID
+func (s *DeliveryService) WorkerID() string {
+	return s.workerID
+}
+
 // Start バックグラウンド配信エンジンを開始
 func (s *DeliveryService) Start(interval time.Duration) {
-	log.Printf("配信エンジンを開始しました（間隔: %v）", interval)
+	log.Printf("配信エンジンを開始しました（間隔: %v, ワーカー: %s）", interval, s.workerID)
 	
 	s.ticker = time.NewTicker(interval)
 	
@@ -55,163 +110,367 @@ func (s *DeliveryService) Stop() {
 
 // processScheduledMessages スケジュールされたメッセージを処理
 func (s *DeliveryService) processScheduledMessages() {
+	if s.leader != nil && !s.leader.IsLeader() {
+		// 他のインスタンスがリーダーとして配信している
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	log.Printf("🔍 スケジュール配信チェック開始 (時刻: %v)", time.Now().Format("2006-01-02 15:04:05"))
 
-	messages, err := s.messageService.DeliverScheduledMessages(ctx)
-	if err != nil {
+	if _, err := s.DeliverDueMessages(ctx); err != nil {
 		log.Printf("❌ スケジュール配信エラー: %v", err)
-		return
+	}
+	if _, err := s.RetryChannelDeliveries(ctx); err != nil {
+		log.Printf("❌ チャネルの再試行エラー: %v", err)
 	}
 
-	log.Printf("📋 配信対象メッセージ: %d件", len(messages))
+	log.Printf("🔚 スケジュール配信チェック終了")
+}
 
-	if len(messages) > 0 {
-		log.Printf("🚀 配信開始: %d件のメッセージを配信中...", len(messages))
-		
-		// 各メッセージについて実際の配信処理を実行
-		for _, msg := range messages {
-			err := s.deliverMessageToRecipient(ctx, msg)
-			if err != nil {
-				log.Printf("配信エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
-				// エラーが発生した場合、メッセージのステータスを戻すことも検討
-				continue
+// DeliverDueMessages 配信時刻を過ぎたメッセージを1件ずつ確保して配信し、配信できたメッセージを返す
+// 確保したまま ctx の期限が切れて配信できないメッセージが残らないよう、残り時間が足りる間だけ次のメッセージを確保する
+func (s *DeliveryService) DeliverDueMessages(ctx context.Context) ([]models.Message, error) {
+	delivered := []models.Message{}
+	attempted := 0
+	for attempted < s.batchSize && s.hasDeliveryBudget(ctx) {
+		msg, err := s.messageService.ClaimScheduledMessage(ctx, s.workerID, s.lease)
+		if err != nil {
+			if attempted == 0 {
+				return nil, err
 			}
-			
-			log.Printf("配信成功: ID=%s, 受信者=%s, 送信日時=%v", 
-				msg.ID.Hex(), 
-				msg.RecipientID.Hex(),
-				msg.SentAt.Format("2006-01-02 15:04:05"))
-		}
-		
-		log.Printf("✅ 配信完了: %d件のメッセージ処理完了", len(messages))
-	} else {
+			// 確保できた分は配信済み（残りは次回の配信チェックで確保する）
+			log.Printf("⚠️ メッセージ確保エラー（%d件処理済み）: %v", attempted, err)
+			break
+		}
+		if msg == nil {
+			break
+		}
+		attempted++
+
+		if err := s.deliverMessageToRecipient(ctx, *msg); err != nil {
+			log.Printf("配信エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
+			continue
+		}
+		msg.DeliveryClaim = nil
+		delivered = append(delivered, *msg)
+	}
+
+	if attempted == 0 {
 		log.Printf("📭 配信対象メッセージなし")
+		return delivered, nil
+	}
+	log.Printf("✅ 配信完了: %d件中%d件のメッセージを配信しました (ワーカー: %s)", attempted, len(delivered), s.workerID)
+	return delivered, nil
+}
+
+// RetryChannelDeliveries 配信済みのメッセージのうち、メール・Webhook の再試行日時を過ぎたものを1件ずつ確保して再配信し、処理した件数を返す
+// 受信箱への配信は完了しているため、メッセージのステータスは変えずにチャネルごとの記録だけを更新する
+func (s *DeliveryService) RetryChannelDeliveries(ctx context.Context) (int, error) {
+	var names []string
+	for _, channel := range s.channels {
+		if channel.Name() != ChannelInApp {
+			names = append(names, channel.Name())
+		}
+	}
+
+	retried := 0
+	for retried < s.batchSize && s.hasDeliveryBudget(ctx) {
+		msg, err := s.messageService.ClaimChannelRetry(ctx, s.workerID, s.lease, names)
+		if err != nil {
+			return retried, err
+		}
+		if msg == nil {
+			break
+		}
+		retried++
+		s.retryChannels(ctx, msg)
+	}
+	if retried > 0 {
+		log.Printf("🔁 チャネルの再試行: %d件のメッセージを処理しました (ワーカー: %s)", retried, s.workerID)
+	}
+	return retried, nil
+}
+
+// retryChannels 確保した配信済みのメッセージを再試行日時を過ぎたチャネルに再配信し、確保を解除する
+// 受信者が削除された・受信者の設定でチャネルが無効になった場合は、そのチャネルの再試行を打ち切る
+func (s *DeliveryService) retryChannels(ctx context.Context, msg *models.Message) {
+	due := dueChannels(s.channels, msg, time.Now())
+	delivery, result := s.buildDelivery(ctx, msg)
+	if delivery == nil {
+		if result.Status == DeliveryPermanent {
+			s.stopChannelRetries(ctx, msg, due, result.Err.Error())
+		}
+	} else {
+		var accepting, rejected []DeliveryChannel
+		for _, channel := range due {
+			if channel.Accepts(delivery) {
+				accepting = append(accepting, channel)
+			} else {
+				rejected = append(rejected, channel)
+			}
+		}
+		s.stopChannelRetries(ctx, msg, rejected, "受信者の設定でチャネルが無効になりました")
+		deliverToChannels(ctx, accepting, s.messageService, s.workerID, s.retryPolicy, delivery)
+	}
+
+	if ctx.Err() != nil {
+		s.releaseClaim(msg)
+		return
+	}
+	if err := s.messageService.ReleaseDeliveryClaim(ctx, msg.ID, s.workerID); err != nil {
+		log.Printf("確保の解除エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
+	}
+}
+
+// stopChannelRetries channels の再試行を打ち切る（再試行日時を消して失敗として残す）
+func (s *DeliveryService) stopChannelRetries(ctx context.Context, msg *models.Message, channels []DeliveryChannel, reason string) {
+	for _, channel := range channels {
+		name := channel.Name()
+		failure := msg.ChannelFailures[name]
+		failure.Error = reason
+		failure.Retryable = false
+		failure.NextAttemptAt = nil
+		failure.FailedAt = time.Now()
+		log.Printf("💀 チャネルの再試行を打ち切ります: ID=%s, チャネル=%s, %s", msg.ID.Hex(), name, reason)
+		if err := s.messageService.RecordChannelFailure(ctx, msg.ID, s.workerID, name, failure); err != nil {
+			log.Printf("チャネル配信エラーの記録エラー: ID=%s, チャネル=%s, エラー=%v", msg.ID.Hex(), name, err)
+		}
 	}
-	
-	log.Printf("🔚 スケジュール配信チェック終了")
 }
 
-// deliverMessageToRecipient メッセージを受信者に実際に配信
+// dueChannels 受信箱以外のチャネルのうち、配信に失敗して再試行日時を過ぎたもの
+func dueChannels(channels []DeliveryChannel, msg *models.Message, now time.Time) []DeliveryChannel {
+	delivered := make(map[string]bool, len(msg.DeliveredChannels))
+	for _, name := range msg.DeliveredChannels {
+		delivered[name] = true
+	}
+
+	var due []DeliveryChannel
+	for _, channel := range channels {
+		name := channel.Name()
+		failure, failed := msg.ChannelFailures[name]
+		if name == ChannelInApp || delivered[name] || !failed || failure.NextAttemptAt == nil || failure.NextAttemptAt.After(now) {
+			continue
+		}
+		due = append(due, channel)
+	}
+	return due
+}
+
+// hasDeliveryBudget ctx の残り時間で次のメッセージを配信できるか
+func (s *DeliveryService) hasDeliveryBudget(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) >= deliveryMessageBudget
+}
+
+// deliverMessageToRecipient 確保したメッセージを受信者に実際に配信
+// 配信の完了は確保したワーカーだけが記録でき、outbox イベントと同じトランザクションで書き込むため、
+// 完了後の処理（スケジュール更新・送信者通知）のイベントは1回だけ発行される
 func (s *DeliveryService) deliverMessageToRecipient(ctx context.Context, msg models.Message) error {
 	// 配信処理の詳細ログ
 	log.Printf("📤 配信開始: ID=%s, 受信者=%s, 内容=%s", 
 		msg.ID.Hex(), 
 		msg.RecipientID.Hex(),
 		truncateText(msg.FinalText, 50))
-	
-	// 配信試行回数の制限チェック（将来の再試行機能用）
-	// TODO: メッセージモデルにretryCountフィールドを追加することを検討
-	// maxRetries := 3
-	
+
+	// 確保の期限が切れていれば他のワーカーが取り直している可能性があるため配信しない
+	if !msg.DeliveryClaim.Active(time.Now()) {
+		return fmt.Errorf("メッセージの確保の期限が切れました")
+	}
+
 	// 実際の配信処理を実行
-	deliveryError := s.performDelivery(ctx, &msg)
-	
-	if deliveryError != nil {
-		// 配信エラー時の処理
-		log.Printf("❌ 配信エラー: ID=%s, エラー=%v", msg.ID.Hex(), deliveryError)
-		
-		// エラーの種類に応じて処理を分岐
-		if isRetryableError(deliveryError) {
-			// 再試行可能なエラーの場合
-			log.Printf("🔄 再試行可能エラー: ID=%s, %s", msg.ID.Hex(), deliveryError.Error())
-			// メッセージのステータスはsentのまま維持（次回のバックグラウンド処理で再試行）
-			return deliveryError
-		} else {
-			// 再試行不可能なエラーの場合
-			log.Printf("💀 致命的エラー: ID=%s, %s", msg.ID.Hex(), deliveryError.Error())
-			// ステータスを失敗に更新
-			if err := s.messageService.UpdateMessageStatus(ctx, msg.ID, models.MessageStatusSent); err != nil {
-				log.Printf("ステータス更新エラー: %v", err)
-			}
-			return deliveryError
-		}
+	result := s.performDelivery(ctx, &msg)
+
+	if ctx.Err() != nil {
+		// ワーカーの期限切れ・停止による失敗は配信の失敗として数えない
+		s.releaseClaim(&msg)
+		return fmt.Errorf("配信チェックの期限が切れました: %w", ctx.Err())
 	}
-	
-	// 配信成功時の処理
-	log.Printf("✅ 配信成功: ID=%s, 受信者=%s", msg.ID.Hex(), msg.RecipientID.Hex())
-	
-	// ステータスをdeliveredに更新
-	err := s.messageService.UpdateMessageStatus(ctx, msg.ID, models.MessageStatusDelivered)
+	if result.Status != DeliverySucceeded {
+		s.handleDeliveryFailure(ctx, &msg, result)
+		return result.Err
+	}
+
+	// ステータスをdeliveredに更新（確保したワーカーのみ）
+	completed, err := s.messageService.CompleteDelivery(ctx, msg.ID, s.workerID)
 	if err != nil {
 		log.Printf("ステータス更新エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
+		if ctx.Err() != nil {
+			s.releaseClaim(&msg)
+		}
 		return err
 	}
-	
-	// スケジュールのステータスを送信済みに更新
-	if s.scheduleService != nil {
-		if err := s.scheduleService.UpdateScheduleStatusByMessageID(ctx, msg.ID, "sent"); err != nil {
-			log.Printf("スケジュールステータス更新エラー: MessageID=%s, エラー=%v", msg.ID.Hex(), err)
-		} else {
-			log.Printf("📅 スケジュールステータス更新成功: MessageID=%s → sent", msg.ID.Hex())
-		}
+	if !completed {
+		// 確保の期限切れ後に他のワーカーが取り直した・既に配信済み
+		log.Printf("⏭️ 配信完了を記録できませんでした（他のワーカーが処理済み）: ID=%s", msg.ID.Hex())
+		return fmt.Errorf("メッセージの確保が失われました")
 	}
-	
-	// 送信者への送信完了通知を実行
-	s.notifySenderOfDelivery(ctx, &msg)
-	
+
+	// 配信成功時の処理（スケジュールの同期・送信者への通知は配信完了と同時に書き込んだ outbox イベントから行う）
+	log.Printf("✅ 配信成功: ID=%s, 受信者=%s", msg.ID.Hex(), msg.RecipientID.Hex())
+
 	return nil
 }
 
-// performDelivery 実際の配信処理を実行
-func (s *DeliveryService) performDelivery(ctx context.Context, msg *models.Message) error {
-	// TODO: 実際の配信処理を実装
-	// - メール送信
-	// - プッシュ通知
-	// - SMS送信
-	// - Webhook呼び出し
-	// - 外部API連携
-	
-	// 現在は成功として扱う（将来の外部サービス連携のため）
-	log.Printf("📧 実際の配信処理実行中... (現在はログ出力のみ)")
-	
-	// シミュレーション: 10%の確率でエラーを発生させる（テスト用）
-	// if rand.Float32() < 0.1 {
-	//     return fmt.Errorf("シミュレーション配信エラー")
-	// }
-	
-	return nil
+// releaseClaim 試行回数を増やさずに確保を解除し、次回の配信チェックで再び配信する
+// ctx の期限が切れた後に呼ぶため、解除は別のコンテキストで行う（配信済みのチャネルは記録済みのため再配信しない）
+func (s *DeliveryService) releaseClaim(msg *models.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseClaimTimeout)
+	defer cancel()
+
+	log.Printf("⏸️ 配信を中断し確保を解除します: ID=%s", msg.ID.Hex())
+	if err := s.messageService.ReleaseDeliveryClaim(ctx, msg.ID, s.workerID); err != nil {
+		log.Printf("確保の解除エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
+	}
 }
 
-// isRetryableError エラーが再試行可能かどうか判定
-func isRetryableError(err error) bool {
-	// 再試行可能エラーの条件
-	errorMsg := err.Error()
-	
-	// ネットワーク関連エラー
-	if strings.Contains(errorMsg, "connection") ||
-	   strings.Contains(errorMsg, "timeout") ||
-	   strings.Contains(errorMsg, "temporary") {
-		return true
+// handleDeliveryFailure 配信失敗を記録する（スケジュールの同期は outbox イベントから行う）
+// 一時的な失敗は試行回数を増やしてバックオフ後に再試行し、再試行の上限に達した場合・恒久的な失敗の場合は配信失敗（failed）にする
+func (s *DeliveryService) handleDeliveryFailure(ctx context.Context, msg *models.Message, result DeliveryResult) {
+	attempts := msg.DeliveryAttempts + 1
+	reason := "配信に失敗しました"
+	if result.Err != nil {
+		reason = result.Err.Error()
 	}
-	
-	// レート制限エラー
-	if strings.Contains(errorMsg, "rate limit") ||
-	   strings.Contains(errorMsg, "too many requests") {
-		return true
+
+	if result.Status == DeliveryRetryable && !s.retryPolicy.Exhausted(attempts) {
+		nextAttemptAt := time.Now().Add(s.retryPolicy.Backoff(attempts, result.RetryAfter))
+		log.Printf("🔄 再試行可能エラー: ID=%s, 試行=%d/%d, 次の試行=%s, %s",
+			msg.ID.Hex(), attempts, s.retryPolicy.MaxAttempts, nextAttemptAt.Format("2006-01-02 15:04:05"), reason)
+		if _, err := s.messageService.ScheduleDeliveryRetry(ctx, msg.ID, s.workerID, nextAttemptAt, reason); err != nil {
+			log.Printf("再試行の記録エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
+		}
+		return
 	}
-	
-	// サーバーエラー（5xx）
-	if strings.Contains(errorMsg, "server error") ||
-	   strings.Contains(errorMsg, "service unavailable") {
-		return true
+
+	if result.Status == DeliveryRetryable {
+		log.Printf("💀 再試行の上限に達しました: ID=%s, 試行=%d回, %s", msg.ID.Hex(), attempts, reason)
+	} else {
+		log.Printf("💀 致命的エラー: ID=%s, %s", msg.ID.Hex(), reason)
+	}
+	// 再び確保されないよう配信失敗にして確保を解除（送信者が手動で再試行できる）
+	if _, err := s.messageService.FailDelivery(ctx, msg.ID, s.workerID, reason); err != nil {
+		log.Printf("ステータス更新エラー: ID=%s, エラー=%v", msg.ID.Hex(), err)
 	}
-	
-	// デフォルトは再試行不可
-	return false
 }
 
-// notifySenderOfDelivery 送信者に配信完了を通知
-func (s *DeliveryService) notifySenderOfDelivery(ctx context.Context, msg *models.Message) {
-	// TODO: 送信者への通知実装
-	// - プッシュ通知
-	// - メール通知
-	// - アプリ内通知
-	// - WebSocket/SSE通知
-	
-	log.Printf("📬 送信者通知: 送信者=%s, メッセージ配信完了", msg.SenderID.Hex())
+// performDelivery 受信者の設定で有効なチャネルに配信し、メッセージ全体の結果を返す
+func (s *DeliveryService) performDelivery(ctx context.Context, msg *models.Message) DeliveryResult {
+	delivery, result := s.buildDelivery(ctx, msg)
+	if delivery == nil {
+		return result
+	}
+	return deliverToChannels(ctx, s.channels, s.messageService, s.workerID, s.retryPolicy, delivery)
+}
+
+// channelRecorder チャネルごとの配信結果の記録先（*models.MessageService）
+type channelRecorder interface {
+	MarkChannelDelivered(ctx context.Context, messageID primitive.ObjectID, owner, channel string) error
+	RecordChannelFailure(ctx context.Context, messageID primitive.ObjectID, owner, channel string, failure models.ChannelFailure) error
+}
+
+// deliverToChannels 受信者の設定で有効なチャネルに配信し、メッセージ全体の結果を返す
+// メッセージの結果はアプリ内受信箱の配信結果だけで決まる（受信箱は status=delivered で表示されるため）
+// メール・Webhook の失敗はチャネルごとに記録し、受信箱への配信の完了を妨げない（成功したチャネルは記録し、再試行時には配信しない）
+// 一時的な失敗は policy に従って再試行日時を記録し、RetryChannelDeliveries がそのチャネルだけを再配信する
+func deliverToChannels(ctx context.Context, channels []DeliveryChannel, recorder channelRecorder, owner string, policy DeliveryRetryPolicy, delivery *Delivery) DeliveryResult {
+	msg := delivery.Message
+	delivered := make(map[string]bool, len(msg.DeliveredChannels))
+	for _, name := range msg.DeliveredChannels {
+		delivered[name] = true
+	}
+
+	for _, channel := range channels {
+		name := channel.Name()
+		if delivered[name] || !channel.Accepts(delivery) {
+			continue
+		}
+
+		result := channel.Deliver(ctx, delivery)
+		if result.Status == DeliverySucceeded {
+			log.Printf("📨 チャネル配信成功: ID=%s, チャネル=%s", msg.ID.Hex(), name)
+			if err := recorder.MarkChannelDelivered(ctx, msg.ID, owner, name); err != nil {
+				log.Printf("チャネル配信の記録エラー: ID=%s, チャネル=%s, エラー=%v", msg.ID.Hex(), name, err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// ワーカーの期限切れ・停止による失敗はチャネルの失敗として数えない
+			return RetryableFailure(ctx.Err())
+		}
+
+		if name == ChannelInApp {
+			// 受信箱に届かない場合はメッセージごと再試行する（恒久的な失敗なら再試行しても配信できない）
+			log.Printf("❌ 受信箱への配信エラー: ID=%s, 結果=%s, エラー=%v", msg.ID.Hex(), result.Status, result.Err)
+			return result
+		}
+		failure := nextChannelFailure(msg.ChannelFailures[name], result, policy, time.Now())
+		log.Printf("⚠️ チャネル配信エラー: ID=%s, チャネル=%s, 結果=%s, 試行=%d/%d, エラー=%v", msg.ID.Hex(), name, result.Status, failure.Attempts, policy.MaxAttempts, result.Err)
+		if err := recorder.RecordChannelFailure(ctx, msg.ID, owner, name, failure); err != nil {
+			log.Printf("チャネル配信エラーの記録エラー: ID=%s, チャネル=%s, エラー=%v", msg.ID.Hex(), name, err)
+		}
+	}
+	return Delivered()
+}
+
+// nextChannelFailure チャネルの配信失敗の記録を作成（一時的な失敗で再試行の上限に達していなければ、バックオフ後の再試行日時を設定）
+func nextChannelFailure(previous models.ChannelFailure, result DeliveryResult, policy DeliveryRetryPolicy, now time.Time) models.ChannelFailure {
+	failure := models.ChannelFailure{
+		Error:     "配信に失敗しました",
+		Retryable: result.Status == DeliveryRetryable,
+		Attempts:  previous.Attempts + 1,
+		FailedAt:  now,
+	}
+	if result.Err != nil {
+		failure.Error = result.Err.Error()
+	}
+	if failure.Retryable && !policy.Exhausted(failure.Attempts) {
+		nextAttemptAt := now.Add(policy.Backoff(failure.Attempts, result.RetryAfter))
+		failure.NextAttemptAt = &nextAttemptAt
+	}
+	return failure
+}
+
+// buildDelivery チャネルに渡す配信内容を作成（作成できない場合は nil と失敗の結果を返す）
+func (s *DeliveryService) buildDelivery(ctx context.Context, msg *models.Message) (*Delivery, DeliveryResult) {
+	userService := s.messageService.GetUserService()
+
+	recipient, err := userService.GetUserByID(ctx, msg.RecipientID.Hex())
+	if errors.Is(err, models.ErrUserNotFound) {
+		return nil, PermanentFailure(fmt.Errorf("受信者が見つかりません: %s", msg.RecipientID.Hex()))
+	}
+	if err != nil {
+		return nil, RetryableFailure(fmt.Errorf("受信者の取得エラー: %w", err))
+	}
+
+	// 送信者は表示名にのみ使うため、取得できなくても配信する
+	sender, err := userService.GetUserByID(ctx, msg.SenderID.Hex())
+	if err != nil {
+		log.Printf("送信者の取得エラー: ID=%s, エラー=%v", msg.SenderID.Hex(), err)
+		sender = nil
+	}
+
+	var settings *models.UserSettings
+	if s.settingsService != nil {
+		settings, err = s.settingsService.GetSettings(ctx, recipient.ID)
+		if err != nil {
+			return nil, RetryableFailure(fmt.Errorf("受信者の設定の取得エラー: %w", err))
+		}
+	}
+
+	return &Delivery{
+		Message:        msg,
+		Sender:         sender,
+		Recipient:      recipient,
+		Settings:       settings,
+		IdempotencyKey: msg.ID.Hex(),
+	}, DeliveryResult{}
 }
 
 // truncateText テキストを指定文字数で切り詰め
@@ -223,15 +482,16 @@ func truncateText(text string, maxLen int) string {
 }
 
 // DeliverNow 即座にスケジュール配信を実行（手動実行用）
+// バックグラウンド配信と同じくメッセージを確保してから配信するため、同時に実行しても二重に配信しない
 func (s *DeliveryService) DeliverNow() (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	messages, err := s.messageService.DeliverScheduledMessages(ctx)
+	delivered, err := s.DeliverDueMessages(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	log.Printf("手動配信完了: %d件のメッセージを配信しました", len(messages))
-	return len(messages), nil
+	log.Printf("手動配信完了: %d件のメッセージを配信しました", len(delivered))
+	return len(delivered), nil
 }
\ No newline at end of file
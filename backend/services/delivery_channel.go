@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"yanwari-message-backend/models"
+)
+
+// 配信チャネル名（メッセージの deliveredChannels に記録される）
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// DeliveryStatus チャネルごとの配信結果
+type DeliveryStatus string
+
+const (
+	DeliverySucceeded DeliveryStatus = "success"   // 配信成功
+	DeliveryRetryable DeliveryStatus = "retryable" // 一時的な失敗（再試行で回復する可能性がある）
+	DeliveryPermanent DeliveryStatus = "permanent" // 恒久的な失敗（再試行しても回復しない）
+)
+
+// DeliveryResult チャネルの配信結果
+type DeliveryResult struct {
+	Status     DeliveryStatus
+	Err        error         // 失敗の原因（成功の場合は nil）
+	RetryAfter time.Duration // 再試行までの待機時間の指定（Retry-After など、無い場合は0）
+}
+
+// Delivered 配信成功
+func Delivered() DeliveryResult {
+	return DeliveryResult{Status: DeliverySucceeded}
+}
+
+// RetryableFailure 再試行で回復する可能性がある失敗
+func RetryableFailure(err error) DeliveryResult {
+	return DeliveryResult{Status: DeliveryRetryable, Err: err}
+}
+
+// PermanentFailure 再試行しても回復しない失敗
+func PermanentFailure(err error) DeliveryResult {
+	return DeliveryResult{Status: DeliveryPermanent, Err: err}
+}
+
+// Delivery チャネルに渡す配信内容
+type Delivery struct {
+	Message   *models.Message
+	Sender    *models.User
+	Recipient *models.User
+	// Settings 受信者のユーザー設定（チャネルの選択に使う）
+	Settings *models.UserSettings
+	// IdempotencyKey 同じメッセージの再送を受信側で識別するためのキー（メッセージIDと同じ）
+	IdempotencyKey string
+}
+
+// DeliveryChannel メッセージの配信チャネル（アプリ内受信箱・メール・Webhook など）
+// 結果は成功・一時的な失敗・恒久的な失敗のいずれかで明示的に返す
+type DeliveryChannel interface {
+	// Name チャネル名
+	Name() string
+	// Accepts 受信者の設定でこのチャネルへの配信が有効か
+	Accepts(delivery *Delivery) bool
+	// Deliver メッセージを配信
+	Deliver(ctx context.Context, delivery *Delivery) DeliveryResult
+}
+
+// NewDeliveryChannelsFromEnv 環境変数の設定に応じて配信チャネルを作成
+// アプリ内受信箱とWebhookは常に有効。メールは SMTP_HOST が設定されている場合のみ有効
+func NewDeliveryChannelsFromEnv() []DeliveryChannel {
+	channels := []DeliveryChannel{NewInAppChannel()}
+
+	if email, err := NewEmailChannelFromEnv(); err != nil {
+		log.Printf("⚠️ メール配信チャネルは無効です: %v", err)
+	} else {
+		channels = append(channels, email)
+	}
+
+	channels = append(channels, NewWebhookChannelFromEnv())
+	return channels
+}
+
+// InAppChannel アプリ内受信箱への配信
+// 受信箱はメッセージの status（delivered）で表示されるため、配信の完了時に受信箱に届く
+type InAppChannel struct{}
+
+// NewInAppChannel アプリ内受信箱チャネルを作成
+func NewInAppChannel() *InAppChannel {
+	return &InAppChannel{}
+}
+
+// Name チャネル名
+func (c *InAppChannel) Name() string {
+	return ChannelInApp
+}
+
+// Accepts アプリ内受信箱には常に配信する
+func (c *InAppChannel) Accepts(delivery *Delivery) bool {
+	return true
+}
+
+// Deliver 受信者が受信箱でメッセージを受け取れるか確認する
+func (c *InAppChannel) Deliver(ctx context.Context, delivery *Delivery) DeliveryResult {
+	if delivery.Recipient == nil || delivery.Message.RecipientID.IsZero() {
+		return PermanentFailure(errors.New("受信者が設定されていません"))
+	}
+	log.Printf("📥 受信箱に配信: ID=%s, 受信者=%s", delivery.Message.ID.Hex(), delivery.Recipient.ID.Hex())
+	return Delivered()
+}
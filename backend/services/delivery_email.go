@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"time"
+)
+
+// EmailConfig SMTP の接続設定
+type EmailConfig struct {
+	Host     string
+	Port     string
+	Username string // 空の場合は認証しない
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// EmailChannel SMTP でメッセージをメール配信する
+type EmailChannel struct {
+	config EmailConfig
+}
+
+// NewEmailChannel メール配信チャネルを作成
+func NewEmailChannel(config EmailConfig) *EmailChannel {
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &EmailChannel{config: config}
+}
+
+// NewEmailChannelFromEnv 環境変数（SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM）からメール配信チャネルを作成
+func NewEmailChannelFromEnv() (*EmailChannel, error) {
+	config := EmailConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if config.Host == "" {
+		return nil, errors.New("SMTP_HOST環境変数が設定されていません")
+	}
+	if config.From == "" {
+		return nil, errors.New("SMTP_FROM環境変数が設定されていません")
+	}
+	return NewEmailChannel(config), nil
+}
+
+// Name チャネル名
+func (c *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+// Accepts 受信者がメール通知を有効にしていて、メールアドレスがある場合に配信する
+func (c *EmailChannel) Accepts(delivery *Delivery) bool {
+	return delivery.Settings != nil && delivery.Settings.EmailNotifications &&
+		delivery.Recipient != nil && delivery.Recipient.Email != ""
+}
+
+// Deliver メールを送信
+// 接続エラー・タイムアウト・4xx応答は一時的な失敗、5xx応答は恒久的な失敗として返す
+func (c *EmailChannel) Deliver(ctx context.Context, delivery *Delivery) DeliveryResult {
+	body, err := c.buildMessage(delivery)
+	if err != nil {
+		return PermanentFailure(err)
+	}
+	if err := c.send(ctx, delivery.Recipient.Email, body); err != nil {
+		return classifySMTPError(err)
+	}
+	return Delivered()
+}
+
+// send SMTP サーバーに接続してメールを送信（ctx の期限を接続全体の期限にする）
+func (c *EmailChannel) send(ctx context.Context, to string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.config.Host, c.config.Port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.config.Host}); err != nil {
+			return err
+		}
+	}
+	if c.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage メール本文を作成（件名・本文は UTF-8、本文は base64）
+// Message-ID にメッセージIDを使い、再送された場合に受信側で重複を判別できるようにする
+func (c *EmailChannel) buildMessage(delivery *Delivery) ([]byte, error) {
+	if delivery.Recipient == nil || delivery.Recipient.Email == "" {
+		return nil, errors.New("受信者のメールアドレスがありません")
+	}
+	text := delivery.Message.FinalText
+	if text == "" {
+		text = delivery.Message.OriginalText
+	}
+
+	senderName := "やんわり伝言"
+	if delivery.Sender != nil && delivery.Sender.Name != "" {
+		senderName = delivery.Sender.Name
+	}
+	subject := fmt.Sprintf("%sさんからメッセージが届きました", senderName)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", delivery.Recipient.Email)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Message-ID: <%s@yanwari-message>\r\n", delivery.IdempotencyKey)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes(), nil
+}
+
+// classifySMTPError SMTP のエラーを一時的・恒久的な失敗に分類
+func classifySMTPError(err error) DeliveryResult {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		if protoErr.Code >= 500 {
+			return PermanentFailure(fmt.Errorf("SMTPサーバーが拒否しました: %w", err))
+		}
+		return RetryableFailure(fmt.Errorf("SMTPサーバーの一時的なエラー: %w", err))
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		// 証明書の誤りは再試行しても解決しない
+		return PermanentFailure(fmt.Errorf("SMTPサーバーの証明書エラー: %w", err))
+	}
+	return RetryableFailure(fmt.Errorf("SMTPサーバーへの接続エラー: %w", err))
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"yanwari-message-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeSMTPServer RCPT TO に rcptReply を返す最小限の SMTP サーバー（STARTTLS・認証なし）
+// 受信したメール本文を data に送る
+func fakeSMTPServer(t *testing.T, rcptReply string) (addr string, data <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := textproto.NewReader(bufio.NewReader(conn))
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				reply("250 OK")
+			case "RCPT":
+				reply(rcptReply)
+			case "DATA":
+				reply("354 Start mail input")
+				lines, err := reader.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(lines, "\n")
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func newTestEmailChannel(t *testing.T, addr string) *EmailChannel {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split %q: %v", addr, err)
+	}
+	return NewEmailChannel(EmailConfig{Host: host, Port: port, From: "noreply@example.com", Timeout: 5 * time.Second})
+}
+
+func newTestEmailDelivery() *Delivery {
+	messageID := primitive.NewObjectID()
+	return &Delivery{
+		Message:        &models.Message{ID: messageID, FinalText: "会議の資料を確認していただけますか"},
+		Sender:         &models.User{Name: "田中"},
+		Recipient:      &models.User{Email: "recipient@example.com"},
+		Settings:       &models.UserSettings{EmailNotifications: true},
+		IdempotencyKey: messageID.Hex(),
+	}
+}
+
+func TestEmailDeliverSMTP(t *testing.T) {
+	tests := []struct {
+		name      string
+		rcptReply string
+		want      DeliveryStatus
+	}{
+		{name: "250", rcptReply: "250 OK", want: DeliverySucceeded},
+		{name: "451", rcptReply: "451 Try again later", want: DeliveryRetryable},
+		{name: "550", rcptReply: "550 No such user", want: DeliveryPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, data := fakeSMTPServer(t, tt.rcptReply)
+			delivery := newTestEmailDelivery()
+
+			result := newTestEmailChannel(t, addr).Deliver(context.Background(), delivery)
+			if result.Status != tt.want {
+				t.Fatalf("Status = %s, want %s (err=%v)", result.Status, tt.want, result.Err)
+			}
+			if tt.want != DeliverySucceeded {
+				return
+			}
+
+			select {
+			case body := <-data:
+				for _, header := range []string{"To: recipient@example.com", "Message-ID: <" + delivery.IdempotencyKey + "@yanwari-message>"} {
+					if !strings.Contains(body, header) {
+						t.Errorf("mail does not contain %q:\n%s", header, body)
+					}
+				}
+			case <-time.After(time.Second):
+				t.Fatal("mail was not received")
+			}
+		})
+	}
+}
+
+func TestEmailDeliverConnectionRefusedIsRetryable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	result := newTestEmailChannel(t, addr).Deliver(context.Background(), newTestEmailDelivery())
+	if result.Status != DeliveryRetryable {
+		t.Errorf("Status = %s, want %s (err=%v)", result.Status, DeliveryRetryable, result.Err)
+	}
+}
+
+func TestEmailAccepts(t *testing.T) {
+	channel := NewEmailChannel(EmailConfig{Host: "localhost", From: "noreply@example.com"})
+
+	delivery := newTestEmailDelivery()
+	if !channel.Accepts(delivery) {
+		t.Error("Accepts = false, want true")
+	}
+	delivery.Settings = &models.UserSettings{EmailNotifications: false}
+	if channel.Accepts(delivery) {
+		t.Error("Accepts with email notifications disabled = true, want false")
+	}
+	delivery = newTestEmailDelivery()
+	delivery.Recipient = &models.User{}
+	if channel.Accepts(delivery) {
+		t.Error("Accepts without recipient email = true, want false")
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"yanwari-message-backend/services/retry"
+)
+
+// DeliveryRetryPolicy 配信の再試行ポリシー（指数バックオフ＋ジッター。試行回数が MaxAttempts に達すると配信失敗 failed にする）
+type DeliveryRetryPolicy = retry.Policy
+
+// DefaultDeliveryRetryPolicy デフォルトの配信の再試行ポリシー（1分, 2分, 4分, 8分後に再試行）
+func DefaultDeliveryRetryPolicy() DeliveryRetryPolicy {
+	return DeliveryRetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   1 * time.Minute,
+		MaxDelay:    1 * time.Hour,
+		Jitter:      0.2,
+	}
+}
+
+// DeliveryRetryPolicyFromEnv 環境変数（DELIVERY_MAX_ATTEMPTS, DELIVERY_RETRY_BASE_DELAY, DELIVERY_RETRY_MAX_DELAY）で上書きした再試行ポリシーを作成
+func DeliveryRetryPolicyFromEnv() DeliveryRetryPolicy {
+	policy := DefaultDeliveryRetryPolicy()
+	if value := os.Getenv("DELIVERY_MAX_ATTEMPTS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			policy.MaxAttempts = n
+		} else {
+			fmt.Printf("警告: DELIVERY_MAX_ATTEMPTS の値が不正です (%s)。デフォルト値 %d を使用します\n", value, policy.MaxAttempts)
+		}
+	}
+	if value := os.Getenv("DELIVERY_RETRY_BASE_DELAY"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			policy.BaseDelay = d
+		} else {
+			fmt.Printf("警告: DELIVERY_RETRY_BASE_DELAY の値が不正です (%s)。デフォルト値 %v を使用します\n", value, policy.BaseDelay)
+		}
+	}
+	if value := os.Getenv("DELIVERY_RETRY_MAX_DELAY"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			policy.MaxDelay = d
+		} else {
+			fmt.Printf("警告: DELIVERY_RETRY_MAX_DELAY の値が不正です (%s)。デフォルト値 %v を使用します\n", value, policy.MaxDelay)
+		}
+	}
+	return policy
+}
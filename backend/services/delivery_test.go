@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"yanwari-message-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeChannel 常に result を返す配信チャネル
+type fakeChannel struct {
+	name   string
+	result DeliveryResult
+	calls  int
+}
+
+func (c *fakeChannel) Name() string                    { return c.name }
+func (c *fakeChannel) Accepts(delivery *Delivery) bool { return true }
+func (c *fakeChannel) Deliver(ctx context.Context, delivery *Delivery) DeliveryResult {
+	c.calls++
+	return c.result
+}
+
+// fakeRecorder チャネルごとの配信結果の記録を保持する
+type fakeRecorder struct {
+	delivered []string
+	failures  map[string]models.ChannelFailure
+}
+
+func (r *fakeRecorder) MarkChannelDelivered(ctx context.Context, messageID primitive.ObjectID, owner, channel string) error {
+	r.delivered = append(r.delivered, channel)
+	return nil
+}
+
+func (r *fakeRecorder) RecordChannelFailure(ctx context.Context, messageID primitive.ObjectID, owner, channel string, failure models.ChannelFailure) error {
+	if r.failures == nil {
+		r.failures = map[string]models.ChannelFailure{}
+	}
+	r.failures[channel] = failure
+	return nil
+}
+
+// testRetryPolicy ジッターなしの再試行ポリシー
+var testRetryPolicy = DeliveryRetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+func TestDeliverToChannels(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name          string
+		inApp         DeliveryResult
+		email         DeliveryResult
+		webhook       DeliveryResult
+		want          DeliveryStatus
+		wantDelivered []string
+		wantFailures  map[string]bool
+	}{
+		{
+			name:          "全チャネル成功",
+			inApp:         Delivered(),
+			email:         Delivered(),
+			webhook:       Delivered(),
+			want:          DeliverySucceeded,
+			wantDelivered: []string{ChannelInApp, ChannelEmail, ChannelWebhook},
+		},
+		{
+			name:          "メール・Webhook の失敗は受信箱への配信を妨げない",
+			inApp:         Delivered(),
+			email:         RetryableFailure(errFailed),
+			webhook:       PermanentFailure(errFailed),
+			want:          DeliverySucceeded,
+			wantDelivered: []string{ChannelInApp},
+			wantFailures:  map[string]bool{ChannelEmail: true, ChannelWebhook: false},
+		},
+		{
+			name:    "受信箱への一時的な失敗はメッセージの一時的な失敗",
+			inApp:   RetryableFailure(errFailed),
+			email:   Delivered(),
+			webhook: Delivered(),
+			want:    DeliveryRetryable,
+		},
+		{
+			name:    "受信箱への恒久的な失敗はメッセージの恒久的な失敗",
+			inApp:   PermanentFailure(errFailed),
+			email:   Delivered(),
+			webhook: Delivered(),
+			want:    DeliveryPermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inApp := &fakeChannel{name: ChannelInApp, result: tt.inApp}
+			email := &fakeChannel{name: ChannelEmail, result: tt.email}
+			webhook := &fakeChannel{name: ChannelWebhook, result: tt.webhook}
+			recorder := &fakeRecorder{}
+			delivery := &Delivery{Message: &models.Message{ID: primitive.NewObjectID()}}
+
+			result := deliverToChannels(context.Background(), []DeliveryChannel{inApp, email, webhook}, recorder, "worker", testRetryPolicy, delivery)
+			if result.Status != tt.want {
+				t.Fatalf("Status = %s, want %s", result.Status, tt.want)
+			}
+			if len(recorder.delivered) != len(tt.wantDelivered) {
+				t.Fatalf("delivered = %v, want %v", recorder.delivered, tt.wantDelivered)
+			}
+			for i := range tt.wantDelivered {
+				if recorder.delivered[i] != tt.wantDelivered[i] {
+					t.Errorf("delivered = %v, want %v", recorder.delivered, tt.wantDelivered)
+					break
+				}
+			}
+			if len(recorder.failures) != len(tt.wantFailures) {
+				t.Fatalf("failures = %v, want %v", recorder.failures, tt.wantFailures)
+			}
+			for name, retryable := range tt.wantFailures {
+				got, ok := recorder.failures[name]
+				if !ok || got.Retryable != retryable {
+					t.Errorf("failures[%s] = %+v (recorded=%v), want retryable=%v", name, got, ok, retryable)
+				}
+				if retryable != (got.NextAttemptAt != nil) {
+					t.Errorf("failures[%s].NextAttemptAt = %v, want set only for retryable failures", name, got.NextAttemptAt)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliverToChannelsSkipsDeliveredChannels(t *testing.T) {
+	inApp := &fakeChannel{name: ChannelInApp, result: Delivered()}
+	email := &fakeChannel{name: ChannelEmail, result: Delivered()}
+	delivery := &Delivery{Message: &models.Message{
+		ID:                primitive.NewObjectID(),
+		DeliveredChannels: []string{ChannelEmail},
+	}}
+
+	result := deliverToChannels(context.Background(), []DeliveryChannel{inApp, email}, &fakeRecorder{}, "worker", testRetryPolicy, delivery)
+	if result.Status != DeliverySucceeded {
+		t.Fatalf("Status = %s, want %s", result.Status, DeliverySucceeded)
+	}
+	if email.calls != 0 {
+		t.Errorf("email delivered %d times on retry, want 0", email.calls)
+	}
+	if inApp.calls != 1 {
+		t.Errorf("in-app delivered %d times, want 1", inApp.calls)
+	}
+}
+
+func TestRetryableChannelFailureIsRedelivered(t *testing.T) {
+	email := &fakeChannel{name: ChannelEmail, result: RetryableFailure(errors.New("451 try again later"))}
+	email.result.RetryAfter = 5 * time.Minute
+	channels := []DeliveryChannel{&fakeChannel{name: ChannelInApp, result: Delivered()}, email}
+	recorder := &fakeRecorder{}
+	msg := &models.Message{ID: primitive.NewObjectID()}
+
+	// 1回目: 受信箱には届き、メールは Retry-After に従って再試行を待つ
+	start := time.Now()
+	if result := deliverToChannels(context.Background(), channels, recorder, "worker", testRetryPolicy, &Delivery{Message: msg}); result.Status != DeliverySucceeded {
+		t.Fatalf("Status = %s, want %s", result.Status, DeliverySucceeded)
+	}
+	failure, ok := recorder.failures[ChannelEmail]
+	if !ok || failure.Attempts != 1 || failure.NextAttemptAt == nil {
+		t.Fatalf("email failure = %+v, want 1 attempt with NextAttemptAt", failure)
+	}
+	if wait := failure.NextAttemptAt.Sub(start); wait < 5*time.Minute {
+		t.Errorf("NextAttemptAt is %v after the failure, want at least Retry-After 5m", wait)
+	}
+
+	// 配信完了後のメッセージの状態
+	msg.DeliveredChannels = recorder.delivered
+	msg.ChannelFailures = recorder.failures
+
+	if due := dueChannels(channels, msg, start.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("due channels before NextAttemptAt = %d, want 0", len(due))
+	}
+	due := dueChannels(channels, msg, failure.NextAttemptAt.Add(time.Second))
+	if len(due) != 1 || due[0].Name() != ChannelEmail {
+		t.Fatalf("due channels = %v, want [email]", due)
+	}
+
+	// 2回目: メールだけを再配信する
+	email.result = Delivered()
+	if result := deliverToChannels(context.Background(), due, recorder, "worker", testRetryPolicy, &Delivery{Message: msg}); result.Status != DeliverySucceeded {
+		t.Fatalf("Status = %s, want %s", result.Status, DeliverySucceeded)
+	}
+	if email.calls != 2 {
+		t.Errorf("email delivered %d times, want 2", email.calls)
+	}
+	if recorder.delivered[len(recorder.delivered)-1] != ChannelEmail {
+		t.Errorf("delivered = %v, want email recorded", recorder.delivered)
+	}
+}
+
+func TestNextChannelFailure(t *testing.T) {
+	now := time.Now()
+	errFailed := errors.New("failed")
+
+	failure := nextChannelFailure(models.ChannelFailure{}, RetryableFailure(errFailed), testRetryPolicy, now)
+	if failure.Attempts != 1 || failure.NextAttemptAt == nil || !failure.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("first retryable failure = %+v, want retry after 1m", failure)
+	}
+	failure = nextChannelFailure(failure, RetryableFailure(errFailed), testRetryPolicy, now)
+	if failure.Attempts != 2 || failure.NextAttemptAt == nil || !failure.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("second retryable failure = %+v, want retry after 2m", failure)
+	}
+	failure = nextChannelFailure(failure, RetryableFailure(errFailed), testRetryPolicy, now)
+	if failure.Attempts != 3 || failure.NextAttemptAt != nil {
+		t.Errorf("exhausted failure = %+v, want no NextAttemptAt", failure)
+	}
+
+	failure = nextChannelFailure(models.ChannelFailure{}, PermanentFailure(errFailed), testRetryPolicy, now)
+	if failure.Retryable || failure.NextAttemptAt != nil {
+		t.Errorf("permanent failure = %+v, want not retried", failure)
+	}
+}
+
+func TestDeliverToChannelsDoesNotCountCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	email := &fakeChannel{name: ChannelEmail, result: RetryableFailure(context.Canceled)}
+	recorder := &fakeRecorder{}
+	delivery := &Delivery{Message: &models.Message{ID: primitive.NewObjectID(), DeliveredChannels: []string{ChannelInApp}}}
+
+	result := deliverToChannels(ctx, []DeliveryChannel{email}, recorder, "worker", testRetryPolicy, delivery)
+	if result.Status != DeliveryRetryable {
+		t.Errorf("Status = %s, want %s", result.Status, DeliveryRetryable)
+	}
+	if len(recorder.failures) != 0 {
+		t.Errorf("failures = %v, want none recorded", recorder.failures)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"yanwari-message-backend/services/retry"
+)
+
+// WebhookPayload Webhook で送信する内容
+type WebhookPayload struct {
+	Event          string     `json:"event"` // 常に "message.received"
+	IdempotencyKey string     `json:"idempotencyKey"`
+	MessageID      string     `json:"messageId"`
+	SenderID       string     `json:"senderId"`
+	SenderName     string     `json:"senderName,omitempty"`
+	Text           string     `json:"text"`
+	ScheduledAt    *time.Time `json:"scheduledAt,omitempty"`
+	DeliveredAt    time.Time  `json:"deliveredAt"`
+}
+
+// WebhookChannel 受信者が設定したURLにメッセージを POST する
+// signingSecret を設定した場合、本文の HMAC-SHA256 を X-Yanwari-Signature ヘッダーに付ける
+type WebhookChannel struct {
+	client        *http.Client
+	signingSecret string
+}
+
+// ErrWebhookAddressNotAllowed Webhook の宛先が内部ネットワーク（ループバック・リンクローカル・プライベート）のアドレス
+var ErrWebhookAddressNotAllowed = errors.New("内部ネットワークのアドレスにはWebhookを送信できません")
+
+// blockedWebhookNetworks IsPrivate などで判定できない、Webhook の宛先にできないネットワーク
+var blockedWebhookNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // 「このネットワーク」
+	mustParseCIDR("100.64.0.0/10"), // キャリアグレードNAT
+	mustParseCIDR("192.0.0.0/24"),  // IETFプロトコル割り当て
+	mustParseCIDR("198.18.0.0/15"), // ベンチマーク用
+}
+
+// NewWebhookChannel Webhook 配信チャネルを作成
+// 利用者が指定したURLを呼び出すため、接続時に内部ネットワークのアドレスへの接続を拒否する（リダイレクト先も含む）
+func NewWebhookChannel(signingSecret string, timeout time.Duration) *WebhookChannel {
+	return newWebhookChannel(signingSecret, timeout, false)
+}
+
+// newWebhookChannel Webhook 配信チャネルを作成（allowPrivate は手元のテスト用サーバーに接続するテストのみ true にする）
+func newWebhookChannel(signingSecret string, timeout time.Duration, allowPrivate bool) *WebhookChannel {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // プロキシ経由では接続先のアドレスを確認できない
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookChannel{
+		client:        &http.Client{Timeout: timeout, Transport: transport},
+		signingSecret: signingSecret,
+	}
+}
+
+// NewWebhookChannelFromEnv 環境変数（WEBHOOK_SIGNING_SECRET）から Webhook 配信チャネルを作成
+func NewWebhookChannelFromEnv() *WebhookChannel {
+	return NewWebhookChannel(os.Getenv("WEBHOOK_SIGNING_SECRET"), 10*time.Second)
+}
+
+// Name チャネル名
+func (c *WebhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+// Accepts 受信者が Webhook のURLを設定している場合に配信する
+func (c *WebhookChannel) Accepts(delivery *Delivery) bool {
+	return delivery.Settings != nil && delivery.Settings.WebhookURL != ""
+}
+
+// Deliver Webhook を呼び出す
+func (c *WebhookChannel) Deliver(ctx context.Context, delivery *Delivery) DeliveryResult {
+	return c.Post(ctx, delivery.Settings.WebhookURL, delivery.IdempotencyKey, c.buildPayload(delivery))
+}
+
+// Post payload を JSON で targetURL に POST する
+// 2xx は成功、408・429・5xx・接続エラーは一時的な失敗、その他の応答とURLの誤りは恒久的な失敗として返す
+func (c *WebhookChannel) Post(ctx context.Context, targetURL, idempotencyKey string, payload interface{}) DeliveryResult {
+	target, err := url.Parse(targetURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return PermanentFailure(fmt.Errorf("無効なWebhook URLです: %s", targetURL))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return PermanentFailure(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return PermanentFailure(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if c.signingSecret != "" {
+		req.Header.Set("X-Yanwari-Signature", "sha256="+signWebhookBody(c.signingSecret, body))
+	}
+
+	resp, err := c.client.Do(req)
+	if errors.Is(err, ErrWebhookAddressNotAllowed) {
+		return PermanentFailure(err)
+	}
+	if err != nil {
+		return RetryableFailure(fmt.Errorf("Webhookの呼び出しエラー: %w", err))
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return Delivered()
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		result := RetryableFailure(fmt.Errorf("Webhookの一時的なエラー: status %d, response: %s", resp.StatusCode, strings.TrimSpace(string(respBody))))
+		result.RetryAfter = retry.ParseRetryAfter(resp.Header.Get("Retry-After"))
+		return result
+	default:
+		return PermanentFailure(fmt.Errorf("Webhookが拒否しました: status %d, response: %s", resp.StatusCode, strings.TrimSpace(string(respBody))))
+	}
+}
+
+// buildPayload Webhook で送信する内容を作成
+func (c *WebhookChannel) buildPayload(delivery *Delivery) WebhookPayload {
+	msg := delivery.Message
+	text := msg.FinalText
+	if text == "" {
+		text = msg.OriginalText
+	}
+	payload := WebhookPayload{
+		Event:          "message.received",
+		IdempotencyKey: delivery.IdempotencyKey,
+		MessageID:      msg.ID.Hex(),
+		SenderID:       msg.SenderID.Hex(),
+		Text:           text,
+		ScheduledAt:    msg.ScheduledAt,
+		DeliveredAt:    time.Now(),
+	}
+	if delivery.Sender != nil {
+		payload.SenderName = delivery.Sender.Name
+	}
+	return payload
+}
+
+// ValidateWebhookURL Webhook のURLを確認する（設定の保存時に使う）
+// http(s) の絶対URLで、ホスト名の全てのアドレスが内部ネットワークのアドレスではないこと
+func ValidateWebhookURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Hostname() == "" {
+		return fmt.Errorf("無効なWebhook URLです: %s", rawURL)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+	if err != nil {
+		return fmt.Errorf("Webhook URLのホスト名を解決できません: %w", err)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr.IP) {
+			return ErrWebhookAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// rejectPrivateAddress 接続直前（名前解決後）に接続先のアドレスを確認する net.Dialer.Control
+// 保存時の確認の後に DNS の応答が変わった場合も内部ネットワークに接続しない
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicAddress(ip) {
+		return ErrWebhookAddressNotAllowed
+	}
+	return nil
+}
+
+// isPublicAddress ループバック・リンクローカル・プライベートなどの内部ネットワークのアドレスではないか
+func isPublicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// mustParseCIDR CIDR表記のネットワークを解釈（定数の定義用）
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// signWebhookBody 本文の HMAC-SHA256（16進数）
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
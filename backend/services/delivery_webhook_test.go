@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookPostClassifiesStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       DeliveryStatus
+		wantAfter  time.Duration
+	}{
+		{name: "200", status: http.StatusOK, want: DeliverySucceeded},
+		{name: "204", status: http.StatusNoContent, want: DeliverySucceeded},
+		{name: "408", status: http.StatusRequestTimeout, want: DeliveryRetryable},
+		{name: "429 Retry-After 秒数", status: http.StatusTooManyRequests, retryAfter: "7", want: DeliveryRetryable, wantAfter: 7 * time.Second},
+		{name: "500", status: http.StatusInternalServerError, want: DeliveryRetryable},
+		{name: "503 Retry-After 不正", status: http.StatusServiceUnavailable, retryAfter: "soon", want: DeliveryRetryable},
+		{name: "400", status: http.StatusBadRequest, want: DeliveryPermanent},
+		{name: "404", status: http.StatusNotFound, want: DeliveryPermanent},
+		{name: "410", status: http.StatusGone, want: DeliveryPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			channel := newWebhookChannel("", 5*time.Second, true)
+			result := channel.Post(context.Background(), server.URL, "key", map[string]string{"event": "test"})
+			if result.Status != tt.want {
+				t.Fatalf("Status = %s, want %s (err=%v)", result.Status, tt.want, result.Err)
+			}
+			if result.RetryAfter != tt.wantAfter {
+				t.Errorf("RetryAfter = %v, want %v", result.RetryAfter, tt.wantAfter)
+			}
+			if tt.want == DeliverySucceeded && result.Err != nil {
+				t.Errorf("Err = %v, want nil", result.Err)
+			}
+			if tt.want != DeliverySucceeded && result.Err == nil {
+				t.Error("Err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestWebhookPostRetryAfterHTTPDate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	result := newWebhookChannel("", 5*time.Second, true).Post(context.Background(), server.URL, "key", struct{}{})
+	if result.Status != DeliveryRetryable {
+		t.Fatalf("Status = %s, want %s", result.Status, DeliveryRetryable)
+	}
+	if result.RetryAfter < 50*time.Second || result.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want about 1m", result.RetryAfter)
+	}
+}
+
+func TestWebhookPostHeaders(t *testing.T) {
+	var idempotencyKey, signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		signature = r.Header.Get("X-Yanwari-Signature")
+	}))
+	defer server.Close()
+
+	result := newWebhookChannel("secret", 5*time.Second, true).Post(context.Background(), server.URL, "message-1", struct{}{})
+	if result.Status != DeliverySucceeded {
+		t.Fatalf("Status = %s, want %s (err=%v)", result.Status, DeliverySucceeded, result.Err)
+	}
+	if idempotencyKey != "message-1" {
+		t.Errorf("Idempotency-Key = %q, want %q", idempotencyKey, "message-1")
+	}
+	if want := "sha256=" + signWebhookBody("secret", []byte("{}")); signature != want {
+		t.Errorf("X-Yanwari-Signature = %q, want %q", signature, want)
+	}
+}
+
+func TestWebhookPostConnectionErrorIsRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	result := newWebhookChannel("", 5*time.Second, true).Post(context.Background(), url, "key", struct{}{})
+	if result.Status != DeliveryRetryable {
+		t.Errorf("Status = %s, want %s (err=%v)", result.Status, DeliveryRetryable, result.Err)
+	}
+}
+
+func TestWebhookPostInvalidURLIsPermanent(t *testing.T) {
+	for _, url := range []string{"", "ftp://example.com/hook", "http://", "://bad"} {
+		result := NewWebhookChannel("", 5*time.Second).Post(context.Background(), url, "key", struct{}{})
+		if result.Status != DeliveryPermanent {
+			t.Errorf("Post(%q) Status = %s, want %s", url, result.Status, DeliveryPermanent)
+		}
+	}
+}
+
+func TestWebhookPostRejectsPrivateAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	result := NewWebhookChannel("", 5*time.Second).Post(context.Background(), server.URL, "key", struct{}{})
+	if result.Status != DeliveryPermanent || !errors.Is(result.Err, ErrWebhookAddressNotAllowed) {
+		t.Errorf("Post(loopback) = %s (err=%v), want permanent ErrWebhookAddressNotAllowed", result.Status, result.Err)
+	}
+	if called {
+		t.Error("loopback server was called")
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "http://127.0.0.1/hook", wantErr: ErrWebhookAddressNotAllowed},
+		{url: "http://[::1]:8080/hook", wantErr: ErrWebhookAddressNotAllowed},
+		{url: "http://10.0.0.1/hook", wantErr: ErrWebhookAddressNotAllowed},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: ErrWebhookAddressNotAllowed},
+		{url: "https://8.8.8.8/hook"},
+	}
+	for _, tt := range tests {
+		err := ValidateWebhookURL(context.Background(), tt.url)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ValidateWebhookURL(%q) = %v, want %v", tt.url, err, tt.wantErr)
+		}
+	}
+
+	if err := ValidateWebhookURL(context.Background(), "ftp://example.com/hook"); err == nil || !strings.Contains(err.Error(), "無効なWebhook URL") {
+		t.Errorf("ValidateWebhookURL(ftp) = %v, want invalid URL error", err)
+	}
+}
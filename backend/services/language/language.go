@@ -0,0 +1,86 @@
+// Package language メッセージの言語判定と、対応する言語の一覧
+//
+// 判定は文字種の出現数のみで行う（外部ライブラリ・モデルを使わない）。
+// かなを含み、かなと漢字がラテン文字に対して多ければ日本語、ハングルが多ければ韓国語、
+// 漢字が多ければ中国語、ラテン文字が多ければ英語とみなす。
+// 英文中の日本人の名前（「田中さん」など）や、日本語の文中のURLで判定が変わらないよう、
+// 漢字・かなは1文字をラテン文字2文字分として比べ、URL・メールアドレスは数えない
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 対応する言語（ISO 639-1）
+const (
+	Japanese = "ja"
+	English  = "en"
+	Chinese  = "zh"
+	Korean   = "ko"
+)
+
+// Default 判定できない場合の言語
+const Default = Japanese
+
+// names 言語の表示名（プロンプトで出力言語を指示するのに使う）
+var names = map[string]string{
+	Japanese: "日本語",
+	English:  "英語（English）",
+	Chinese:  "中国語（中文）",
+	Korean:   "韓国語（한국어）",
+}
+
+// Supported 対応する言語か
+func Supported(code string) bool {
+	_, ok := names[code]
+	return ok
+}
+
+// Name 言語の表示名（対応していない言語の場合はコードをそのまま返す）
+func Name(code string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// Detect テキストの言語を判定する（文字が無い場合は Default）
+func Detect(text string) string {
+	var kana, han, hangul, latin int
+	for _, word := range strings.Fields(text) {
+		if isAddress(word) {
+			continue
+		}
+		for _, r := range word {
+			switch {
+			case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+				kana++
+			case unicode.Is(unicode.Han, r):
+				han++
+			case unicode.Is(unicode.Hangul, r):
+				hangul++
+			case r < unicode.MaxASCII && unicode.IsLetter(r):
+				latin++
+			}
+		}
+	}
+
+	switch {
+	case kana > 0 && kana*4 >= hangul && (kana+han)*2 >= latin:
+		return Japanese
+	case hangul > 0 && hangul >= han && hangul*2 >= latin:
+		return Korean
+	case han > 0 && han*2 >= latin:
+		return Chinese
+	case latin > 0:
+		return English
+	default:
+		return Default
+	}
+}
+
+// isAddress URL・メールアドレスか（言語の判定に使わない）
+func isAddress(word string) bool {
+	return strings.Contains(word, "://") || strings.HasPrefix(word, "www.") || strings.Contains(word, "@")
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"yanwari-message-backend/models"
+)
+
+// DeliveryJobName スケジュール配信ジョブのリース名
+const DeliveryJobName = "delivery"
+
+// LeaderElector MongoDB のリースによるバックグラウンドジョブのリーダー選出
+// 複数のインスタンスのうちリースを保持している1つだけが IsLeader() = true になる
+// 各インスタンスで実行が必要な処理（プロンプト設定の同期など）には使わない
+type LeaderElector struct {
+	leases *models.JobLeaseService
+	name   string
+	holder string
+	ttl    time.Duration
+	// leaseUntil リーダーとして振る舞える期限（UnixNano、リーダーでない場合は0）
+	leaseUntil atomic.Int64
+}
+
+// NewLeaderElector リーダー選出を作成（ttl はリースの期限、ttl/3 ごとに更新する）
+func NewLeaderElector(leases *models.JobLeaseService, name, holder string, ttl time.Duration) *LeaderElector {
+	return &LeaderElector{
+		leases: leases,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+	}
+}
+
+// Name ジョブ名
+func (e *LeaderElector) Name() string {
+	return e.name
+}
+
+// Holder このインスタンスのID
+func (e *LeaderElector) Holder() string {
+	return e.holder
+}
+
+// IsLeader このインスタンスが現在リーダーか
+// リースの更新に失敗し続けた場合は、データベース上の期限より前に false になる
+func (e *LeaderElector) IsLeader() bool {
+	until := e.leaseUntil.Load()
+	return until > 0 && time.Now().UnixNano() < until
+}
+
+// Start リースの取得・更新を開始（ctx のキャンセルで停止し、保持しているリースを解放する）
+func (e *LeaderElector) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		e.renew(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				e.release()
+				return
+			case <-ticker.C:
+				e.renew(ctx)
+			}
+		}
+	}()
+}
+
+// renew リースを取得・更新し、リーダーかどうかを反映
+func (e *LeaderElector) renew(ctx context.Context) {
+	// 期限はリクエスト前の時刻から数える（応答が遅れてもデータベース上の期限を超えてリーダーとして振る舞わない）
+	started := time.Now()
+	renewCtx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	wasLeader := e.IsLeader()
+	_, acquired, err := e.leases.Acquire(renewCtx, e.name, e.holder, e.ttl)
+	if err != nil {
+		// 一時的なエラーでは直ちに降格せず、手元の期限が切れるまではリーダーのまま
+		log.Printf("⚠️ [Leader] %s のリース更新エラー: %v", e.name, err)
+		return
+	}
+	if !acquired {
+		e.leaseUntil.Store(0)
+		if wasLeader {
+			log.Printf("🔻 [Leader] %s のリーダーではなくなりました (インスタンス: %s)", e.name, e.holder)
+		}
+		return
+	}
+
+	e.leaseUntil.Store(started.Add(e.ttl).UnixNano())
+	if !wasLeader {
+		log.Printf("👑 [Leader] %s のリーダーになりました (インスタンス: %s)", e.name, e.holder)
+	}
+}
+
+// release 保持しているリースを解放（保持していない場合は何もしない）
+func (e *LeaderElector) release() {
+	wasLeader := e.IsLeader()
+	e.leaseUntil.Store(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.leases.Release(ctx, e.name, e.holder); err != nil {
+		log.Printf("⚠️ [Leader] %s のリース解放エラー: %v", e.name, err)
+		return
+	}
+	if wasLeader {
+		log.Printf("[Leader] %s のリースを解放しました (インスタンス: %s)", e.name, e.holder)
+	}
+}
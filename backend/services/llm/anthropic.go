@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	anthropicMessagesURL = "https://api.anthropic.com/v1/messages"
+	anthropicVersion     = "2023-06-01"
+)
+
+// AnthropicProvider Anthropic Messages APIのプロバイダー
+type AnthropicProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// anthropicRequest Anthropic API リクエスト構造
+type anthropicRequest struct {
+	Model     string    `json:"model"`
+	MaxTokens int       `json:"max_tokens"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	Stream    bool      `json:"stream,omitempty"`
+}
+
+// anthropicResponse Anthropic API レスポンス構造
+type anthropicResponse struct {
+	Model      string             `json:"model"`
+	StopReason string             `json:"stop_reason"`
+	Content    []anthropicContent `json:"content"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicContent Anthropic APIコンテンツ構造
+type anthropicContent struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// NewAnthropicProvider Anthropicプロバイダーを作成
+func NewAnthropicProvider(apiKey string) *AnthropicProvider {
+	return &AnthropicProvider{
+		apiKey:  apiKey,
+		baseURL: anthropicMessagesURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name プロバイダー名
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+// Complete Anthropic Messages APIを呼び出して補完を実行
+func (p *AnthropicProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	label := req.Label()
+
+	body, prefill := p.buildRequestBody(req)
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+
+	fmt.Printf("[%s] リクエスト詳細 - Provider: %s, Model: %s, MaxTokens: %d, サイズ: %d bytes\n", label, p.Name(), body.Model, body.MaxTokens, len(jsonData))
+
+	// 再試行・サーキットブレーカーは ResilientProvider が担うため、ここでは1回だけ送信する
+	httpReq, err := p.newHTTPRequest(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("API呼び出しに失敗: %w", err)
+	}
+	defer resp.Body.Close()
+
+	fmt.Printf("[%s] レスポンス受信: ステータス %d\n", label, resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError("Anthropic", resp, bodyBytes)
+	}
+
+	var apiResponse anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析に失敗: %w", err)
+	}
+
+	if len(apiResponse.Content) == 0 {
+		return nil, fmt.Errorf("空のレスポンスが返されました")
+	}
+
+	return &Response{
+		Text:       prefill + apiResponse.Content[0].Text,
+		Model:      apiResponse.Model,
+		StopReason: apiResponse.StopReason,
+		Usage: Usage{
+			InputTokens:  apiResponse.Usage.InputTokens,
+			OutputTokens: apiResponse.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// buildRequestBody 共通リクエストをAnthropic形式に変換
+// JSON出力が要求された場合に付与したプレフィルを併せて返す
+func (p *AnthropicProvider) buildRequestBody(req *Request) (anthropicRequest, string) {
+	body := anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		System:    req.System,
+		Messages:  append([]Message(nil), req.Messages...),
+	}
+
+	// JSON出力はネイティブ対応がないため、システム指示と "{" のプレフィルで誘導する
+	prefill := ""
+	if req.wantsJSON() {
+		if body.System != "" {
+			body.System += "\n\n"
+		}
+		body.System += req.jsonInstruction()
+		prefill = "{"
+		body.Messages = append(body.Messages, Message{Role: RoleAssistant, Content: prefill})
+	}
+
+	return body, prefill
+}
+
+// newHTTPRequest 認証ヘッダー付きのHTTPリクエストを作成
+func (p *AnthropicProvider) newHTTPRequest(ctx context.Context, jsonData []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("HTTPリクエストの作成に失敗: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	return httpReq, nil
+}
+
+// anthropicStreamEvent ストリーミングAPIのイベント構造
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Stream Anthropic Messages APIのストリーミングモードで補完を実行
+func (p *AnthropicProvider) Stream(ctx context.Context, req *Request, onDelta DeltaFunc) (*Response, error) {
+	label := req.Label()
+
+	body, prefill := p.buildRequestBody(req)
+	body.Stream = true
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+
+	httpReq, err := p.newHTTPRequest(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	fmt.Printf("[%s] ストリーミング開始 - Provider: %s, Model: %s, MaxTokens: %d\n", label, p.Name(), body.Model, body.MaxTokens)
+
+	// ストリーミングは全体時間が長くなるためクライアントタイムアウトを使わずコンテキストで制御する
+	client := &http.Client{Transport: p.httpClient.Transport}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("API呼び出しに失敗: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError("Anthropic", resp, bodyBytes)
+	}
+
+	result := &Response{Text: prefill}
+	if prefill != "" && onDelta != nil {
+		onDelta(prefill)
+	}
+
+	err = readSSE(resp.Body, func(ev sseEvent) (bool, error) {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(ev.Data), &event); err != nil {
+			return false, fmt.Errorf("ストリームイベントの解析に失敗: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			result.Model = event.Message.Model
+			result.Usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				result.Text += event.Delta.Text
+				if onDelta != nil {
+					onDelta(event.Delta.Text)
+				}
+			}
+		case "message_delta":
+			result.StopReason = event.Delta.StopReason
+			result.Usage.OutputTokens = event.Usage.OutputTokens
+		case "message_stop":
+			return false, nil
+		case "error":
+			return false, fmt.Errorf("Anthropic API ストリームエラー: %s: %s", event.Error.Type, event.Error.Message)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Text == prefill {
+		return nil, fmt.Errorf("空のレスポンスが返されました")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAnthropicProvider handler に接続する Anthropic プロバイダー
+func newTestAnthropicProvider(t *testing.T, handler http.HandlerFunc) *AnthropicProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	provider := NewAnthropicProvider("test-key")
+	provider.baseURL = server.URL
+	return provider
+}
+
+func TestAnthropicComplete(t *testing.T) {
+	var got anthropicRequest
+	provider := newTestAnthropicProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("x-api-key"); key != "test-key" {
+			t.Errorf("x-api-key = %q, want test-key", key)
+		}
+		if version := r.Header.Get("anthropic-version"); version != anthropicVersion {
+			t.Errorf("anthropic-version = %q, want %s", version, anthropicVersion)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"model": "claude-test", "stop_reason": "end_turn", "content": [{"type": "text", "text": "\"tone\": \"gentle\"}"}], "usage": {"input_tokens": 12, "output_tokens": 5}}`)
+	})
+
+	req := NewUserRequest("claude-test", 256, "やわらかくしてください")
+	req.System = "あなたは編集者です"
+	req.ResponseFormat = ResponseFormat{Type: ResponseFormatJSON}
+	resp, err := provider.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	// JSON出力はシステム指示と "{" のプレフィルで誘導し、応答の先頭にプレフィルを補う
+	if !strings.HasPrefix(got.System, "あなたは編集者です\n\n") || !strings.Contains(got.System, "JSON") {
+		t.Errorf("system = %q, want original system followed by JSON instruction", got.System)
+	}
+	if n := len(got.Messages); n != 2 || got.Messages[n-1] != (Message{Role: RoleAssistant, Content: "{"}) {
+		t.Errorf("messages = %+v, want user message followed by assistant prefill", got.Messages)
+	}
+	if resp.Text != `{"tone": "gentle"}` {
+		t.Errorf("Text = %q, want prefill + content", resp.Text)
+	}
+	if resp.Model != "claude-test" || resp.StopReason != "end_turn" || resp.Usage != (Usage{InputTokens: 12, OutputTokens: 5}) {
+		t.Errorf("Response = %+v, want model, stop reason and usage from API", resp)
+	}
+}
+
+func TestAnthropicCompleteAPIError(t *testing.T) {
+	tests := []struct {
+		status         int
+		retryAfter     string
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+	}{
+		{status: http.StatusTooManyRequests, retryAfter: "3", wantRetryable: true, wantRetryAfter: 3 * time.Second},
+		{status: 529, wantRetryable: true},
+		{status: http.StatusBadRequest, wantRetryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			provider := newTestAnthropicProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"type": "error"}`)
+			})
+
+			_, err := provider.Complete(context.Background(), NewUserRequest("claude-test", 256, "こんにちは"))
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Retryable() != tt.wantRetryable || apiErr.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("APIError = %+v (retryable=%v), want status %d retryable=%v RetryAfter=%v", apiErr, apiErr.Retryable(), tt.status, tt.wantRetryable, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	provider := newTestAnthropicProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		var body anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.Stream {
+			t.Errorf("request stream = %v (err=%v), want true", body.Stream, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type": "message_start", "message": {"model": "claude-test", "usage": {"input_tokens": 10}}}`,
+			`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "お疲れさまです。"}}`,
+			`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "確認します。"}}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 7}}`,
+			`{"type": "message_stop"}`,
+		} {
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", event)
+		}
+	})
+
+	var deltas []string
+	resp, err := provider.Stream(context.Background(), NewUserRequest("claude-test", 256, "確認して"), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	if resp.Text != "お疲れさまです。確認します。" || strings.Join(deltas, "") != resp.Text {
+		t.Errorf("Text = %q, deltas = %q, want both to be the streamed text", resp.Text, deltas)
+	}
+	if resp.Model != "claude-test" || resp.StopReason != "end_turn" || resp.Usage != (Usage{InputTokens: 10, OutputTokens: 7}) {
+		t.Errorf("Response = %+v, want model, stop reason and usage from events", resp)
+	}
+}
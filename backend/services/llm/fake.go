@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"unicode/utf8"
+)
+
+// ResponderFunc フェイクプロバイダーの応答生成関数
+type ResponderFunc func(ctx context.Context, req *Request) (string, error)
+
+// FakeProvider ネットワークを使用しない決定的なプロバイダー（ローカル開発・テスト用）
+type FakeProvider struct {
+	mu        sync.Mutex
+	responder ResponderFunc
+	requests  []*Request
+}
+
+// NewFakeProvider 応答生成関数を指定してフェイクプロバイダーを作成（nil の場合は EchoResponder）
+func NewFakeProvider(responder ResponderFunc) *FakeProvider {
+	if responder == nil {
+		responder = EchoResponder
+	}
+	return &FakeProvider{
+		responder: responder,
+	}
+}
+
+// Name プロバイダー名
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Complete 応答生成関数を呼び出して決定的な応答を返す
+func (p *FakeProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	text, err := p.responder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	inputChars := utf8.RuneCountInString(req.System)
+	for _, m := range req.Messages {
+		inputChars += utf8.RuneCountInString(m.Content)
+	}
+
+	return &Response{
+		Text:       text,
+		Model:      req.Model,
+		StopReason: "end_turn",
+		Usage: Usage{
+			InputTokens:  inputChars,
+			OutputTokens: utf8.RuneCountInString(text),
+		},
+	}, nil
+}
+
+// Requests これまでに受け付けたリクエストを取得（テストでの検証用）
+func (p *FakeProvider) Requests() []*Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Request(nil), p.requests...)
+}
+
+// EchoResponder 最後のユーザー発話をそのまま返す既定の応答生成関数（JSON出力の要求には "{}" を返す）
+func EchoResponder(ctx context.Context, req *Request) (string, error) {
+	if req.wantsJSON() {
+		return "{}", nil
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			return req.Messages[i].Content, nil
+		}
+	}
+	return "", nil
+}
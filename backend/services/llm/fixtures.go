@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Fixture 記録済みのLLM応答（JSONLの1行）
+type Fixture struct {
+	Key      string            `json:"key"`
+	Model    string            `json:"model"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Text     string            `json:"text"`
+	Usage    Usage             `json:"usage"`
+}
+
+// RequestKey リクエスト内容から決定的なフィクスチャキーを計算
+// Metadata はAPIに送信されないためキーに含めない
+func RequestKey(req *Request) string {
+	payload, _ := json.Marshal(struct {
+		Model          string         `json:"model"`
+		MaxTokens      int            `json:"max_tokens"`
+		System         string         `json:"system"`
+		Messages       []Message      `json:"messages"`
+		ResponseFormat ResponseFormat `json:"response_format"`
+	}{req.Model, req.MaxTokens, req.System, req.Messages, req.ResponseFormat})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// FixtureStore JSONLファイルに保存されたフィクスチャ集合
+type FixtureStore struct {
+	mu       sync.RWMutex
+	path     string
+	fixtures map[string]Fixture
+}
+
+// LoadFixtureStore JSONLファイルからフィクスチャを読み込み（ファイルが無い場合は空）
+func LoadFixtureStore(path string) (*FixtureStore, error) {
+	store := &FixtureStore{
+		path:     path,
+		fixtures: make(map[string]Fixture),
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("フィクスチャファイルの読み込みに失敗 (%s): %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(scanner.Bytes(), &fixture); err != nil {
+			return nil, fmt.Errorf("フィクスチャの解析に失敗 (%s:%d): %w", path, line, err)
+		}
+		store.fixtures[fixture.Key] = fixture
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("フィクスチャファイルの読み込みに失敗 (%s): %w", path, err)
+	}
+
+	return store, nil
+}
+
+// Lookup キーに対応するフィクスチャを取得
+func (s *FixtureStore) Lookup(key string) (Fixture, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fixture, ok := s.fixtures[key]
+	return fixture, ok
+}
+
+// Append フィクスチャを追加してファイルに追記
+func (s *FixtureStore) Append(fixture Fixture) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(fixture)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("フィクスチャファイルの書き込みに失敗 (%s): %w", s.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("フィクスチャファイルの書き込みに失敗 (%s): %w", s.path, err)
+	}
+
+	s.fixtures[fixture.Key] = fixture
+	return nil
+}
+
+// ReplayProvider 記録済みフィクスチャを優先して応答するプロバイダー
+// フィクスチャが無いリクエストは fallback に委譲する（fallback が nil の場合はエラー）
+type ReplayProvider struct {
+	store    *FixtureStore
+	fallback Provider
+}
+
+// NewReplayProvider リプレイプロバイダーを作成
+func NewReplayProvider(store *FixtureStore, fallback Provider) *ReplayProvider {
+	return &ReplayProvider{
+		store:    store,
+		fallback: fallback,
+	}
+}
+
+// Name プロバイダー名
+func (p *ReplayProvider) Name() string {
+	if p.fallback != nil {
+		return "replay+" + p.fallback.Name()
+	}
+	return "replay"
+}
+
+// Complete フィクスチャを検索し、見つからなければ fallback を呼び出す
+func (p *ReplayProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	key := RequestKey(req)
+	if fixture, ok := p.store.Lookup(key); ok {
+		fmt.Printf("[%s] フィクスチャをリプレイ: %s\n", req.Label(), key[:12])
+		return &Response{
+			Text:       fixture.Text,
+			Model:      fixture.Model,
+			StopReason: "end_turn",
+			Usage:      fixture.Usage,
+		}, nil
+	}
+
+	if p.fallback == nil {
+		return nil, fmt.Errorf("フィクスチャが見つかりません: %s", key)
+	}
+	return p.fallback.Complete(ctx, req)
+}
+
+// BreakerStatus fallback のサーキットブレーカー状態
+func (p *ReplayProvider) BreakerStatus() (BreakerStatus, bool) {
+	if p.fallback == nil {
+		return BreakerStatus{}, false
+	}
+	return ProviderBreakerStatus(p.fallback)
+}
+
+// RecordingProvider 下位プロバイダーの応答をフィクスチャとして記録するプロバイダー
+type RecordingProvider struct {
+	store *FixtureStore
+	inner Provider
+}
+
+// NewRecordingProvider 記録プロバイダーを作成
+func NewRecordingProvider(store *FixtureStore, inner Provider) *RecordingProvider {
+	return &RecordingProvider{
+		store: store,
+		inner: inner,
+	}
+}
+
+// Name プロバイダー名
+func (p *RecordingProvider) Name() string {
+	return "record+" + p.inner.Name()
+}
+
+// BreakerStatus 下位プロバイダーのサーキットブレーカー状態
+func (p *RecordingProvider) BreakerStatus() (BreakerStatus, bool) {
+	return ProviderBreakerStatus(p.inner)
+}
+
+// Complete 下位プロバイダーを呼び出し、成功した応答を記録
+func (p *RecordingProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := p.inner.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := Fixture{
+		Key:      RequestKey(req),
+		Model:    resp.Model,
+		Metadata: req.Metadata,
+		Text:     resp.Text,
+		Usage:    resp.Usage,
+	}
+	if err := p.store.Append(fixture); err != nil {
+		fmt.Printf("[%s] フィクスチャ記録エラー: %v\n", req.Label(), err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequestKey(t *testing.T) {
+	base := func() *Request {
+		req := NewUserRequest("claude-test", 256, "確認して")
+		req.System = "あなたは編集者です"
+		return req
+	}
+	key := RequestKey(base())
+
+	// Metadata はAPIに送信されないためキーに影響しない
+	req := base()
+	req.Metadata["label"] = "other"
+	req.Metadata["task"] = TaskToneTransform
+	if got := RequestKey(req); got != key {
+		t.Errorf("RequestKey with different metadata = %s, want %s", got, key)
+	}
+
+	changes := map[string]func(req *Request){
+		"model":           func(req *Request) { req.Model = "claude-other" },
+		"max_tokens":      func(req *Request) { req.MaxTokens = 512 },
+		"system":          func(req *Request) { req.System = "あなたは校正者です" },
+		"messages":        func(req *Request) { req.Messages[0].Content = "確認してください" },
+		"response_format": func(req *Request) { req.ResponseFormat = ResponseFormat{Type: ResponseFormatJSON} },
+	}
+	for name, change := range changes {
+		req := base()
+		change(req)
+		if RequestKey(req) == key {
+			t.Errorf("RequestKey does not change with %s", name)
+		}
+	}
+}
+
+func TestRecordAndReplayFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	ctx := context.Background()
+	req := NewUserRequest("claude-test", 256, "確認して")
+	req.Metadata["task"] = TaskToneTransform
+
+	// 記録: 下位プロバイダーの応答をファイルに追記する
+	store, err := LoadFixtureStore(path)
+	if err != nil {
+		t.Fatalf("LoadFixtureStore error: %v", err)
+	}
+	recorded, err := NewRecordingProvider(store, NewFakeProvider(nil)).Complete(ctx, req)
+	if err != nil {
+		t.Fatalf("record error: %v", err)
+	}
+
+	// リプレイ: 新しく読み込んだフィクスチャから、下位プロバイダーを呼ばずに同じ応答を返す
+	store, err = LoadFixtureStore(path)
+	if err != nil {
+		t.Fatalf("LoadFixtureStore error: %v", err)
+	}
+	fixture, ok := store.Lookup(RequestKey(req))
+	if !ok || fixture.Metadata["task"] != TaskToneTransform {
+		t.Fatalf("fixture = %+v (found=%v), want recorded fixture with metadata", fixture, ok)
+	}
+
+	fallback := NewFakeProvider(nil)
+	replayed, err := NewReplayProvider(store, fallback).Complete(ctx, req)
+	if err != nil {
+		t.Fatalf("replay error: %v", err)
+	}
+	if replayed.Text != recorded.Text || replayed.Usage != recorded.Usage {
+		t.Errorf("replayed = %+v, want %+v", replayed, recorded)
+	}
+	if n := len(fallback.Requests()); n != 0 {
+		t.Errorf("fallback called %d times for a recorded request, want 0", n)
+	}
+
+	// 記録の無いリクエストは fallback に委譲し、fallback が無ければエラー
+	other := NewUserRequest("claude-test", 256, "別の依頼")
+	if _, err := NewReplayProvider(store, fallback).Complete(ctx, other); err != nil {
+		t.Errorf("replay with fallback error: %v", err)
+	}
+	if n := len(fallback.Requests()); n != 1 {
+		t.Errorf("fallback called %d times for an unrecorded request, want 1", n)
+	}
+	if _, err := NewReplayProvider(store, nil).Complete(ctx, other); err == nil {
+		t.Error("replay without fixture and fallback error = nil, want error")
+	}
+}
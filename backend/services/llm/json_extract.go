@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrNoJSON 応答にJSONオブジェクトが含まれていない
+var ErrNoJSON = errors.New("応答にJSONオブジェクトが含まれていません")
+
+var (
+	// trailingCommaPattern 閉じ括弧の直前の余分なカンマ
+	trailingCommaPattern = regexp.MustCompile(`,\s*([}\]])`)
+	// smartQuoteReplacer 全角・curly の引用符を JSON の引用符にそろえる
+	smartQuoteReplacer = strings.NewReplacer("“", `"`, "”", `"`, "＂", `"`)
+)
+
+// ExtractJSON モデルの応答テキストからJSONオブジェクトを取り出す
+//
+// 前後の説明文やコードフェンスは無視し、最初の "{" から対応する "}" までを取り出す。
+// そのままでは解析できない場合は次の修復を試みる:
+//   - 閉じ括弧直前の余分なカンマを取り除く
+//   - curly quote（“ ”）を通常の引用符に置き換える
+//   - max_tokens で途中終了した場合に、開いたままの文字列・括弧を閉じる
+func ExtractJSON(text string) (json.RawMessage, error) {
+	start := strings.Index(text, "{")
+	if start < 0 {
+		return nil, ErrNoJSON
+	}
+
+	candidate, complete := scanJSONObject(text[start:])
+	if complete && json.Valid([]byte(candidate)) {
+		return json.RawMessage(candidate), nil
+	}
+
+	repaired := smartQuoteReplacer.Replace(candidate)
+	if !complete {
+		repaired = closeJSON(repaired)
+	}
+	repaired = trailingCommaPattern.ReplaceAllString(repaired, "$1")
+	if !json.Valid([]byte(repaired)) {
+		return nil, errors.New("応答のJSONを修復できませんでした")
+	}
+	return json.RawMessage(repaired), nil
+}
+
+// scanJSONObject 先頭の "{" に対応する "}" までを返す（文字列中の括弧は数えない）
+// 対応する "}" が無い場合は末尾までを返し、complete は false になる
+func scanJSONObject(text string) (candidate string, complete bool) {
+	depth := 0
+	inString, escaped := false, false
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch r {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case r == '"':
+			inString = true
+		case r == '{' || r == '[':
+			depth++
+		case r == '}' || r == ']':
+			depth--
+			if depth == 0 {
+				return text[:i+1], true
+			}
+		}
+	}
+	return text, false
+}
+
+// closeJSON 途中で終わったJSONの開いたままの括弧を閉じる
+func closeJSON(text string) string {
+	text = strings.TrimRight(strings.TrimSpace(text), "`")
+
+	var stack []rune
+	inString, escaped := false, false
+	lastComplete := 0 // 直前の完結した要素の終わり（カンマ・開き括弧の位置）
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch r {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case r == '"':
+			inString = true
+		case r == '{':
+			stack = append(stack, '}')
+			lastComplete = i + 1
+		case r == '[':
+			stack = append(stack, ']')
+			lastComplete = i + 1
+		case r == '}' || r == ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case r == ',':
+			lastComplete = i
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(strings.TrimSpace(text), ","))
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteRune(stack[i])
+	}
+	closed := trailingCommaPattern.ReplaceAllString(b.String(), "$1")
+
+	// 書きかけの値（文字列の途中・"key": の直後など）で終わっている場合は、最後の完結した要素までで切り詰める
+	if !inString && json.Valid([]byte(closed)) || lastComplete == 0 || lastComplete >= len(text) {
+		return closed
+	}
+	return closeJSON(text[:lastComplete])
+}
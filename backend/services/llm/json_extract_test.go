@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "JSONのみ", text: `{"a": 1}`, want: `{"a": 1}`},
+		{
+			name: "前後の説明文とコードフェンス",
+			text: "以下が結果です。\n```json\n{\"a\": {\"b\": [1, 2]}}\n```\n以上です。",
+			want: `{"a": {"b": [1, 2]}}`,
+		},
+		{name: "文字列中の括弧は数えない", text: `{"a": "}{"} 後続の文`, want: `{"a": "}{"}`},
+		{name: "余分なカンマ", text: `{"a": [1, 2,], "b": 3,}`, want: `{"a": [1, 2], "b": 3}`},
+		{name: "curly quote", text: `{“a”: “b”}`, want: `{"a": "b"}`},
+		{name: "括弧の途中で終了", text: `{"a": [1, 2`, want: `{"a": [1, 2]}`},
+		{name: "要素の区切りで終了", text: `{"a": 1, "b": [{"c": 2},`, want: `{"a": 1, "b": [{"c": 2}]}`},
+		{name: "文字列の途中で終了", text: `{"a": 1, "b": "途中まで`, want: `{"a": 1}`},
+		{name: "キーの直後で終了", text: `{"a": 1, "b":`, want: `{"a": 1}`},
+		{name: "コードフェンスで終了", text: "```json\n{\"a\": [1\n```", want: `{"a": [1]}`},
+		{name: "修復できない", text: `{"a": tru}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractJSON(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ExtractJSON(%q) = %s, want error", tt.text, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractJSON(%q) error: %v", tt.text, err)
+			}
+			assertSameJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestExtractJSONWithoutObject(t *testing.T) {
+	if _, err := ExtractJSON("JSONを返せませんでした"); !errors.Is(err, ErrNoJSON) {
+		t.Errorf("ExtractJSON error = %v, want %v", err, ErrNoJSON)
+	}
+}
+
+func TestCloseJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: `{"a": {"b": 1`, want: `{"a": {"b": 1}}`},
+		{text: `{"a": [1, 2,`, want: `{"a": [1, 2]}`},
+		{text: `{"a": "x", "b": "y`, want: `{"a": "x"}`},
+		{text: `{"a": [{"b": "c\"`, want: `{"a": [{}]}`},
+		{text: "{\"a\": 1}\n```", want: `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		got := closeJSON(tt.text)
+		if !json.Valid([]byte(got)) {
+			t.Errorf("closeJSON(%q) = %q, not valid JSON", tt.text, got)
+			continue
+		}
+		assertSameJSON(t, json.RawMessage(got), tt.want)
+	}
+}
+
+// assertSameJSON got と want が同じ値のJSONか
+func assertSameJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("unmarshal %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("unmarshal %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
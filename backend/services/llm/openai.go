@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider OpenAI互換（Chat Completions API）のプロバイダー
+// Azure OpenAI・vLLM・Ollama などの互換エンドポイントにも baseURL で接続できる
+type OpenAIProvider struct {
+	apiKey        string
+	baseURL       string
+	modelOverride string
+	httpClient    *http.Client
+}
+
+// openAIRequest Chat Completions リクエスト構造
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Messages       []openAIMessage       `json:"messages"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// openAIMessage Chat Completions メッセージ構造
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIResponseFormat Chat Completions の出力形式指定
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// openAIJSONSchema json_schema 形式の詳細
+type openAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// openAIResponse Chat Completions レスポンス構造
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// NewOpenAIProvider OpenAI互換プロバイダーを作成
+// modelOverride が空でない場合、リクエストのモデル名（YAML設定のClaudeモデル等）を置き換える
+func NewOpenAIProvider(apiKey, baseURL, modelOverride string) *OpenAIProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	return &OpenAIProvider{
+		apiKey:        apiKey,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		modelOverride: modelOverride,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name プロバイダー名
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+// Complete Chat Completions APIを呼び出して補完を実行
+func (p *OpenAIProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	label := req.Label()
+
+	model := req.Model
+	if p.modelOverride != "" {
+		model = p.modelOverride
+	}
+
+	body := openAIRequest{
+		Model:     model,
+		MaxTokens: req.MaxTokens,
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		body.Messages = append(body.Messages, openAIMessage{Role: string(m.Role), Content: m.Content})
+	}
+	if req.wantsJSON() {
+		if len(req.ResponseFormat.Schema) > 0 {
+			body.ResponseFormat = &openAIResponseFormat{
+				Type:       "json_schema",
+				JSONSchema: &openAIJSONSchema{Name: "response", Schema: req.ResponseFormat.Schema},
+			}
+		} else {
+			body.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+		}
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("HTTPリクエストの作成に失敗: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	fmt.Printf("[%s] リクエスト詳細 - Provider: %s, Model: %s, MaxTokens: %d, サイズ: %d bytes\n", label, p.Name(), body.Model, body.MaxTokens, len(jsonData))
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("API呼び出しに失敗: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError("OpenAI互換", resp, bodyBytes)
+	}
+
+	var apiResponse openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析に失敗: %w", err)
+	}
+
+	if len(apiResponse.Choices) == 0 {
+		return nil, fmt.Errorf("空のレスポンスが返されました")
+	}
+
+	return &Response{
+		Text:       apiResponse.Choices[0].Message.Content,
+		Model:      apiResponse.Model,
+		StopReason: apiResponse.Choices[0].FinishReason,
+		Usage: Usage{
+			InputTokens:  apiResponse.Usage.PromptTokens,
+			OutputTokens: apiResponse.Usage.CompletionTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIComplete(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object"}`)
+	tests := []struct {
+		name           string
+		format         ResponseFormat
+		modelOverride  string
+		wantFormatType string
+		wantModel      string
+	}{
+		{name: "テキスト", format: ResponseFormat{Type: ResponseFormatText}, wantModel: "claude-test"},
+		{name: "JSON", format: ResponseFormat{Type: ResponseFormatJSON}, wantFormatType: "json_object", wantModel: "claude-test"},
+		{name: "JSON Schema", format: ResponseFormat{Type: ResponseFormatJSON, Schema: schema}, wantFormatType: "json_schema", wantModel: "claude-test"},
+		{name: "モデルの置き換え", format: ResponseFormat{Type: ResponseFormatText}, modelOverride: "gpt-test", wantModel: "gpt-test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got openAIRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("path = %s, want /v1/chat/completions", r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+					t.Errorf("Authorization = %q, want Bearer test-key", auth)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				fmt.Fprintf(w, `{"model": %q, "choices": [{"message": {"role": "assistant", "content": "承知しました"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 20, "completion_tokens": 4}}`, got.Model)
+			}))
+			defer server.Close()
+
+			req := NewUserRequest("claude-test", 256, "確認して")
+			req.System = "あなたは編集者です"
+			req.ResponseFormat = tt.format
+			// baseURL 末尾の "/" は取り除かれる
+			resp, err := NewOpenAIProvider("test-key", server.URL+"/v1/", tt.modelOverride).Complete(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Complete error: %v", err)
+			}
+
+			if got.Model != tt.wantModel {
+				t.Errorf("model = %q, want %q", got.Model, tt.wantModel)
+			}
+			if len(got.Messages) != 2 || got.Messages[0] != (openAIMessage{Role: "system", Content: "あなたは編集者です"}) || got.Messages[1].Role != "user" {
+				t.Errorf("messages = %+v, want system message followed by user message", got.Messages)
+			}
+			gotFormatType := ""
+			if got.ResponseFormat != nil {
+				gotFormatType = got.ResponseFormat.Type
+			}
+			if gotFormatType != tt.wantFormatType {
+				t.Errorf("response_format.type = %q, want %q", gotFormatType, tt.wantFormatType)
+			}
+			if tt.wantFormatType == "json_schema" && string(got.ResponseFormat.JSONSchema.Schema) != string(schema) {
+				t.Errorf("json_schema.schema = %s, want %s", got.ResponseFormat.JSONSchema.Schema, schema)
+			}
+			if resp.Text != "承知しました" || resp.Model != tt.wantModel || resp.StopReason != "stop" || resp.Usage != (Usage{InputTokens: 20, OutputTokens: 4}) {
+				t.Errorf("Response = %+v, want text, model, finish reason and usage from API", resp)
+			}
+		})
+	}
+}
+
+func TestOpenAICompleteAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error": {"message": "overloaded"}}`)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAIProvider("test-key", server.URL, "").Complete(context.Background(), NewUserRequest("gpt-test", 256, "こんにちは"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable || !apiErr.Retryable() {
+		t.Errorf("APIError = %+v, want retryable 503", apiErr)
+	}
+}
+
+func TestOpenAICompleteEmptyChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"model": "gpt-test", "choices": []}`)
+	}))
+	defer server.Close()
+
+	if _, err := NewOpenAIProvider("test-key", server.URL, "").Complete(context.Background(), NewUserRequest("gpt-test", 256, "こんにちは")); err == nil {
+		t.Error("Complete with no choices error = nil, want error")
+	}
+}
@@ -0,0 +1,26 @@
+package llm
+
+// ModelPricing 100万トークンあたりの料金（USD）
+type ModelPricing struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// modelPricing モデル別の公開価格表（未登録のモデルはコスト0として扱う）
+var modelPricing = map[string]ModelPricing{
+	"claude-3-haiku-20240307":    {InputPerMTok: 0.25, OutputPerMTok: 1.25},
+	"claude-3-5-haiku-20241022":  {InputPerMTok: 0.80, OutputPerMTok: 4.00},
+	"claude-3-5-sonnet-20241022": {InputPerMTok: 3.00, OutputPerMTok: 15.00},
+	"gpt-4o-mini":                {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+	"gpt-4o":                     {InputPerMTok: 2.50, OutputPerMTok: 10.00},
+}
+
+// EstimateCostUSD トークン使用量から推定コスト（USD）を計算
+func EstimateCostUSD(model string, usage Usage) float64 {
+	pricing, ok := modelPricing[model]
+	if !ok {
+		return 0
+	}
+	return float64(usage.InputTokens)*pricing.InputPerMTok/1_000_000 +
+		float64(usage.OutputTokens)*pricing.OutputPerMTok/1_000_000
+}
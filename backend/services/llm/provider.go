@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Role メッセージの発話者
+type Role string
+
+const (
+	RoleUser      Role = "user"      // ユーザー発話
+	RoleAssistant Role = "assistant" // モデル発話
+)
+
+// Message 会話メッセージ
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// ResponseFormatType 出力形式の種類
+type ResponseFormatType string
+
+const (
+	ResponseFormatText ResponseFormatType = "text" // 自由テキスト
+	ResponseFormatJSON ResponseFormatType = "json" // JSONオブジェクト
+)
+
+// ResponseFormat 構造化出力の指定
+type ResponseFormat struct {
+	Type ResponseFormatType `json:"type"`
+	// Schema JSON Schema（任意）。対応しているプロバイダーでは厳密に強制される
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// Request LLM補完リクエスト
+type Request struct {
+	Model          string
+	MaxTokens      int
+	System         string
+	Messages       []Message
+	ResponseFormat ResponseFormat
+	// Metadata 呼び出し元の識別情報（ログ出力やフェイク応答の選択に使用、APIには送信しない）
+	Metadata map[string]string
+}
+
+// 呼び出し元がMetadataに設定するタスク種別
+const (
+	TaskToneTransform   = "tone_transform"
+	TaskScheduleSuggest = "schedule_suggest"
+	TaskToneRefine      = "tone_refine"
+	TaskHarshness       = "harshness_analysis"
+	TaskToneExplain     = "tone_explain"
+)
+
+// Usage トークン使用量
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// Response LLM補完レスポンス
+type Response struct {
+	Text       string
+	Model      string
+	StopReason string
+	Usage      Usage
+}
+
+// Provider LLMプロバイダーの共通インターフェース
+type Provider interface {
+	// Name プロバイダー名（ログ・ヘルスチェック用）
+	Name() string
+	// Complete 補完を実行してテキストを返す
+	Complete(ctx context.Context, req *Request) (*Response, error)
+}
+
+// NewUserRequest 単一のユーザープロンプトからリクエストを作成
+func NewUserRequest(model string, maxTokens int, prompt string) *Request {
+	return &Request{
+		Model:     model,
+		MaxTokens: maxTokens,
+		Messages: []Message{
+			{Role: RoleUser, Content: prompt},
+		},
+		ResponseFormat: ResponseFormat{Type: ResponseFormatText},
+		Metadata:       map[string]string{},
+	}
+}
+
+// Label ログ出力用のラベルを取得
+func (r *Request) Label() string {
+	if r.Metadata == nil {
+		return "llm"
+	}
+	if label := r.Metadata["label"]; label != "" {
+		return label
+	}
+	return "llm"
+}
+
+// wantsJSON JSON出力が要求されているか
+func (r *Request) wantsJSON() bool {
+	return r.ResponseFormat.Type == ResponseFormatJSON
+}
+
+// jsonInstruction JSON出力を促すシステム指示を生成（ネイティブ対応のないプロバイダー用）
+func (r *Request) jsonInstruction() string {
+	instruction := "出力は有効なJSONオブジェクトのみとし、前後に説明文やコードフェンスを付けないでください。"
+	if len(r.ResponseFormat.Schema) > 0 {
+		instruction += "\n次のJSON Schemaに従ってください:\n" + string(r.ResponseFormat.Schema)
+	}
+	return instruction
+}
+
+// NewProviderFromEnv 環境変数に従ってプロバイダーを作成
+//
+// LLM_PROVIDER: anthropic（デフォルト）| openai | fake（offline が生成するオフライン応答）
+// LLM_FIXTURES_PATH: フィクスチャ（JSONL）のパス。設定時は LLM_FIXTURES_MODE に従ってラップする
+// LLM_FIXTURES_MODE: replay（デフォルト、記録済み応答を優先）| record（応答を記録）
+// offline は LLM_PROVIDER=fake の応答生成関数（nil の場合は EchoResponder）
+func NewProviderFromEnv(offline ResponderFunc) (Provider, error) {
+	provider, err := newBaseProviderFromEnv(offline)
+	if err != nil {
+		return nil, err
+	}
+
+	fixturesPath := os.Getenv("LLM_FIXTURES_PATH")
+	if fixturesPath == "" {
+		return provider, nil
+	}
+
+	store, err := LoadFixtureStore(fixturesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_FIXTURES_MODE")))
+	switch mode {
+	case "", "replay":
+		return NewReplayProvider(store, provider), nil
+	case "record":
+		return NewRecordingProvider(store, provider), nil
+	default:
+		return nil, fmt.Errorf("未対応のフィクスチャモードです: %s", mode)
+	}
+}
+
+// newBaseProviderFromEnv LLM_PROVIDER に対応するプロバイダーを作成
+func newBaseProviderFromEnv(offline ResponderFunc) (Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER")))
+	switch name {
+	case "", "anthropic":
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY環境変数が設定されていません")
+		}
+		return withResilience(NewAnthropicProvider(apiKey)), nil
+	case "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY環境変数が設定されていません")
+		}
+		return withResilience(NewOpenAIProvider(apiKey, os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_MODEL"))), nil
+	case "fake":
+		return NewFakeProvider(offline), nil
+	default:
+		return nil, fmt.Errorf("未対応のLLMプロバイダーです: %s", name)
+	}
+}
+
+// withResilience ネットワーク越しのプロバイダーに再試行ポリシーとサーキットブレーカーを適用
+func withResilience(provider Provider) Provider {
+	return NewResilientProvider(provider, RetryPolicyFromEnv(), NewCircuitBreakerFromEnv(provider.Name()))
+}
@@ -0,0 +1,407 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"yanwari-message-backend/services/retry"
+)
+
+// ErrCircuitOpen サーキットブレーカーが開いているため呼び出しを行わなかったことを示すエラー
+var ErrCircuitOpen = errors.New("AIプロバイダーが一時的に利用できません（サーキットブレーカー作動中）")
+
+// APIError プロバイダーがHTTPエラーステータスを返したことを示すエラー
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Retry-After ヘッダーの値（無い場合は0）
+}
+
+// Error エラーメッセージ
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API エラー: status %d, response: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Retryable 再試行で回復する可能性があるステータスか（429・5xx・529）
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newAPIError レスポンスから APIError を作成
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// isRetryable 再試行すべきエラーか判定
+// 呼び出し元のコンテキストが終了している場合は再試行しない
+// HTTPステータスを伴わないエラーは接続エラー・タイムアウトとして再試行する
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	return true
+}
+
+// RetryPolicy 再試行ポリシー（指数バックオフ＋ジッター。Retry-After がバックオフより長い場合はそれを優先する）
+type RetryPolicy = retry.Policy
+
+// DefaultRetryPolicy デフォルトの再試行ポリシー
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// RetryPolicyFromEnv 環境変数で上書きした再試行ポリシーを作成
+func RetryPolicyFromEnv() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = envInt("LLM_MAX_ATTEMPTS", policy.MaxAttempts)
+	policy.BaseDelay = envDuration("LLM_RETRY_BASE_DELAY", policy.BaseDelay)
+	policy.MaxDelay = envDuration("LLM_RETRY_MAX_DELAY", policy.MaxDelay)
+	return policy
+}
+
+// sleepContext コンテキストのキャンセルを考慮して待機
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BreakerState サーキットブレーカーの状態
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 通常状態
+	BreakerOpen     BreakerState = "open"      // 遮断中（即座に失敗を返す）
+	BreakerHalfOpen BreakerState = "half_open" // 試験的に1件だけ通す
+)
+
+// BreakerStatus サーキットブレーカーの状態スナップショット
+type BreakerStatus struct {
+	Name                string       `json:"name"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	FailureThreshold    int          `json:"failureThreshold"`
+	Cooldown            string       `json:"cooldown"`
+	OpenedAt            *time.Time   `json:"openedAt,omitempty"`
+	LastError           string       `json:"lastError,omitempty"`
+}
+
+// CircuitBreaker プロバイダーの連続失敗を検知して呼び出しを遮断するサーキットブレーカー
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	name             string
+	failureThreshold int
+	cooldown         time.Duration
+	state            BreakerState
+	failures         int
+	openedAt         time.Time
+	probing          bool
+	lastError        string
+}
+
+// NewCircuitBreaker サーキットブレーカーを作成
+// failureThreshold 回連続で失敗すると開き、cooldown 経過後に1件だけ試験的に通す
+func NewCircuitBreaker(name string, failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		state:            BreakerClosed,
+	}
+}
+
+// NewCircuitBreakerFromEnv 環境変数の設定でサーキットブレーカーを作成
+func NewCircuitBreakerFromEnv(name string) *CircuitBreaker {
+	return NewCircuitBreaker(name,
+		envInt("LLM_BREAKER_FAILURE_THRESHOLD", 5),
+		envDuration("LLM_BREAKER_COOLDOWN", 30*time.Second))
+}
+
+// Allow 呼び出しを許可するか判定（遮断中は ErrCircuitOpen）
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		fmt.Printf("[CircuitBreaker:%s] 半開状態に移行（試験呼び出し）\n", b.name)
+		return nil
+	case BreakerHalfOpen:
+		// 試験呼び出しの結果が出るまで他の呼び出しは遮断する
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// RecordSuccess 呼び出し成功を記録（ブレーカーを閉じる）
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		fmt.Printf("[CircuitBreaker:%s] 回復を確認、通常状態に戻ります\n", b.name)
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+	b.lastError = ""
+}
+
+// RecordFailure 呼び出し失敗を記録（閾値に達するか試験呼び出しが失敗すると開く）
+func (b *CircuitBreaker) RecordFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != BreakerOpen {
+			fmt.Printf("[CircuitBreaker:%s] 連続%d回の失敗により遮断します（%v）\n", b.name, b.failures, b.cooldown)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// releaseProbe 成否を判定しない結果（キャンセル等）で試験呼び出し枠を解放
+func (b *CircuitBreaker) releaseProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Status 現在の状態を取得
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.failureThreshold,
+		Cooldown:            b.cooldown.String(),
+		LastError:           b.lastError,
+	}
+	// 遮断中でもクールダウン経過後は次の呼び出しで半開になる
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		status.State = BreakerHalfOpen
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// BreakerReporter サーキットブレーカーの状態を公開するプロバイダー
+type BreakerReporter interface {
+	BreakerStatus() (BreakerStatus, bool)
+}
+
+// ProviderBreakerStatus プロバイダーのサーキットブレーカー状態を取得（ブレーカーが無い場合は false）
+func ProviderBreakerStatus(provider Provider) (BreakerStatus, bool) {
+	if reporter, ok := provider.(BreakerReporter); ok {
+		return reporter.BreakerStatus()
+	}
+	return BreakerStatus{}, false
+}
+
+// ResilientProvider 再試行ポリシーとサーキットブレーカーを適用するプロバイダー
+type ResilientProvider struct {
+	inner   Provider
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+}
+
+// NewResilientProvider 再試行・遮断付きプロバイダーを作成
+func NewResilientProvider(inner Provider, policy RetryPolicy, breaker *CircuitBreaker) *ResilientProvider {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	return &ResilientProvider{
+		inner:   inner,
+		policy:  policy,
+		breaker: breaker,
+	}
+}
+
+// Name プロバイダー名（キャッシュキー等に使うため下位プロバイダーの名前をそのまま返す）
+func (p *ResilientProvider) Name() string {
+	return p.inner.Name()
+}
+
+// BreakerStatus サーキットブレーカーの状態
+func (p *ResilientProvider) BreakerStatus() (BreakerStatus, bool) {
+	if p.breaker == nil {
+		return BreakerStatus{}, false
+	}
+	return p.breaker.Status(), true
+}
+
+// Complete 再試行ポリシーに従って補完を実行
+func (p *ResilientProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	return p.do(ctx, req, func() (*Response, error) {
+		return p.inner.Complete(ctx, req)
+	})
+}
+
+// Stream 再試行ポリシーに従ってストリーミング補完を実行
+// 断片を1つでも送信した後の失敗は、重複送信を避けるため再試行しない
+func (p *ResilientProvider) Stream(ctx context.Context, req *Request, onDelta DeltaFunc) (*Response, error) {
+	started := false
+	var wrapped DeltaFunc
+	if onDelta != nil {
+		wrapped = func(delta string) {
+			started = true
+			onDelta(delta)
+		}
+	}
+
+	return p.do(ctx, req, func() (*Response, error) {
+		resp, err := CompleteStream(ctx, p.inner, req, wrapped)
+		if err != nil && started {
+			return nil, &nonRetryableError{err: err}
+		}
+		return resp, err
+	})
+}
+
+// nonRetryableError 再試行してはならないエラー
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string { return e.err.Error() }
+func (e *nonRetryableError) Unwrap() error { return e.err }
+
+// do サーキットブレーカーを確認しながら call を再試行
+func (p *ResilientProvider) do(ctx context.Context, req *Request, call func() (*Response, error)) (*Response, error) {
+	label := req.Label()
+	var lastErr error
+
+	for attempt := 1; attempt <= p.policy.MaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if p.breaker != nil {
+			if err := p.breaker.Allow(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := call()
+		if err == nil {
+			if p.breaker != nil {
+				p.breaker.RecordSuccess()
+			}
+			return resp, nil
+		}
+		lastErr = err
+
+		var nre *nonRetryableError
+		retryable := isRetryable(ctx, err) && !errors.As(err, &nre)
+
+		// 障害とみなせる失敗（再試行対象）のみブレーカーに記録する
+		if p.breaker != nil {
+			if retryable {
+				p.breaker.RecordFailure(err)
+			} else {
+				p.breaker.releaseProbe()
+			}
+		}
+
+		if !retryable {
+			return nil, err
+		}
+		if attempt == p.policy.MaxAttempts {
+			break
+		}
+
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+		wait := p.policy.Backoff(attempt, retryAfter)
+		fmt.Printf("[%s] 試行 %d/%d 失敗: %v（%v後にリトライ）\n", label, attempt, p.policy.MaxAttempts, err, wait)
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("API呼び出しに失敗（%d回試行後）: %w", p.policy.MaxAttempts, lastErr)
+}
+
+// envInt 環境変数から整数値を取得（未設定・不正な値の場合はデフォルト値）
+func envInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("警告: %s の値が不正です (%s)。デフォルト値 %d を使用します\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// envDuration 環境変数から時間間隔を取得（未設定・不正な値の場合はデフォルト値）
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("警告: %s の値が不正です (%s)。デフォルト値 %v を使用します\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DeltaFunc ストリーミング中に生成されたテキスト断片を受け取るコールバック
+type DeltaFunc func(delta string)
+
+// StreamingProvider トークン単位のストリーミングに対応したプロバイダー
+type StreamingProvider interface {
+	Provider
+	// Stream 補完を実行し、生成されたテキスト断片を onDelta に逐次渡す
+	// 戻り値の Response.Text には全文が入る
+	Stream(ctx context.Context, req *Request, onDelta DeltaFunc) (*Response, error)
+}
+
+// CompleteStream プロバイダーがストリーミング対応なら Stream を、非対応なら Complete を呼び出す
+// 非対応の場合は全文を1つの断片として onDelta に渡す
+func CompleteStream(ctx context.Context, provider Provider, req *Request, onDelta DeltaFunc) (*Response, error) {
+	if sp, ok := provider.(StreamingProvider); ok {
+		return sp.Stream(ctx, req, onDelta)
+	}
+
+	resp, err := provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil && resp.Text != "" {
+		onDelta(resp.Text)
+	}
+	return resp, nil
+}
+
+// sseEvent Server-Sent Events の1イベント
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE SSEストリームを読み取り、イベントごとに handle を呼び出す
+// handle が false を返した時点で読み取りを終了する
+func readSSE(r io.Reader, handle func(ev sseEvent) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var current sseEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 && current.Event == "" {
+				continue
+			}
+			current.Data = strings.Join(data, "\n")
+			cont, err := handle(current)
+			if err != nil {
+				return err
+			}
+			if !cont {
+				return nil
+			}
+			current = sseEvent{}
+			data = nil
+		case strings.HasPrefix(line, ":"):
+			// コメント行（keep-alive）
+		case strings.HasPrefix(line, "event:"):
+			current.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// Stream フェイク応答を数文字ずつの断片に分けて返す
+func (p *FakeProvider) Stream(ctx context.Context, req *Request, onDelta DeltaFunc) (*Response, error) {
+	resp, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta == nil {
+		return resp, nil
+	}
+
+	const chunkRunes = 8
+	text := resp.Text
+	for len(text) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := 0
+		for i := 0; i < chunkRunes && end < len(text); i++ {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+		}
+		onDelta(text[:end])
+		text = text[end:]
+	}
+	return resp, nil
+}
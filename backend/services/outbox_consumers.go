@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"yanwari-message-backend/models"
+)
+
+// ScheduleSyncConsumer メッセージの状態遷移をスケジュールのステータスに反映する
+type ScheduleSyncConsumer struct {
+	scheduleService *models.ScheduleService
+}
+
+// NewScheduleSyncConsumer スケジュール同期の購読者を作成
+func NewScheduleSyncConsumer(scheduleService *models.ScheduleService) *ScheduleSyncConsumer {
+	return &ScheduleSyncConsumer{scheduleService: scheduleService}
+}
+
+// Name 購読者名
+func (c *ScheduleSyncConsumer) Name() string {
+	return "schedule_sync"
+}
+
+// Handle 配信完了は sent、再試行待ちは再試行回数、配信失敗は failed、手動再試行は pending に更新
+// イベントは順不同に届くことがあるため、発生日時がスケジュールに反映済みのイベントより古い場合は反映しない
+func (c *ScheduleSyncConsumer) Handle(ctx context.Context, event *models.OutboxEvent) error {
+	msg := event.Message
+	switch event.Type {
+	case models.OutboxMessageDelivered:
+		return c.scheduleService.MarkAsSentByMessageID(ctx, msg.MessageID, event.OccurredAt)
+	case models.OutboxMessageRetryScheduled:
+		nextAttemptAt := time.Now()
+		if msg.NextAttemptAt != nil {
+			nextAttemptAt = *msg.NextAttemptAt
+		}
+		return c.scheduleService.RecordRetryByMessageID(ctx, msg.MessageID, msg.Reason, msg.Attempts, nextAttemptAt, event.OccurredAt)
+	case models.OutboxMessageFailed:
+		return c.scheduleService.MarkAsFailedByMessageID(ctx, msg.MessageID, msg.Reason, msg.Attempts, event.OccurredAt)
+	case models.OutboxMessageRetried:
+		return c.scheduleService.ResetForRetryByMessageID(ctx, msg.MessageID, event.OccurredAt)
+	}
+	return nil
+}
+
+// SenderNotificationConsumer 送信者に配信完了・配信失敗をアプリ内通知で知らせる
+type SenderNotificationConsumer struct {
+	notificationService *models.NotificationService
+}
+
+// NewSenderNotificationConsumer 送信者通知の購読者を作成
+func NewSenderNotificationConsumer(notificationService *models.NotificationService) *SenderNotificationConsumer {
+	return &SenderNotificationConsumer{notificationService: notificationService}
+}
+
+// Name 購読者名
+func (c *SenderNotificationConsumer) Name() string {
+	return "sender_notification"
+}
+
+// Handle 配信完了・配信失敗の通知を送信者に作成する（再試行待ち・手動再試行は通知しない）
+// 通知はイベントIDで重複を防ぐため、同じイベントを再処理しても通知は1件になる
+func (c *SenderNotificationConsumer) Handle(ctx context.Context, event *models.OutboxEvent) error {
+	notification := &models.Notification{
+		UserID:      event.Message.SenderID,
+		MessageID:   event.Message.MessageID,
+		RecipientID: event.Message.RecipientID,
+		EventID:     event.ID,
+		CreatedAt:   event.OccurredAt,
+	}
+	switch event.Type {
+	case models.OutboxMessageDelivered:
+		notification.Type = models.NotificationMessageDelivered
+	case models.OutboxMessageFailed:
+		notification.Type = models.NotificationMessageFailed
+		notification.Reason = event.Message.Reason
+	default:
+		return nil
+	}
+
+	if err := c.notificationService.CreateNotification(ctx, notification); err != nil {
+		return fmt.Errorf("送信者への通知の作成エラー: %w", err)
+	}
+	log.Printf("📬 送信者通知: 送信者=%s, 種類=%s, メッセージ=%s", event.Message.SenderID.Hex(), notification.Type, event.Message.MessageID.Hex())
+	return nil
+}
+
+// StatusWebhookPayload 送信者の Webhook に送る配信状況
+type StatusWebhookPayload struct {
+	Event      models.OutboxEventType `json:"event"` // message.delivered / message.failed
+	EventID    string                 `json:"eventId"`
+	Message    models.MessageEvent    `json:"message"`
+	OccurredAt time.Time              `json:"occurredAt"`
+}
+
+// StatusWebhookConsumer 送信者が Webhook のURLを設定している場合、送信したメッセージの配信完了・配信失敗を POST する
+type StatusWebhookConsumer struct {
+	settingsService *models.UserSettingsService
+	webhook         *WebhookChannel
+}
+
+// NewStatusWebhookConsumer 配信状況の Webhook の購読者を作成
+func NewStatusWebhookConsumer(settingsService *models.UserSettingsService, webhook *WebhookChannel) *StatusWebhookConsumer {
+	return &StatusWebhookConsumer{
+		settingsService: settingsService,
+		webhook:         webhook,
+	}
+}
+
+// Name 購読者名
+func (c *StatusWebhookConsumer) Name() string {
+	return "status_webhook"
+}
+
+// Handle 送信者の Webhook を呼び出す（一時的な失敗のみエラーを返して再試行する）
+// イベントIDを Idempotency-Key にするため、再試行で同じイベントを受け取っても受信側で重複を判別できる
+func (c *StatusWebhookConsumer) Handle(ctx context.Context, event *models.OutboxEvent) error {
+	if event.Type != models.OutboxMessageDelivered && event.Type != models.OutboxMessageFailed {
+		return nil
+	}
+
+	settings, err := c.settingsService.GetSettings(ctx, event.Message.SenderID)
+	if err != nil {
+		return fmt.Errorf("送信者の設定の取得エラー: %w", err)
+	}
+	if settings.WebhookURL == "" {
+		return nil
+	}
+
+	payload := StatusWebhookPayload{
+		Event:      event.Type,
+		EventID:    event.ID.Hex(),
+		Message:    event.Message,
+		OccurredAt: event.OccurredAt,
+	}
+	result := c.webhook.Post(ctx, settings.WebhookURL, event.ID.Hex(), payload)
+	switch result.Status {
+	case DeliveryRetryable:
+		return result.Err
+	case DeliveryPermanent:
+		log.Printf("💀 配信状況の Webhook が失敗しました（再試行しません）: イベント=%s, エラー=%v", event.ID.Hex(), result.Err)
+	}
+	return nil
+}
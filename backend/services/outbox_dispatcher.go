@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yanwari-message-backend/models"
+)
+
+// outbox ディスパッチャーの既定値
+const (
+	// defaultOutboxLease 確保したイベントのリース期間（この間に処理を終えられなければ他のディスパッチャーが取り直す）
+	defaultOutboxLease = 1 * time.Minute
+	// defaultOutboxBatchSize 1回のチェックで処理するイベントの最大件数
+	defaultOutboxBatchSize = 100
+)
+
+// OutboxConsumer outbox イベントの購読者（通知・スケジュール同期・Webhook など）
+// 同じイベントを2回以上受け取る可能性があるため、処理は冪等にする
+type OutboxConsumer interface {
+	// Name 購読者名（イベントの処理済みの記録に使う）
+	Name() string
+	// Handle イベントを処理（エラーを返すとイベントごと再試行する。処理済みの購読者には再配信しない）
+	Handle(ctx context.Context, event *models.OutboxEvent) error
+}
+
+// OutboxDispatcher outbox イベントを購読者に配信する
+// イベントを確保（リース）してから処理するため、複数のインスタンスで動かしても同じイベントを同時に処理しない
+type OutboxDispatcher struct {
+	outbox      *models.OutboxService
+	consumers   []OutboxConsumer
+	workerID    string
+	lease       time.Duration
+	batchSize   int
+	retryPolicy DeliveryRetryPolicy // 購読者の処理に失敗した場合の再試行ポリシー
+	ticker      *time.Ticker
+	done        chan bool
+}
+
+// NewOutboxDispatcher outbox ディスパッチャーを作成
+func NewOutboxDispatcher(outbox *models.OutboxService, workerID string, consumers ...OutboxConsumer) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		outbox:    outbox,
+		consumers: consumers,
+		workerID:  workerID,
+		lease:     defaultOutboxLease,
+		batchSize: defaultOutboxBatchSize,
+		retryPolicy: DeliveryRetryPolicy{
+			MaxAttempts: 10,
+			BaseDelay:   5 * time.Second,
+			MaxDelay:    10 * time.Minute,
+			Jitter:      0.2,
+		},
+		done: make(chan bool),
+	}
+}
+
+// Start バックグラウンドでイベントの配信を開始
+func (d *OutboxDispatcher) Start(interval time.Duration) {
+	log.Printf("outbox ディスパッチャーを開始しました（間隔: %v, ワーカー: %s）", interval, d.workerID)
+
+	d.ticker = time.NewTicker(interval)
+
+	go func() {
+		for {
+			select {
+			case <-d.ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				if _, err := d.DispatchPending(ctx); err != nil {
+					log.Printf("❌ outbox イベントの配信エラー: %v", err)
+				}
+				cancel()
+			case <-d.done:
+				d.ticker.Stop()
+				log.Println("outbox ディスパッチャーを停止しました")
+				return
+			}
+		}
+	}()
+}
+
+// Stop バックグラウンドでのイベントの配信を停止
+func (d *OutboxDispatcher) Stop() {
+	if d.ticker != nil {
+		d.done <- true
+	}
+}
+
+// DispatchPending 未処理のイベントを確保して購読者に配信し、全ての購読者が処理したイベントの件数を返す
+func (d *OutboxDispatcher) DispatchPending(ctx context.Context) (int, error) {
+	published := 0
+	for i := 0; i < d.batchSize; i++ {
+		event, err := d.outbox.ClaimPendingEvent(ctx, d.workerID, d.lease)
+		if err != nil {
+			return published, err
+		}
+		if event == nil {
+			break
+		}
+		if d.dispatch(ctx, event) {
+			published++
+		}
+	}
+	if published > 0 {
+		log.Printf("📮 outbox イベントを配信しました: %d件", published)
+	}
+	return published, nil
+}
+
+// dispatch 確保したイベントを未処理の購読者に配信する（全ての購読者が処理した場合は true）
+func (d *OutboxDispatcher) dispatch(ctx context.Context, event *models.OutboxEvent) bool {
+	completed := make(map[string]bool, len(event.Completed))
+	for _, name := range event.Completed {
+		completed[name] = true
+	}
+
+	var failures []string
+	for _, consumer := range d.consumers {
+		name := consumer.Name()
+		if completed[name] {
+			continue
+		}
+		if err := consumer.Handle(ctx, event); err != nil {
+			log.Printf("⚠️ outbox 購読者の処理エラー: イベント=%s (%s), 購読者=%s, エラー=%v", event.ID.Hex(), event.Type, name, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if err := d.outbox.MarkConsumerCompleted(ctx, event.ID, d.workerID, name); err != nil {
+			log.Printf("outbox 処理済みの記録エラー: イベント=%s, 購読者=%s, エラー=%v", event.ID.Hex(), name, err)
+		}
+	}
+
+	if len(failures) == 0 {
+		if err := d.outbox.MarkPublished(ctx, event.ID, d.workerID); err != nil {
+			log.Printf("outbox ステータス更新エラー: イベント=%s, エラー=%v", event.ID.Hex(), err)
+			return false
+		}
+		return true
+	}
+
+	reason := strings.Join(failures, "; ")
+	attempts := event.Attempts + 1
+	if d.retryPolicy.Exhausted(attempts) {
+		log.Printf("💀 outbox イベントの再試行の上限に達しました: イベント=%s, 試行=%d回", event.ID.Hex(), attempts)
+		if err := d.outbox.MarkFailed(ctx, event.ID, d.workerID, reason); err != nil {
+			log.Printf("outbox ステータス更新エラー: イベント=%s, エラー=%v", event.ID.Hex(), err)
+		}
+		return false
+	}
+	nextAttemptAt := time.Now().Add(d.retryPolicy.Backoff(attempts, 0))
+	if err := d.outbox.ScheduleRetry(ctx, event.ID, d.workerID, nextAttemptAt, reason); err != nil {
+		log.Printf("outbox 再試行の記録エラー: イベント=%s, エラー=%v", event.ID.Hex(), err)
+	}
+	return false
+}
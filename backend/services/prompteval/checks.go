@@ -0,0 +1,213 @@
+package prompteval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/services/toneoutput"
+)
+
+// Checks 出力に適用するチェックの設定（0・未指定の項目はチェックしない）
+type Checks struct {
+	MinLength        int      `yaml:"min_length,omitempty" json:"min_length,omitempty"`
+	MaxLength        int      `yaml:"max_length,omitempty" json:"max_length,omitempty"`
+	MaxLengthRatio   float64  `yaml:"max_length_ratio,omitempty" json:"max_length_ratio,omitempty"` // 入力の文字数に対する上限の倍率
+	ForbiddenPhrases []string `yaml:"forbidden_phrases,omitempty" json:"forbidden_phrases,omitempty"`
+	MaxEmoji         *int     `yaml:"max_emoji,omitempty" json:"max_emoji,omitempty"`
+	PreserveEntities *bool    `yaml:"preserve_entities,omitempty" json:"preserve_entities,omitempty"` // 入力の日付・数値が出力に残っているか
+}
+
+// defaultChecks データセットで指定が無い場合のチェック
+func defaultChecks() Checks {
+	preserve := true
+	return Checks{MinLength: 1, PreserveEntities: &preserve}
+}
+
+// merge override で指定された項目を上書きした設定を返す（禁止語句は追加）
+func (c Checks) merge(override Checks) Checks {
+	if override.MinLength > 0 {
+		c.MinLength = override.MinLength
+	}
+	if override.MaxLength > 0 {
+		c.MaxLength = override.MaxLength
+	}
+	if override.MaxLengthRatio > 0 {
+		c.MaxLengthRatio = override.MaxLengthRatio
+	}
+	if len(override.ForbiddenPhrases) > 0 {
+		c.ForbiddenPhrases = append(append([]string{}, c.ForbiddenPhrases...), override.ForbiddenPhrases...)
+	}
+	if override.MaxEmoji != nil {
+		c.MaxEmoji = override.MaxEmoji
+	}
+	if override.PreserveEntities != nil {
+		c.PreserveEntities = override.PreserveEntities
+	}
+	return c
+}
+
+// チェック名（レポートの集計キー）
+const (
+	CheckLength       = "length"
+	CheckForbidden    = "forbidden_phrases"
+	CheckEmoji        = "emoji_count"
+	CheckEntities     = "entities_preserved"
+	CheckThinkingLeak = "no_thinking_leak"
+	CheckConstraints  = "tone_constraints"
+)
+
+// CheckResult チェック1件の結果
+type CheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// thinkingTagPattern 思考過程のタグ（<thinking> / </thinking>、大文字小文字を区別しない）
+var thinkingTagPattern = regexp.MustCompile(`(?i)</?\s*thinking\b[^>]*>`)
+
+// runChecks 出力にチェックを適用する
+func runChecks(checks Checks, c Case, output string) []CheckResult {
+	var results []CheckResult
+	length := len([]rune(strings.TrimSpace(output)))
+
+	// 文字数
+	maxLength := checks.MaxLength
+	if checks.MaxLengthRatio > 0 {
+		ratioLimit := int(float64(len([]rune(c.Input))) * checks.MaxLengthRatio)
+		if maxLength == 0 || ratioLimit < maxLength {
+			maxLength = ratioLimit
+		}
+	}
+	lengthResult := CheckResult{Name: CheckLength, Passed: true}
+	switch {
+	case length < checks.MinLength:
+		lengthResult = CheckResult{CheckLength, false, fmt.Sprintf("%d文字（下限 %d）", length, checks.MinLength)}
+	case maxLength > 0 && length > maxLength:
+		lengthResult = CheckResult{CheckLength, false, fmt.Sprintf("%d文字（上限 %d）", length, maxLength)}
+	}
+	results = append(results, lengthResult)
+
+	// 禁止語句
+	if len(checks.ForbiddenPhrases) > 0 {
+		var found []string
+		for _, phrase := range checks.ForbiddenPhrases {
+			if phrase != "" && strings.Contains(output, phrase) {
+				found = append(found, phrase)
+			}
+		}
+		result := CheckResult{Name: CheckForbidden, Passed: len(found) == 0}
+		if len(found) > 0 {
+			result.Detail = "含まれている語句: " + strings.Join(found, ", ")
+		}
+		results = append(results, result)
+	}
+
+	// 絵文字の数
+	if checks.MaxEmoji != nil {
+		count := countEmoji(output)
+		result := CheckResult{Name: CheckEmoji, Passed: count <= *checks.MaxEmoji}
+		if !result.Passed {
+			result.Detail = fmt.Sprintf("%d個（上限 %d）", count, *checks.MaxEmoji)
+		}
+		results = append(results, result)
+	}
+
+	// 日付・数値・指定語句が残っているか
+	if checks.PreserveEntities != nil && *checks.PreserveEntities || len(c.Entities) > 0 {
+		var entities []string
+		if checks.PreserveEntities != nil && *checks.PreserveEntities {
+			entities = extractEntities(c.Input)
+		}
+		entities = append(entities, c.Entities...)
+
+		normalizedOutput := normalizeText(output)
+		var missing []string
+		for _, entity := range entities {
+			if !strings.Contains(normalizedOutput, normalizeText(entity)) {
+				missing = append(missing, entity)
+			}
+		}
+		result := CheckResult{Name: CheckEntities, Passed: len(missing) == 0}
+		if len(missing) > 0 {
+			result.Detail = "失われた語句: " + strings.Join(missing, ", ")
+		}
+		results = append(results, result)
+	}
+
+	// 思考過程の漏れ
+	thinking := CheckResult{Name: CheckThinkingLeak, Passed: !thinkingTagPattern.MatchString(output)}
+	if !thinking.Passed {
+		thinking.Detail = "<thinking> タグが出力に含まれています"
+	}
+	results = append(results, thinking)
+
+	return results
+}
+
+// constraintCheck トーン設定の制約（constraints / output_constraints）のチェック
+func constraintCheck(constraints config.OutputConstraints, output string) CheckResult {
+	violations := toneoutput.Validate(output, constraints)
+	return CheckResult{Name: CheckConstraints, Passed: len(violations) == 0, Detail: strings.Join(violations, ", ")}
+}
+
+// entityPatterns 入力から抽出する日付・時刻・数値のパターン（normalizeText 後の文字列に適用）
+var entityPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\d{1,4}年\d{1,2}月\d{1,2}日|\d{1,2}月\d{1,2}日|\d{1,2}月|\d{1,2}日`),
+	regexp.MustCompile(`\d{1,4}/\d{1,2}(?:/\d{1,2})?`),
+	regexp.MustCompile(`\d{1,2}:\d{2}|\d{1,2}時(?:\d{1,2}分|半)?`),
+	regexp.MustCompile(`\d+(?:[.,]\d+)*`),
+}
+
+// extractEntities 入力から保持すべき日付・時刻・数値を抽出
+// 長いパターンを優先し、抽出済みの範囲に含まれる短い一致は除く
+func extractEntities(input string) []string {
+	text := normalizeText(input)
+	covered := make([]bool, len(text))
+
+	var entities []string
+	for _, pattern := range entityPatterns {
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			if covered[loc[0]] {
+				continue
+			}
+			for i := loc[0]; i < loc[1]; i++ {
+				covered[i] = true
+			}
+			entities = append(entities, text[loc[0]:loc[1]])
+		}
+	}
+	return entities
+}
+
+// normalizeText 全角の数字・記号を半角にそろえる（出力で表記が変わっても同じ値として扱う）
+func normalizeText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return r - '０' + '0'
+		case r == '：':
+			return ':'
+		case r == '／':
+			return '/'
+		case r == '．':
+			return '.'
+		case r == '，':
+			return ','
+		}
+		return r
+	}, text)
+}
+
+// countEmoji 絵文字の数を数える（主要な絵文字・記号ブロック）
+func countEmoji(text string) int {
+	count := 0
+	for _, r := range text {
+		if (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+// Package prompteval トーン変換プロンプトのオフライン評価（ゴールデンデータセットによる回帰チェック）
+package prompteval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Case 評価対象の入力メッセージ1件
+type Case struct {
+	ID    string   `yaml:"id" json:"id"`
+	Input string   `yaml:"input" json:"input"`
+	Tones []string `yaml:"tones,omitempty" json:"tones,omitempty"` // 省略時は設定ファイルの全トーン
+	// Entities 出力に残るべき語句（日付・数値は自動で抽出されるため、それ以外の固有名詞などを指定する）
+	Entities []string `yaml:"entities,omitempty" json:"entities,omitempty"`
+	// Checks このケースだけに適用するチェックの上書き
+	Checks *Checks `yaml:"checks,omitempty" json:"checks,omitempty"`
+}
+
+// Dataset 評価用データセット
+//
+// YAML 形式ではデータセット全体・トーン別のチェックとケース一覧を記述する。
+// JSONL 形式では1行に1ケースを記述し、チェックはデフォルト値を使う
+type Dataset struct {
+	Name       string            `yaml:"name"`
+	Checks     Checks            `yaml:"checks"`      // 全ケース共通のチェック
+	ToneChecks map[string]Checks `yaml:"tone_checks"` // トーン別のチェックの上書き
+	Cases      []Case            `yaml:"cases"`
+}
+
+// LoadDataset YAML（.yaml/.yml）または JSONL（.jsonl）のデータセットを読み込む
+func LoadDataset(path string) (*Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("データセットの読み込みに失敗 (%s): %w", path, err)
+	}
+
+	var dataset Dataset
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var c Case
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				return nil, fmt.Errorf("データセットの解析に失敗 (%s:%d): %w", path, line, err)
+			}
+			dataset.Cases = append(dataset.Cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &dataset); err != nil {
+			return nil, fmt.Errorf("データセットの解析に失敗 (%s): %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("未対応のデータセット形式です: %s", path)
+	}
+
+	if dataset.Name == "" {
+		dataset.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for i := range dataset.Cases {
+		c := &dataset.Cases[i]
+		if strings.TrimSpace(c.Input) == "" {
+			return nil, fmt.Errorf("%d件目のケースの input が空です", i+1)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("case-%03d", i+1)
+		}
+	}
+	if len(dataset.Cases) == 0 {
+		return nil, fmt.Errorf("データセットにケースがありません: %s", path)
+	}
+
+	return &dataset, nil
+}
+
+// checksFor ケースとトーンに適用するチェック（共通 → トーン別 → ケース別の順に上書き）
+func (d *Dataset) checksFor(c Case, tone string) Checks {
+	checks := defaultChecks().merge(d.Checks)
+	if toneChecks, ok := d.ToneChecks[tone]; ok {
+		checks = checks.merge(toneChecks)
+	}
+	if c.Checks != nil {
+		checks = checks.merge(*c.Checks)
+	}
+	return checks
+}
@@ -0,0 +1,212 @@
+package prompteval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CaseDiff ケース×トーン1件のベースラインと候補の比較
+type CaseDiff struct {
+	CaseID          string   `json:"caseId"`
+	Tone            string   `json:"tone"`
+	Input           string   `json:"input"`
+	BaselineOutput  string   `json:"baselineOutput"`
+	CandidateOutput string   `json:"candidateOutput"`
+	BaselinePassed  bool     `json:"baselinePassed"`
+	CandidatePassed bool     `json:"candidatePassed"`
+	BaselineFailed  []string `json:"baselineFailed,omitempty"`
+	CandidateFailed []string `json:"candidateFailed,omitempty"`
+}
+
+// Comparison 2つのトーン設定の評価結果の比較
+type Comparison struct {
+	Baseline    *RunResult `json:"baseline"`
+	Candidate   *RunResult `json:"candidate"`
+	Regressions []CaseDiff `json:"regressions"` // ベースラインで合格・候補で不合格
+	Fixes       []CaseDiff `json:"fixes"`       // ベースラインで不合格・候補で合格
+	Changed     []CaseDiff `json:"changed"`     // 合否は同じで出力が変わったもの
+	Unmatched   []string   `json:"unmatched"`   // 片方にしか無いケース×トーン
+}
+
+// Compare ケースIDとトーンで結果を突き合わせる
+func Compare(baseline, candidate *RunResult) *Comparison {
+	comparison := &Comparison{Baseline: baseline, Candidate: candidate}
+
+	key := func(r Result) string { return r.CaseID + "\x00" + r.Tone }
+	baselineResults := make(map[string]Result, len(baseline.Results))
+	for _, result := range baseline.Results {
+		baselineResults[key(result)] = result
+	}
+
+	seen := make(map[string]bool, len(candidate.Results))
+	for _, after := range candidate.Results {
+		seen[key(after)] = true
+		before, ok := baselineResults[key(after)]
+		if !ok {
+			comparison.Unmatched = append(comparison.Unmatched, fmt.Sprintf("%s/%s（候補のみ）", after.CaseID, after.Tone))
+			continue
+		}
+
+		diff := CaseDiff{
+			CaseID:          after.CaseID,
+			Tone:            after.Tone,
+			Input:           after.Input,
+			BaselineOutput:  before.Output,
+			CandidateOutput: after.Output,
+			BaselinePassed:  before.Passed,
+			CandidatePassed: after.Passed,
+			BaselineFailed:  before.FailedChecks(),
+			CandidateFailed: after.FailedChecks(),
+		}
+		switch {
+		case before.Passed && !after.Passed:
+			comparison.Regressions = append(comparison.Regressions, diff)
+		case !before.Passed && after.Passed:
+			comparison.Fixes = append(comparison.Fixes, diff)
+		case before.Output != after.Output:
+			comparison.Changed = append(comparison.Changed, diff)
+		}
+	}
+	for _, before := range baseline.Results {
+		if !seen[key(before)] {
+			comparison.Unmatched = append(comparison.Unmatched, fmt.Sprintf("%s/%s（ベースラインのみ）", before.CaseID, before.Tone))
+		}
+	}
+	sort.Strings(comparison.Unmatched)
+
+	return comparison
+}
+
+// WriteRunMarkdown 1つのトーン設定の評価結果を Markdown で出力
+func WriteRunMarkdown(w io.Writer, run *RunResult) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# プロンプト評価レポート\n\n")
+	fmt.Fprintf(&b, "- 設定: `%s`\n- プロバイダー: %s\n- データセット: %s\n- 実行日時: %s（%s）\n\n",
+		run.Target, run.Provider, run.Dataset, run.StartedAt.Format("2006-01-02 15:04:05"), run.Duration.Round(time.Millisecond))
+
+	b.WriteString("## トーン別の結果\n\n")
+	b.WriteString("| トーン | 合格 | 件数 | 合格率 | 失敗したチェック |\n|---|---|---|---|---|\n")
+	for _, summary := range run.Summary() {
+		fmt.Fprintf(&b, "| %s | %d | %d | %.1f%% | %s |\n",
+			summary.Tone, summary.Passed, summary.Total, summary.PassRate()*100, formatFailures(summary.Failures))
+	}
+
+	if run.FailedCount() > 0 {
+		b.WriteString("\n## 不合格のケース\n\n")
+		for _, result := range run.Results {
+			if result.Passed {
+				continue
+			}
+			fmt.Fprintf(&b, "### %s / %s\n\n", result.CaseID, result.Tone)
+			writeResultDetail(&b, result)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteComparisonMarkdown ベースラインと候補の比較を Markdown で出力
+func WriteComparisonMarkdown(w io.Writer, comparison *Comparison) error {
+	baseline, candidate := comparison.Baseline, comparison.Candidate
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# プロンプト評価 比較レポート\n\n")
+	fmt.Fprintf(&b, "- ベースライン: `%s`\n- 候補: `%s`\n- プロバイダー: %s\n- データセット: %s\n- 実行日時: %s\n\n",
+		baseline.Target, candidate.Target, candidate.Provider, candidate.Dataset, candidate.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "回帰 **%d件** / 改善 **%d件** / 出力のみ変化 %d件\n\n",
+		len(comparison.Regressions), len(comparison.Fixes), len(comparison.Changed))
+
+	b.WriteString("## トーン別の合格率\n\n")
+	b.WriteString("| トーン | ベースライン | 候補 | 差 | 候補で失敗したチェック |\n|---|---|---|---|---|\n")
+	before := make(map[string]ToneSummary)
+	for _, summary := range baseline.Summary() {
+		before[summary.Tone] = summary
+	}
+	for _, after := range candidate.Summary() {
+		prev := before[after.Tone]
+		fmt.Fprintf(&b, "| %s | %.1f%% (%d/%d) | %.1f%% (%d/%d) | %+.1f pt | %s |\n",
+			after.Tone,
+			prev.PassRate()*100, prev.Passed, prev.Total,
+			after.PassRate()*100, after.Passed, after.Total,
+			(after.PassRate()-prev.PassRate())*100,
+			formatFailures(after.Failures))
+	}
+
+	writeDiffs := func(title string, diffs []CaseDiff) {
+		if len(diffs) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", title)
+		for _, diff := range diffs {
+			fmt.Fprintf(&b, "### %s / %s\n\n", diff.CaseID, diff.Tone)
+			fmt.Fprintf(&b, "- 入力: %s\n", quoteLine(diff.Input))
+			fmt.Fprintf(&b, "- ベースライン%s: %s\n", passLabel(diff.BaselinePassed, diff.BaselineFailed), quoteLine(diff.BaselineOutput))
+			fmt.Fprintf(&b, "- 候補%s: %s\n\n", passLabel(diff.CandidatePassed, diff.CandidateFailed), quoteLine(diff.CandidateOutput))
+		}
+	}
+	writeDiffs("回帰（ベースラインで合格 → 候補で不合格）", comparison.Regressions)
+	writeDiffs("改善（ベースラインで不合格 → 候補で合格）", comparison.Fixes)
+	writeDiffs("出力のみ変化", comparison.Changed)
+
+	if len(comparison.Unmatched) > 0 {
+		b.WriteString("\n## 突き合わせできなかったケース\n\n")
+		for _, unmatched := range comparison.Unmatched {
+			fmt.Fprintf(&b, "- %s\n", unmatched)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeResultDetail 不合格の結果の詳細
+func writeResultDetail(b *strings.Builder, result Result) {
+	fmt.Fprintf(b, "- 入力: %s\n", quoteLine(result.Input))
+	if result.Error != "" {
+		fmt.Fprintf(b, "- エラー: %s\n\n", result.Error)
+		return
+	}
+	fmt.Fprintf(b, "- 出力: %s\n", quoteLine(result.Output))
+	for _, check := range result.Checks {
+		if !check.Passed {
+			fmt.Fprintf(b, "- ❌ %s: %s\n", check.Name, check.Detail)
+		}
+	}
+	b.WriteString("\n")
+}
+
+// formatFailures チェック名ごとの失敗数を "name×n" 形式で並べる
+func formatFailures(failures map[string]int) string {
+	if len(failures) == 0 {
+		return "-"
+	}
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s×%d", name, failures[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// passLabel 合否の表示
+func passLabel(passed bool, failed []string) string {
+	if passed {
+		return "（✅）"
+	}
+	return "（❌ " + strings.Join(failed, ", ") + "）"
+}
+
+// quoteLine 改行を含むテキストを1行のコード表記にする
+func quoteLine(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", "⏎")
+	return "`" + strings.ReplaceAll(text, "`", "'") + "`"
+}
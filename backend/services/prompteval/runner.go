@@ -0,0 +1,230 @@
+package prompteval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yanwari-message-backend/config"
+	"yanwari-message-backend/services/llm"
+	"yanwari-message-backend/services/toneoutput"
+)
+
+// Target 評価するトーン設定
+type Target struct {
+	Name   string // レポートに表示する名前（ファイルパスや "v3" など）
+	Config *config.ToneConfig
+}
+
+// Result ケース×トーン1件の評価結果
+type Result struct {
+	CaseID        string        `json:"caseId"`
+	Tone          string        `json:"tone"`
+	Input         string        `json:"input"`
+	Output        string        `json:"output"`
+	Model         string        `json:"model,omitempty"`
+	PromptVersion string        `json:"promptVersion,omitempty"`
+	Usage         llm.Usage     `json:"usage"`
+	Error         string        `json:"error,omitempty"`
+	Checks        []CheckResult `json:"checks,omitempty"`
+	Passed        bool          `json:"passed"`
+}
+
+// FailedChecks 失敗したチェック名の一覧
+func (r Result) FailedChecks() []string {
+	var failed []string
+	if r.Error != "" {
+		failed = append(failed, "error")
+	}
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+// RunResult 1つのトーン設定に対する評価結果
+type RunResult struct {
+	Target    string        `json:"target"`
+	Provider  string        `json:"provider"`
+	Dataset   string        `json:"dataset"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Results   []Result      `json:"results"`
+}
+
+// Runner データセットをトーン設定で変換してチェックする
+type Runner struct {
+	Provider    llm.Provider
+	Concurrency int      // 同時に実行するリクエスト数（1未満は1）
+	Tones       []string // 評価するトーン（空の場合は設定ファイルの全トーン）
+}
+
+// job 評価1件分の入力
+type job struct {
+	index int
+	c     Case
+	tone  string
+}
+
+// Run データセットの全ケースを対象のトーン設定の各トーンで変換し、チェックを適用する
+// 結果はケース順・トーン名順に並ぶ
+func (r *Runner) Run(ctx context.Context, target Target, dataset *Dataset) (*RunResult, error) {
+	var jobs []job
+	for _, c := range dataset.Cases {
+		tones, err := r.tonesFor(target.Config, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, tone := range tones {
+			jobs = append(jobs, job{index: len(jobs), c: c, tone: tone})
+		}
+	}
+
+	run := &RunResult{
+		Target:    target.Name,
+		Provider:  r.Provider.Name(),
+		Dataset:   dataset.Name,
+		StartedAt: time.Now(),
+		Results:   make([]Result, len(jobs)),
+	}
+
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				run.Results[j.index] = r.evaluate(ctx, target.Config, dataset, j.c, j.tone)
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	run.Duration = time.Since(run.StartedAt)
+	return run, ctx.Err()
+}
+
+// tonesFor ケースで評価するトーン（Runner・ケースの指定と設定ファイルの共通部分）
+func (r *Runner) tonesFor(toneConfig *config.ToneConfig, c Case) ([]string, error) {
+	requested := r.Tones
+	if len(c.Tones) > 0 {
+		requested = c.Tones
+	}
+	if len(requested) == 0 {
+		requested = toneConfig.ToneNames()
+	}
+
+	tones := make([]string, 0, len(requested))
+	for _, tone := range requested {
+		if _, ok := toneConfig.Tones[tone]; !ok {
+			return nil, fmt.Errorf("ケース %s: 設定ファイルに無いトーンです: %s", c.ID, tone)
+		}
+		tones = append(tones, tone)
+	}
+	sort.Strings(tones)
+	return tones, nil
+}
+
+// evaluate 1件を変換してチェックする
+func (r *Runner) evaluate(ctx context.Context, toneConfig *config.ToneConfig, dataset *Dataset, c Case, tone string) Result {
+	result := Result{CaseID: c.ID, Tone: tone, Input: c.Input}
+
+	toneDef := toneConfig.Tones[tone]
+	prompt, err := toneConfig.RenderPrompt(toneDef, c.Input)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	modelConfig := toneConfig.GetAIModelConfig()
+	result.PromptVersion = toneConfig.PromptVersion(toneDef)
+
+	// サーバーのトーン変換と同じメタデータを付ける（フェイクプロバイダーは評価対象の特徴から応答を作る）
+	req := llm.NewUserRequest(modelConfig.Name, modelConfig.MaxTokens, prompt)
+	req.Metadata["label"] = "eval:" + c.ID + ":" + tone
+	req.Metadata["task"] = llm.TaskToneTransform
+	req.Metadata["tone"] = tone
+	req.Metadata["original_text"] = c.Input
+	req.Metadata["characteristics"] = strings.Join(toneDef.Characteristics, "\n")
+
+	resp, err := r.Provider.Complete(ctx, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// サーバーと同じく <output> を取り出した本文を評価し、トーン設定の制約もチェックする
+	result.Output = toneoutput.Sanitize(resp.Text)
+	result.Model = resp.Model
+	result.Usage = resp.Usage
+	result.Checks = runChecks(dataset.checksFor(c, tone), c, result.Output)
+	result.Checks = append(result.Checks, constraintCheck(toneConfig.ConstraintsFor(toneDef), result.Output))
+	result.Passed = len(result.FailedChecks()) == 0
+	return result
+}
+
+// ToneSummary トーン別の集計
+type ToneSummary struct {
+	Tone     string         `json:"tone"`
+	Total    int            `json:"total"`
+	Passed   int            `json:"passed"`
+	Failures map[string]int `json:"failures"` // チェック名 → 失敗数
+}
+
+// PassRate 合格率
+func (s ToneSummary) PassRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Passed) / float64(s.Total)
+}
+
+// Summary トーン別の集計をトーン名順に取得
+func (r *RunResult) Summary() []ToneSummary {
+	byTone := make(map[string]*ToneSummary)
+	for _, result := range r.Results {
+		summary, ok := byTone[result.Tone]
+		if !ok {
+			summary = &ToneSummary{Tone: result.Tone, Failures: map[string]int{}}
+			byTone[result.Tone] = summary
+		}
+		summary.Total++
+		if result.Passed {
+			summary.Passed++
+		}
+		for _, name := range result.FailedChecks() {
+			summary.Failures[name]++
+		}
+	}
+
+	summaries := make([]ToneSummary, 0, len(byTone))
+	for _, summary := range byTone {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Tone < summaries[j].Tone })
+	return summaries
+}
+
+// FailedCount 不合格の件数
+func (r *RunResult) FailedCount() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
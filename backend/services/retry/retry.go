@@ -0,0 +1,69 @@
+// Package retry 再試行の待機時間（指数バックオフ＋ジッター）と Retry-After ヘッダーの解釈
+//
+// AIプロバイダーの呼び出し（llm）とメッセージの配信・outbox イベントの配信で同じ計算を使う
+package retry
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy 再試行ポリシー（指数バックオフ＋ジッター）
+type Policy struct {
+	MaxAttempts int           // 初回を含む最大試行回数
+	BaseDelay   time.Duration // 1回目の再試行までの基準待機時間
+	MaxDelay    time.Duration // 待機時間の上限（Retry-After もこの値で切り詰める）
+	Jitter      float64       // 待機時間に加えるランダム幅（0〜1、0.2 なら ±20%）
+}
+
+// Exhausted attempts 回失敗した後、これ以上再試行しないか
+func (p Policy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+// Backoff attempt 回目（1始まり）の失敗後に待機する時間を計算
+// retryAfter（相手が Retry-After などで指定した待機時間）がバックオフより長い場合はそれを優先する
+func (p Policy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			delay = p.MaxDelay
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// ParseRetryAfter Retry-After ヘッダー（秒数またはHTTP日付）を解釈（無い・不正・過去の日付の場合は0）
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := ParseRetryAfter(" 7 "); got != 7*time.Second {
+		t.Errorf("ParseRetryAfter(seconds) = %v, want 7s", got)
+	}
+	for _, value := range []string{"", "0", "-5", "soon", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)} {
+		if got := ParseRetryAfter(value); got != 0 {
+			t.Errorf("ParseRetryAfter(%q) = %v, want 0", value, got)
+		}
+	}
+	got := ParseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got < 50*time.Second || got > time.Minute {
+		t.Errorf("ParseRetryAfter(HTTP date) = %v, want about 1m", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	for attempt, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 4: 8 * time.Minute, 5: 10 * time.Minute} {
+		if got := policy.Backoff(attempt, 0); got != want {
+			t.Errorf("Backoff(%d, 0) = %v, want %v", attempt, got, want)
+		}
+	}
+	if got := policy.Backoff(1, 3*time.Minute); got != 3*time.Minute {
+		t.Errorf("Backoff with longer Retry-After = %v, want 3m", got)
+	}
+	if got := policy.Backoff(3, time.Second); got != 4*time.Minute {
+		t.Errorf("Backoff with shorter Retry-After = %v, want 4m", got)
+	}
+	if got := policy.Backoff(1, time.Hour); got != 10*time.Minute {
+		t.Errorf("Backoff with Retry-After over MaxDelay = %v, want 10m", got)
+	}
+
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(2, 0); got < 96*time.Second || got > 144*time.Second {
+			t.Fatalf("Backoff with jitter = %v, want 2m ±20%%", got)
+		}
+	}
+}
+
+func TestExhausted(t *testing.T) {
+	policy := Policy{MaxAttempts: 3}
+	if policy.Exhausted(2) {
+		t.Error("Exhausted(2) = true, want false")
+	}
+	if !policy.Exhausted(3) {
+		t.Error("Exhausted(3) = false, want true")
+	}
+}
@@ -0,0 +1,77 @@
+// Package toneoutput トーン変換結果の後処理（<output> の抽出・マークアップの除去・制約の検証）
+//
+// トーンのテンプレートはモデルに <thinking>（考え方）と <output>（変換結果）を出させるため、
+// 応答をそのまま保存すると思考過程やタグが変換結果に混ざる。変換結果は必ず Sanitize を通してから使う
+package toneoutput
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"yanwari-message-backend/config"
+)
+
+var (
+	// outputBlockPattern 閉じタグまである <output> セクション
+	outputBlockPattern = regexp.MustCompile(`(?is)<output\s*>(.*?)</output\s*>`)
+	// openOutputPattern 閉じタグの無い <output> セクション（max_tokens で途中終了した場合など）
+	openOutputPattern = regexp.MustCompile(`(?is)<output\s*>(.*)$`)
+	// thinkingBlockPattern 思考過程のセクション（閉じタグが無い場合は末尾まで）
+	thinkingBlockPattern = regexp.MustCompile(`(?is)<thinking\s*>.*?(?:</thinking\s*>|$)`)
+	// promptTagPattern テンプレートで使っているタグ（応答に残っていれば取り除く）
+	promptTagPattern = regexp.MustCompile(`(?i)</?\s*(?:response|output|thinking|input|task|system|role|instructions?|output_format|examples?|recipient|language)\b[^>]*>`)
+	// codeFencePattern コードブロックの区切り行
+	codeFencePattern = regexp.MustCompile("(?m)^\\s*```[a-zA-Z]*\\s*$")
+	// prefacePattern 先頭の前置き行（「以下のように変換しました：」「変換後の文章:」「Here is the rewritten message:」など）
+	prefacePattern = regexp.MustCompile(`^(?:(?:はい[、，,]?\s*)?(?:以下|変換後|変換結果)[^\n]{0,30}|(?i:(?:sure|okay)[,!.]?\s*)?(?i:here is|here's)[^\n]{0,60})[:：]\s*\n`)
+	// blankLinesPattern 連続する空行
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+	// leftoverTagPattern 除去後に残ったタグ（未知のタグの漏れ）
+	leftoverTagPattern = regexp.MustCompile(`</?[a-zA-Z_][a-zA-Z0-9_-]*\s*>`)
+)
+
+// Sanitize 応答から変換結果の本文を取り出す
+//
+//   - <output> セクションがあれば最後のセクションの中身を使う（閉じタグが無い場合は末尾まで）
+//   - 無ければ <thinking> セクションを取り除いた残りを使う
+//   - テンプレートのタグ・コードブロックの区切り・先頭の前置き行を取り除く
+func Sanitize(raw string) string {
+	text := raw
+	if blocks := outputBlockPattern.FindAllStringSubmatch(text, -1); len(blocks) > 0 {
+		text = blocks[len(blocks)-1][1]
+	} else if block := openOutputPattern.FindStringSubmatch(text); block != nil {
+		text = block[1]
+	} else {
+		text = thinkingBlockPattern.ReplaceAllString(text, "")
+	}
+
+	text = promptTagPattern.ReplaceAllString(text, "")
+	text = codeFencePattern.ReplaceAllString(text, "")
+	text = strings.TrimSpace(text)
+	text = prefacePattern.ReplaceAllString(text, "")
+	text = blankLinesPattern.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// Validate 変換結果が制約を満たしているか検証し、違反内容の一覧を返す（満たしている場合は空）
+func Validate(text string, constraints config.OutputConstraints) []string {
+	if strings.TrimSpace(text) == "" {
+		return []string{"変換結果が空です"}
+	}
+
+	var violations []string
+	if length := utf8.RuneCountInString(text); constraints.MaxLength > 0 && length > constraints.MaxLength {
+		violations = append(violations, fmt.Sprintf("文字数が上限を超えています（%d文字 / 上限%d文字）", length, constraints.MaxLength))
+	}
+	for _, phrase := range constraints.MustNotContain {
+		if phrase != "" && strings.Contains(text, phrase) {
+			violations = append(violations, fmt.Sprintf("禁止語句が含まれています: %s", phrase))
+		}
+	}
+	if tag := leftoverTagPattern.FindString(text); tag != "" {
+		violations = append(violations, fmt.Sprintf("タグが含まれています: %s", tag))
+	}
+	return violations
+}
@@ -9,10 +9,13 @@ export interface ReceivedMessage {
   recipientId: string
   originalText: string
   variations: {
-    gentle?: string
-    constructive?: string
-    casual?: string
-  }
+    tone: string
+    displayName?: string
+    text: string
+    model?: string
+    promptVersion?: string
+    generatedAt: string
+  }[]
   selectedTone?: string
   finalText?: string
   status: 'sent' | 'delivered' | 'read'
@@ -138,12 +138,22 @@ export interface MessageDraft {
   updatedAt?: string
 }
 
-export interface MessageVariations {
-  gentle?: string
-  constructive?: string
-  casual?: string
+// トーン変換結果1件（生成時のメタデータ付き）
+export interface ToneVariant {
+  tone: string
+  displayName?: string
+  text: string
+  model?: string
+  promptVersion?: string
+  generatedAt: string
 }
 
+// トーン変換結果（トーン順の配列）
+export type MessageVariations = ToneVariant[]
+
+// 更新リクエスト用: トーン名 → 変換後テキスト
+export type ToneTextMap = Record<string, string>
+
 export interface CreateDraftRequest {
   originalText: string
   reason?: string
@@ -154,7 +164,7 @@ export interface UpdateDraftRequest {
   originalText?: string
   reason?: string
   recipientEmail?: string
-  variations?: MessageVariations
+  variations?: ToneTextMap
   selectedTone?: string
   scheduledAt?: string
 }
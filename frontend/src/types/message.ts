@@ -1,11 +1,39 @@
 // メッセージ関連の型定義
 
-export interface MessageVariations {
-  gentle?: string
-  constructive?: string
-  casual?: string
+// トーン変換結果1件（生成時のメタデータ付き）
+export interface ToneVariant {
+  tone: string
+  displayName?: string
+  text: string
+  model?: string
+  promptVersion?: string
+  generatedAt: string
+  // A/B 実験の群で生成された場合の割り当て
+  experiment?: {
+    experimentId: string
+    key: string
+    arm: string
+  }
 }
 
+// トーン変換結果（トーン順の配列）
+export type MessageVariations = ToneVariant[]
+
+// 追加指示による改訂1件（parentId が無い場合は tone の変換結果が起点）
+export interface ToneRefinement {
+  id: string
+  tone: string
+  parentId?: string
+  instruction: string
+  text: string
+  model?: string
+  promptVersion?: string
+  createdAt: string
+}
+
+// 更新リクエスト用: トーン名 → 変換後テキスト
+export type ToneTextMap = Record<string, string>
+
 export type MessageStatus = 'draft' | 'processing' | 'scheduled' | 'sent' | 'delivered' | 'read'
 
 export interface Message {
@@ -15,6 +43,8 @@ export interface Message {
   originalText: string
   variations: MessageVariations
   selectedTone?: string
+  selectedRevisionId?: string
+  refinements?: ToneRefinement[]
   finalText?: string
   scheduledAt?: string
   status: MessageStatus
@@ -32,8 +62,8 @@ export interface CreateMessageRequest {
 export interface UpdateMessageRequest {
   recipientEmail?: string
   originalText?: string
-  variations?: MessageVariations
-  toneVariations?: Record<string, string>
+  variations?: ToneTextMap
+  toneVariations?: ToneTextMap
   selectedTone?: string
   scheduledAt?: string
 }